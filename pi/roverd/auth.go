@@ -0,0 +1,136 @@
+package roverd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+const (
+	authNone   = "none"
+	authBearer = "bearer"
+	authHMAC   = "hmac"
+
+	// authChallengeTimeout bounds the wait for the server's nonce in hmac
+	// mode.
+	authChallengeTimeout = 5 * time.Second
+	// roverNameHeader tells the server which secret a bearer token is for
+	// before hello arrives.
+	roverNameHeader = "X-Rover-Name"
+	// authFailedReason starts the serverHello reason when the server turned
+	// down the rover's credentials rather than its protocol.
+	authFailedReason = "authentication failed"
+)
+
+var (
+	errNoChallenge = errors.New("server sent no authChallenge")
+	// errCredentialsRefused means retrying soon will not help: the secret
+	// has to change first, so Serve waits the longest back-off.
+	errCredentialsRefused = errors.New("server refused credentials")
+)
+
+// dialOptions builds the handshake for the configured authentication and
+// TLS settings. Certificates are read on every dial so rotated files are
+// picked up on the next reconnect.
+func (c *WSClient) dialOptions() (*websocket.DialOptions, error) {
+	opts := &websocket.DialOptions{HTTPHeader: http.Header{}}
+	opts.HTTPHeader.Set(roverNameHeader, c.cfg.Name)
+	if c.cfg.Auth.Mode == authBearer {
+		opts.HTTPHeader.Set("Authorization", "Bearer "+c.cfg.Auth.Secret)
+	}
+	tlsConfig, err := buildTLSConfig(c.cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		opts.HTTPClient = &http.Client{Transport: transport}
+	}
+	return opts, nil
+}
+
+// buildTLSConfig returns nil when no TLS option is set, leaving the default
+// client in place.
+func buildTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	if cfg == (TLSConfig{}) {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.ServerName,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls caFile: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls caFile %s: no certificates found", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// helloAuthFor answers the server's challenge in hmac mode; the other modes
+// need nothing in hello.
+func (c *WSClient) helloAuthFor(ctx context.Context, conn *websocket.Conn) (*helloAuth, error) {
+	if c.cfg.Auth.Mode != authHMAC {
+		return nil, nil
+	}
+	nonce, err := awaitChallenge(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return &helloAuth{
+		Mode:      authHMAC,
+		Nonce:     nonce,
+		Signature: hmacSignature(c.cfg.Auth.Secret, nonce, c.cfg.Name),
+	}, nil
+}
+
+// awaitChallenge reads until the server's authChallenge arrives. The server
+// sends it first on every connection, so anything else before it means the
+// server does not do challenges.
+func awaitChallenge(ctx context.Context, conn *websocket.Conn) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, authChallengeTimeout)
+	defer cancel()
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		return "", fmt.Errorf("waiting for authChallenge: %w", err)
+	}
+	var msg authChallengeMessage
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "authChallenge" || msg.Nonce == "" {
+		return "", errNoChallenge
+	}
+	return msg.Nonce, nil
+}
+
+// hmacSignature is the hex HMAC-SHA256 of "nonce:name" under the rover's
+// secret; binding the name stops a response being replayed for another
+// rover that shares the nonce.
+func hmacSignature(secret, nonce, name string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(nonce + ":" + name))
+	return hex.EncodeToString(mac.Sum(nil))
+}
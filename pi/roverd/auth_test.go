@@ -0,0 +1,212 @@
+package roverd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+const testRoverName = "roomba-test"
+
+// authServer stands in for the server's rover endpoint. Bearer tokens are
+// checked at the handshake as ws.js does; in hmac mode every connection
+// gets a fresh nonce and hello is checked as roverAuthService.js does.
+type authServer struct {
+	*httptest.Server
+	secret string
+
+	mu     sync.Mutex
+	nonces int
+}
+
+func newAuthServer(t *testing.T, secret string) *authServer {
+	t.Helper()
+	s := &authServer{secret: secret}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *authServer) serve(w http.ResponseWriter, r *http.Request) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if r.Header.Get(roverNameHeader) != testRoverName || token != s.secret {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	ctx := r.Context()
+
+	s.mu.Lock()
+	s.nonces++
+	nonce := fmt.Sprintf("nonce-%d", s.nonces)
+	s.mu.Unlock()
+	if err := writeJSON(ctx, conn, authChallengeMessage{Type: "authChallenge", Nonce: nonce}); err != nil {
+		return
+	}
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		return
+	}
+	var hello helloMessage
+	if err := json.Unmarshal(data, &hello); err != nil {
+		return
+	}
+	reply := serverHelloMessage{Type: "serverHello", ProtocolVersion: protocolVersion, Accepted: true}
+	switch {
+	case r.Header.Get("Authorization") != "":
+	case hello.Auth == nil:
+		reply.Accepted, reply.Reason = false, authFailedReason+": credentials required"
+	case hello.Auth.Nonce != nonce:
+		reply.Accepted, reply.Reason = false, authFailedReason+": stale challenge"
+	case hello.Auth.Signature != hmacSignature(s.secret, nonce, hello.Name):
+		reply.Accepted, reply.Reason = false, authFailedReason+": bad signature"
+	}
+	writeJSON(ctx, conn, reply)
+}
+
+func (s *authServer) url() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+func newAuthClient(mode, secret string) *WSClient {
+	return &WSClient{cfg: &Config{Name: testRoverName, Auth: AuthConfig{Mode: mode, Secret: secret}}}
+}
+
+// dialHello connects c to srv, answers the challenge the way Run does and
+// negotiates the server's reply to hello.
+func dialHello(t *testing.T, c *WSClient, srv *authServer) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opts, err := c.dialOptions()
+	if err != nil {
+		t.Fatalf("dialOptions: %v", err)
+	}
+	conn, _, err := websocket.Dial(ctx, srv.url(), opts)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	auth, err := c.helloAuthFor(ctx, conn)
+	if err != nil {
+		t.Fatalf("helloAuthFor: %v", err)
+	}
+	if c.cfg.Auth.Mode != authHMAC {
+		// The challenge is still sent; bearer and none ignore it.
+		if _, _, err := conn.Read(ctx); err != nil {
+			t.Fatalf("read challenge: %v", err)
+		}
+	}
+	return helloRoundTrip(ctx, t, conn, auth)
+}
+
+func helloRoundTrip(ctx context.Context, t *testing.T, conn *websocket.Conn, auth *helloAuth) error {
+	t.Helper()
+	if err := writeJSON(ctx, conn, helloMessage{Type: "hello", Name: testRoverName, Auth: auth}); err != nil {
+		t.Fatalf("send hello: %v", err)
+	}
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("read serverHello: %v", err)
+	}
+	var reply serverHelloMessage
+	if err := json.Unmarshal(data, &reply); err != nil {
+		t.Fatalf("decode serverHello: %v", err)
+	}
+	_, err = negotiateProtocol(&reply)
+	return err
+}
+
+func TestBearerAccepted(t *testing.T) {
+	srv := newAuthServer(t, "s3cret")
+	if err := dialHello(t, newAuthClient(authBearer, "s3cret"), srv); err != nil {
+		t.Fatalf("hello with the right token: %v", err)
+	}
+}
+
+func TestBearerRefusedAtHandshake(t *testing.T) {
+	srv := newAuthServer(t, "s3cret")
+	c := newAuthClient(authBearer, "wrong")
+	err := c.Run(context.Background(), srv.url())
+	c.disconnectT.Stop()
+	if !errors.Is(err, errCredentialsRefused) {
+		t.Fatalf("Run with a wrong token = %v, want errCredentialsRefused", err)
+	}
+}
+
+func TestHMACAccepted(t *testing.T) {
+	srv := newAuthServer(t, "s3cret")
+	if err := dialHello(t, newAuthClient(authHMAC, "s3cret"), srv); err != nil {
+		t.Fatalf("hello signed with the right secret: %v", err)
+	}
+}
+
+func TestHMACWrongSignature(t *testing.T) {
+	srv := newAuthServer(t, "s3cret")
+	err := dialHello(t, newAuthClient(authHMAC, "wrong"), srv)
+	if !errors.Is(err, errCredentialsRefused) || !strings.Contains(err.Error(), "bad signature") {
+		t.Fatalf("hello signed with the wrong secret = %v, want refused for bad signature", err)
+	}
+}
+
+func TestHMACStaleNonce(t *testing.T) {
+	srv := newAuthServer(t, "s3cret")
+	c := newAuthClient(authHMAC, "s3cret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Answer the first connection's challenge, then replay that answer on
+	// a second connection, which was sent a different nonce.
+	first, _, err := websocket.Dial(ctx, srv.url(), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	stale, err := c.helloAuthFor(ctx, first)
+	first.Close(websocket.StatusNormalClosure, "")
+	if err != nil {
+		t.Fatalf("helloAuthFor: %v", err)
+	}
+	second, _, err := websocket.Dial(ctx, srv.url(), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer second.Close(websocket.StatusNormalClosure, "")
+	if _, err := awaitChallenge(ctx, second); err != nil {
+		t.Fatalf("awaitChallenge: %v", err)
+	}
+	err = helloRoundTrip(ctx, t, second, stale)
+	if !errors.Is(err, errCredentialsRefused) || !strings.Contains(err.Error(), "stale challenge") {
+		t.Fatalf("replayed hello = %v, want refused for stale challenge", err)
+	}
+}
+
+func TestHMACSignatureBindsName(t *testing.T) {
+	a := hmacSignature("s3cret", "nonce", "roomba-a")
+	if a != hmacSignature("s3cret", "nonce", "roomba-a") {
+		t.Fatal("signature is not deterministic")
+	}
+	if a == hmacSignature("s3cret", "nonce", "roomba-b") {
+		t.Fatal("signature does not depend on the rover name")
+	}
+}
+
+func TestProtocolRejectionIsNotRefusedCredentials(t *testing.T) {
+	_, err := negotiateProtocol(&serverHelloMessage{Reason: "rover protocol 2 too old"})
+	if !errors.Is(err, errHelloRejected) || errors.Is(err, errCredentialsRefused) {
+		t.Fatalf("protocol rejection = %v, want errHelloRejected only", err)
+	}
+}
@@ -3,30 +3,72 @@ package roverd
 import (
 	"context"
 	"log"
+	"sync"
 	"time"
 )
 
+// Events the auto-charge controller reports while re-seating the rover.
 const (
-	autoChargeTimeout  = 10 * time.Second
-	autoChargeCooldown = 0 * time.Minute
-	sourceHomeBase     = 1 << 1
+	eventAutoChargeFault          = "autoCharge.fault"
+	eventAutoChargeGaveUp         = "autoCharge.gaveUp"
+	eventAutoChargeSeekDockError  = "autoCharge.seekDockError"
+	eventAutoChargeSeekDockIssued = "autoCharge.seekDockIssued"
+	eventAutoChargeState          = "autoCharge.state"
 )
 
+const sourceHomeBase = 1 << 1
+
+// chargingStateFault is packet 21's charging fault condition.
+const chargingStateFault = 5
+
+// Auto-charge states. idle is off the dock; charging covers every active
+// charging state; waiting is docked without charge, before the first Seek
+// Dock; backoff waits between attempts; fault is charging state 5; gaveUp
+// is terminal until the rover starts charging or stays off the dock.
+const (
+	autoChargeIdle     = "idle"
+	autoChargeCharging = "charging"
+	autoChargeWaiting  = "waiting"
+	autoChargeBackoff  = "backoff"
+	autoChargeFault    = "fault"
+	autoChargeGaveUp   = "gaveUp"
+)
+
+// AutoChargeController re-seats a rover that sits on the dock without
+// charging. It is a state machine driven by packets 21 and 34: after
+// Timeout on the dock without charge it issues Seek Dock, retries up to
+// MaxRetries times with exponential back-off and then gives up and alerts.
+// Dock contact is debounced so a flapping ChargeSources bit does not
+// restart the sequence, and Seek Dock itself backs the rover off the dock,
+// so the attempts only reset once it charges or stays off the dock for
+// longer than an attempt takes.
 type AutoChargeController struct {
-	adapter       *SerialAdapter
-	events        chan<- RoverEvent
-	logger        *log.Logger
-	timerStart    time.Time
-	cooldownUntil time.Time
-	lastState     byte
-	lastSources   byte
+	cfg     AutoChargeConfig
+	adapter *SerialAdapter
+	modes   *OIModeTracker
+	deadman *DriveDeadman
+	events  chan<- RoverEvent
+	logger  *log.Logger
+
+	mu          sync.Mutex
+	state       string
+	since       time.Time
+	retries     int
+	nextAttempt time.Time
+	dock        dockDebouncer
 }
 
-func NewAutoChargeController(adapter *SerialAdapter, events chan<- RoverEvent, logger *log.Logger) *AutoChargeController {
+func NewAutoChargeController(cfg AutoChargeConfig, adapter *SerialAdapter, modes *OIModeTracker, deadman *DriveDeadman, events chan<- RoverEvent, logger *log.Logger) *AutoChargeController {
 	return &AutoChargeController{
+		cfg:     cfg,
 		adapter: adapter,
+		modes:   modes,
+		deadman: deadman,
 		events:  events,
 		logger:  logger,
+		state:   autoChargeIdle,
+		since:   time.Now(),
+		dock:    dockDebouncer{delay: cfg.DockDebounce.Duration},
 	}
 }
 
@@ -41,46 +83,184 @@ func (a *AutoChargeController) Run(ctx context.Context, samples <-chan SensorSam
 	}
 }
 
+// State returns the current state and how many Seek Dock attempts the
+// current docking has used.
+func (a *AutoChargeController) State() (state string, retries int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.state, a.retries
+}
+
 func (a *AutoChargeController) processSample(sample SensorSample) {
+	if !a.cfg.Enabled || !sample.Has(21) || !sample.Has(34) {
+		return
+	}
 	now := time.Now()
-	docked := sample.ChargeSources&sourceHomeBase != 0
-	charging := isCharging(sample.ChargingState)
-
-	if !docked || charging {
-		if !a.timerStart.IsZero() {
-			a.emitEvent("autoCharge.timerCleared", map[string]any{
-				"durationMs": time.Since(a.timerStart).Milliseconds(),
-			})
+	a.mu.Lock()
+	attempt, waited := a.stepLocked(sample, now)
+	a.mu.Unlock()
+	if attempt > 0 {
+		a.seekDock(attempt, waited)
+	}
+}
+
+// stepLocked advances the state machine. A non-zero attempt means Seek Dock
+// is due; the caller sends it after releasing the lock.
+func (a *AutoChargeController) stepLocked(sample SensorSample, now time.Time) (attempt int, waited time.Duration) {
+	docked := a.dock.update(sample.ChargeSources&sourceHomeBase != 0, now)
+	switch {
+	case !docked:
+		a.transitionLocked(autoChargeIdle, "undocked", now)
+		if a.retries > 0 && now.Sub(a.since) > a.cfg.Timeout.Duration+a.backoffFor(a.retries) {
+			// Off the dock for longer than a seek takes: driven away.
+			a.retries = 0
 		}
-		a.timerStart = time.Time{}
-		a.lastState = sample.ChargingState
-		a.lastSources = sample.ChargeSources
-		return
+		return 0, 0
+	case sample.ChargingState == chargingStateFault:
+		a.transitionLocked(autoChargeFault, "chargingFault", now)
+		return 0, 0
+	case isCharging(sample.ChargingState):
+		a.transitionLocked(autoChargeCharging, "charging", now)
+		a.retries = 0
+		return 0, 0
 	}
 
-	// docked but not charging
-	if a.cooldownUntil.After(now) {
-		return
+	// Docked without charge. The Roomba only charges in Passive; while it
+	// is still in Safe or Full the mode tracker is about to drop it, so the
+	// clock does not start yet.
+	mode, modeKnown := a.modes.Mode()
+	waitingForPassive := modeKnown && isDriveMode(mode) && a.modes.PassiveOnDock()
+
+	switch a.state {
+	case autoChargeIdle, autoChargeCharging, autoChargeFault:
+		if a.retries == 0 {
+			a.transitionLocked(autoChargeWaiting, "notCharging", now)
+			return 0, 0
+		}
+		// Back on the dock after a seek that did not charge. The next
+		// attempt waits out both the back-off and the usual timeout.
+		a.nextAttempt = later(a.nextAttempt, now.Add(a.cfg.Timeout.Duration))
+		a.transitionLocked(autoChargeBackoff, "notCharging", now)
+	case autoChargeWaiting:
+		if waitingForPassive {
+			a.since = now
+		} else if now.Sub(a.since) >= a.cfg.Timeout.Duration {
+			return a.startSeekLocked(now)
+		}
+	case autoChargeBackoff:
+		if waitingForPassive || now.Before(a.nextAttempt) {
+			return 0, 0
+		}
+		if a.retries >= a.cfg.MaxRetries {
+			a.transitionLocked(autoChargeGaveUp, "retriesExhausted", now)
+			a.logger.Printf("auto-charge gave up after %d seek dock attempts", a.retries)
+			return 0, 0
+		}
+		return a.startSeekLocked(now)
+	}
+	return 0, 0
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
 	}
+	return b
+}
 
-	if a.timerStart.IsZero() {
-		a.timerStart = now
-		a.emitEvent("autoCharge.timerStarted", map[string]any{
-			"chargingState": sample.ChargingState,
+// dockDebouncer only accepts a change of the home-base bit once it has held
+// for delay.
+type dockDebouncer struct {
+	delay     time.Duration
+	docked    bool
+	raw       bool
+	changedAt time.Time
+}
+
+func (d *dockDebouncer) update(raw bool, now time.Time) bool {
+	if raw != d.raw {
+		d.raw = raw
+		d.changedAt = now
+	}
+	if d.docked != raw && now.Sub(d.changedAt) >= d.delay {
+		d.docked = raw
+	}
+	return d.docked
+}
+
+// backoffFor is the wait after the given Seek Dock attempt.
+func (a *AutoChargeController) backoffFor(attempt int) time.Duration {
+	backoff := a.cfg.Backoff.Duration << (attempt - 1)
+	if backoff > a.cfg.BackoffMax.Duration || backoff <= 0 {
+		backoff = a.cfg.BackoffMax.Duration
+	}
+	return backoff
+}
+
+// startSeekLocked counts the next attempt and schedules the one after it.
+func (a *AutoChargeController) startSeekLocked(now time.Time) (attempt int, waited time.Duration) {
+	a.retries++
+	a.nextAttempt = now.Add(a.backoffFor(a.retries))
+	waited = now.Sub(a.since)
+	a.transitionLocked(autoChargeBackoff, "seekDock", now)
+	return a.retries, waited
+}
+
+func (a *AutoChargeController) seekDock(attempt int, waited time.Duration) {
+	err := a.deadman.CheckEStop()
+	if err == nil {
+		err = a.adapter.SeekDock()
+	}
+	if err != nil {
+		a.emitEvent(eventAutoChargeSeekDockError, map[string]any{
+			"attempt": attempt,
+			"error":   err.Error(),
 		})
 		return
 	}
+	a.emitEvent(eventAutoChargeSeekDockIssued, map[string]any{
+		"attempt":    attempt,
+		"maxRetries": a.cfg.MaxRetries,
+		"waitingMs":  waited.Milliseconds(),
+	})
+}
+
+func (a *AutoChargeController) transitionLocked(to, reason string, now time.Time) {
+	if a.state == to {
+		return
+	}
+	from := a.state
+	data := map[string]any{
+		"from":       from,
+		"state":      to,
+		"reason":     reason,
+		"retries":    a.retries,
+		"durationMs": now.Sub(a.since).Milliseconds(),
+	}
+	if to == autoChargeBackoff {
+		data["nextAttemptMs"] = a.nextAttempt.Sub(now).Milliseconds()
+	}
+	a.state = to
+	a.since = now
+	a.emitEvent(eventAutoChargeState, data)
+	switch to {
+	case autoChargeFault:
+		a.logger.Printf("auto-charge: charging fault reported on the dock")
+		a.emitEvent(eventAutoChargeFault, map[string]any{"from": from})
+	case autoChargeGaveUp:
+		a.emitEvent(eventAutoChargeGaveUp, map[string]any{"attempts": a.retries})
+	}
+}
 
-	if now.Sub(a.timerStart) >= autoChargeTimeout {
-		if err := a.adapter.SeekDock(); err != nil {
-			a.emitEvent("autoCharge.seekDockError", map[string]any{"error": err.Error()})
-		} else {
-			a.emitEvent("autoCharge.seekDockIssued", map[string]any{
-				"waitingMs": autoChargeTimeout.Milliseconds(),
-			})
-		}
-		a.timerStart = time.Time{}
-		a.cooldownUntil = now.Add(autoChargeCooldown)
+func (a *AutoChargeController) autoChargeInfo() autoChargeInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return autoChargeInfo{
+		Enabled:    a.cfg.Enabled,
+		State:      a.state,
+		Retries:    a.retries,
+		MaxRetries: a.cfg.MaxRetries,
+		TimeoutMs:  a.cfg.Timeout.Milliseconds(),
 	}
 }
 
@@ -94,16 +274,5 @@ func isCharging(state byte) bool {
 }
 
 func (a *AutoChargeController) emitEvent(event string, data map[string]any) {
-	if a.events == nil {
-		return
-	}
-	select {
-	case a.events <- RoverEvent{
-		Type:  "event",
-		Event: event,
-		Ts:    time.Now().UnixMilli(),
-		Data:  data,
-	}:
-	default:
-	}
+	emitRoverEvent(a.events, event, data)
 }
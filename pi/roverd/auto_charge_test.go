@@ -0,0 +1,102 @@
+package roverd
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func newTestAutoCharge(t *testing.T, maxRetries int) *AutoChargeController {
+	t.Helper()
+	logger := log.New(io.Discard, "", 0)
+	adapter := NewSerialAdapter(discardPort{}, logger)
+	modes := NewOIModeTracker(DriveConfig{}, adapter, nil, nil, logger)
+	cfg := AutoChargeConfig{
+		Enabled:    true,
+		Timeout:    Duration{Duration: 10 * time.Second},
+		MaxRetries: maxRetries,
+		Backoff:    Duration{Duration: 30 * time.Second},
+		BackoffMax: Duration{Duration: 5 * time.Minute},
+	}
+	return NewAutoChargeController(cfg, adapter, modes, nil, nil, logger)
+}
+
+// chargeStep feeds a a charging state and dock bit at sec seconds and
+// checks the state and Seek Dock attempt that result.
+func chargeStep(t *testing.T, a *AutoChargeController, sec int, docked bool, state byte, wantState string, wantAttempt int) {
+	t.Helper()
+	var sources byte
+	if docked {
+		sources = sourceHomeBase
+	}
+	sample, err := decodeQueryReply([]byte{21, 34}, []byte{state, sources})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempt, _ := a.stepLocked(sample, time.Unix(1000+int64(sec), 0))
+	if a.state != wantState || attempt != wantAttempt {
+		t.Fatalf("at %ds: state %s, attempt %d; want %s, %d", sec, a.state, attempt, wantState, wantAttempt)
+	}
+}
+
+func TestAutoChargeRetriesThenGivesUp(t *testing.T) {
+	a := newTestAutoCharge(t, 2)
+	chargeStep(t, a, 0, true, 0, autoChargeWaiting, 0)
+	chargeStep(t, a, 9, true, 0, autoChargeWaiting, 0)
+	chargeStep(t, a, 10, true, 0, autoChargeBackoff, 1)
+	chargeStep(t, a, 39, true, 0, autoChargeBackoff, 0)
+	chargeStep(t, a, 40, true, 0, autoChargeBackoff, 2)
+	// The second back-off is twice the first.
+	chargeStep(t, a, 99, true, 0, autoChargeBackoff, 0)
+	chargeStep(t, a, 100, true, 0, autoChargeGaveUp, 0)
+	chargeStep(t, a, 500, true, 0, autoChargeGaveUp, 0)
+
+	chargeStep(t, a, 501, true, 2, autoChargeCharging, 0)
+	if a.retries != 0 {
+		t.Fatalf("retries = %d after charging, want 0", a.retries)
+	}
+}
+
+func TestAutoChargeKeepsRetriesWhileSeeking(t *testing.T) {
+	a := newTestAutoCharge(t, 2)
+	chargeStep(t, a, 0, true, 0, autoChargeWaiting, 0)
+	chargeStep(t, a, 10, true, 0, autoChargeBackoff, 1)
+
+	// Seek Dock backs off the dock and comes back without charging.
+	chargeStep(t, a, 11, false, 0, autoChargeIdle, 0)
+	chargeStep(t, a, 15, true, 0, autoChargeBackoff, 0)
+	chargeStep(t, a, 39, true, 0, autoChargeBackoff, 0)
+	chargeStep(t, a, 40, true, 0, autoChargeBackoff, 2)
+
+	chargeStep(t, a, 41, false, 0, autoChargeIdle, 0)
+	chargeStep(t, a, 45, true, 0, autoChargeBackoff, 0)
+	chargeStep(t, a, 100, true, 0, autoChargeGaveUp, 0)
+}
+
+func TestAutoChargeRedockWaitsForTimeout(t *testing.T) {
+	a := newTestAutoCharge(t, 3)
+	chargeStep(t, a, 0, true, 0, autoChargeWaiting, 0)
+	chargeStep(t, a, 10, true, 0, autoChargeBackoff, 1)
+	chargeStep(t, a, 11, false, 0, autoChargeIdle, 0)
+	// Back on the dock after the back-off ran out: the timeout still applies.
+	chargeStep(t, a, 50, true, 0, autoChargeBackoff, 0)
+	chargeStep(t, a, 59, true, 0, autoChargeBackoff, 0)
+	chargeStep(t, a, 60, true, 0, autoChargeBackoff, 2)
+}
+
+func TestAutoChargeResetsAfterSustainedUndock(t *testing.T) {
+	a := newTestAutoCharge(t, 2)
+	chargeStep(t, a, 0, true, 0, autoChargeWaiting, 0)
+	chargeStep(t, a, 10, true, 0, autoChargeBackoff, 1)
+	chargeStep(t, a, 11, false, 0, autoChargeIdle, 0)
+	chargeStep(t, a, 51, false, 0, autoChargeIdle, 0)
+	if a.retries != 1 {
+		t.Fatalf("retries = %d within timeout plus back-off, want 1", a.retries)
+	}
+	chargeStep(t, a, 52, false, 0, autoChargeIdle, 0)
+	if a.retries != 0 {
+		t.Fatalf("retries = %d after a sustained undock, want 0", a.retries)
+	}
+	chargeStep(t, a, 60, true, 0, autoChargeWaiting, 0)
+}
@@ -0,0 +1,215 @@
+package roverd
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// Threshold events, emitted once each time the charge falls through one.
+const (
+	eventBatteryUrgent = "battery.urgent"
+	eventBatteryWarn   = "battery.warn"
+)
+
+const (
+	// batteryReportInterval is how often the websocket client publishes
+	// the estimate.
+	batteryReportInterval = 2 * time.Second
+	// batteryRateTau is the time constant of the current smoothing; long
+	// enough to ride out a short burst of driving.
+	batteryRateTau = 60 * time.Second
+	// batteryThresholdHysteresis re-arms warn/urgent only once the charge
+	// is clearly back above the threshold.
+	batteryThresholdHysteresis = 30 // mAh
+	// batteryVoltageEmptyMv/FullMv bound the voltage fallback used when the
+	// stream carries no charge or capacity packets.
+	batteryVoltageEmptyMv = 13000
+	batteryVoltageFullMv  = 16500
+)
+
+// BatteryState is the current battery estimate. SoC is 0-1; the times are
+// zero when they cannot be estimated. TimeToEmpty runs to the urgent
+// threshold, since that is where the rover has to be back on the dock;
+// TimeToFull runs to the full threshold.
+type BatteryState struct {
+	SoC           float64
+	Source        string
+	ChargeMah     int
+	CapacityMah   int
+	VoltageMv     int
+	CurrentMa     int
+	TemperatureC  int
+	ChargingState byte
+	Charging      bool
+	DischargeMa   float64
+	ChargeMa      float64
+	TimeToEmpty   time.Duration
+	TimeToFull    time.Duration
+	Warn          bool
+	Urgent        bool
+	Timestamp     int64
+}
+
+// BatteryEstimator turns the battery packets (21-26) into a state of
+// charge, smoothed charge and discharge rates and time-to-empty/full, and
+// emits battery.warn/battery.urgent when the charge falls through the
+// configured thresholds.
+type BatteryEstimator struct {
+	cfg    BatteryConfig
+	events chan<- RoverEvent
+	logger *log.Logger
+
+	mu       sync.Mutex
+	state    BatteryState
+	seq      uint64
+	lastTime time.Time
+	warned   bool
+	urgent   bool
+}
+
+func NewBatteryEstimator(cfg BatteryConfig, events chan<- RoverEvent, logger *log.Logger) *BatteryEstimator {
+	return &BatteryEstimator{
+		cfg:    cfg,
+		events: events,
+		logger: logger,
+	}
+}
+
+func (b *BatteryEstimator) Run(ctx context.Context, samples <-chan SensorSample) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sample := <-samples:
+			b.observe(sample)
+		}
+	}
+}
+
+// State returns the latest estimate and a sequence number that changes
+// whenever it is updated; ok is false until the first battery packet.
+func (b *BatteryEstimator) State() (state BatteryState, seq uint64, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state, b.seq, b.seq > 0
+}
+
+func (b *BatteryEstimator) observe(sample SensorSample) {
+	if !sample.Has(21) && !sample.Has(22) && !sample.Has(23) && !sample.Has(25) {
+		return
+	}
+	now := time.UnixMilli(sample.Timestamp)
+
+	b.mu.Lock()
+	st := b.state
+	if sample.Has(21) {
+		st.ChargingState = sample.ChargingState
+		st.Charging = sample.ChargingState >= 1 && sample.ChargingState <= 3
+	}
+	if sample.Has(22) {
+		st.VoltageMv = int(sample.VoltageMv)
+	}
+	if sample.Has(24) {
+		st.TemperatureC = int(sample.TemperatureC)
+	}
+	if sample.Has(25) {
+		st.ChargeMah = int(sample.BatteryChargeMah)
+	}
+	if sample.Has(26) {
+		st.CapacityMah = int(sample.BatteryCapacityMah)
+	}
+	if sample.Has(23) {
+		st.CurrentMa = int(sample.CurrentMa)
+		dt := batteryRateTau
+		if !b.lastTime.IsZero() {
+			dt = now.Sub(b.lastTime)
+		}
+		b.lastTime = now
+		alpha := 1 - math.Exp(-dt.Seconds()/batteryRateTau.Seconds())
+		if st.CurrentMa < 0 {
+			st.DischargeMa = smoothRate(st.DischargeMa, float64(-st.CurrentMa), alpha)
+		} else if st.CurrentMa > 0 {
+			st.ChargeMa = smoothRate(st.ChargeMa, float64(st.CurrentMa), alpha)
+		}
+	}
+
+	capacity := st.CapacityMah
+	if capacity <= 0 {
+		capacity = b.cfg.Full
+	}
+	switch {
+	case st.ChargeMah > 0 && capacity > 0:
+		st.SoC = clampFloat(float64(st.ChargeMah)/float64(capacity), 0, 1)
+		st.Source = "charge"
+	case st.VoltageMv > 0:
+		st.SoC = clampFloat(float64(st.VoltageMv-batteryVoltageEmptyMv)/(batteryVoltageFullMv-batteryVoltageEmptyMv), 0, 1)
+		st.Source = "voltage"
+	}
+
+	st.TimeToEmpty, st.TimeToFull = 0, 0
+	if st.ChargeMah > 0 {
+		if !st.Charging && st.DischargeMa > 0 && st.ChargeMah > b.cfg.Urgent {
+			st.TimeToEmpty = hoursDuration(float64(st.ChargeMah-b.cfg.Urgent) / st.DischargeMa)
+		}
+		if st.Charging && st.ChargeMa > 0 && st.ChargeMah < b.cfg.Full {
+			st.TimeToFull = hoursDuration(float64(b.cfg.Full-st.ChargeMah) / st.ChargeMa)
+		}
+	}
+
+	var crossed []string
+	if sample.Has(25) {
+		charge := st.ChargeMah
+		if b.cfg.Warn > 0 {
+			if !b.warned && charge <= b.cfg.Warn {
+				b.warned = true
+				crossed = append(crossed, eventBatteryWarn)
+			} else if b.warned && charge > b.cfg.Warn+batteryThresholdHysteresis {
+				b.warned = false
+			}
+		}
+		if b.cfg.Urgent > 0 {
+			if !b.urgent && charge <= b.cfg.Urgent {
+				b.urgent = true
+				crossed = append(crossed, eventBatteryUrgent)
+			} else if b.urgent && charge > b.cfg.Urgent+batteryThresholdHysteresis {
+				b.urgent = false
+			}
+		}
+	}
+	st.Warn, st.Urgent = b.warned, b.urgent
+	st.Timestamp = sample.Timestamp
+	b.state = st
+	b.seq++
+	b.mu.Unlock()
+
+	for _, event := range crossed {
+		threshold := b.cfg.Warn
+		if event == eventBatteryUrgent {
+			threshold = b.cfg.Urgent
+		}
+		b.logger.Printf("%s: charge %d mAh at or below %d mAh", event, st.ChargeMah, threshold)
+		data := map[string]any{
+			"chargeMah":    st.ChargeMah,
+			"thresholdMah": threshold,
+			"soc":          math.Round(st.SoC*1000) / 1000,
+		}
+		if st.TimeToEmpty > 0 {
+			data["timeToEmptySec"] = int(st.TimeToEmpty.Seconds())
+		}
+		emitRoverEvent(b.events, event, data)
+	}
+}
+
+func smoothRate(prev, value, alpha float64) float64 {
+	if prev == 0 {
+		return value
+	}
+	return prev + alpha*(value-prev)
+}
+
+func hoursDuration(hours float64) time.Duration {
+	return time.Duration(hours * float64(time.Hour))
+}
@@ -0,0 +1,290 @@
+package roverd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Events recorded at both ends of a dock stay.
+const (
+	eventChargeJournalDocked   = "chargeJournal.docked"
+	eventChargeJournalUndocked = "chargeJournal.undocked"
+)
+
+// chargeJournalSaveInterval bounds how much of an open session is lost on a
+// crash; state changes are written immediately.
+const chargeJournalSaveInterval = time.Minute
+
+// ChargeSession is one stay on the dock.
+type ChargeSession struct {
+	DockedAt         int64             `json:"dockedAt"`
+	UndockedAt       int64             `json:"undockedAt,omitempty"`
+	DurationMs       int64             `json:"durationMs"`
+	ChargingMs       int64             `json:"chargingMs"`
+	StartChargeMah   int               `json:"startChargeMah"`
+	EndChargeMah     int               `json:"endChargeMah"`
+	CapacityMah      int               `json:"capacityMah,omitempty"`
+	PeakTemperatureC int               `json:"peakTemperatureC"`
+	States           []chargeStateStep `json:"states"`
+	Result           string            `json:"result"`
+	Open             bool              `json:"open,omitempty"`
+	Interrupted      bool              `json:"interrupted,omitempty"`
+}
+
+type chargeStateStep struct {
+	State byte   `json:"state"`
+	Name  string `json:"name"`
+	At    int64  `json:"at"`
+}
+
+type chargeJournalFile struct {
+	Sessions []ChargeSession `json:"sessions"`
+	Open     *ChargeSession  `json:"open,omitempty"`
+}
+
+// ChargeJournal records every dock stay - the charging-state sequence,
+// start and end charge, peak temperature and time spent charging - and keeps
+// the last MaxSessions of them in a JSON file so they survive restarts.
+type ChargeJournal struct {
+	cfg    ChargeJournalConfig
+	events chan<- RoverEvent
+	logger *log.Logger
+
+	mu           sync.Mutex
+	sessions     []ChargeSession
+	open         *ChargeSession
+	dock         dockDebouncer
+	lastState    byte
+	hasState     bool
+	chargingFrom time.Time
+	lastSample   time.Time
+	lastSave     time.Time
+}
+
+func NewChargeJournal(cfg ChargeJournalConfig, dockDebounce time.Duration, events chan<- RoverEvent, logger *log.Logger) (*ChargeJournal, error) {
+	j := &ChargeJournal{
+		cfg:    cfg,
+		events: events,
+		logger: logger,
+		dock:   dockDebouncer{delay: dockDebounce},
+	}
+	data, err := os.ReadFile(cfg.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file chargeJournalFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	j.sessions = file.Sessions
+	if file.Open != nil {
+		// The session was open when roverd stopped. Close it as of its
+		// last update; if the rover is still docked a new one starts.
+		s := *file.Open
+		s.Open = false
+		s.Interrupted = true
+		s.UndockedAt = s.DockedAt + s.DurationMs
+		j.appendLocked(s)
+	}
+	return j, nil
+}
+
+func (j *ChargeJournal) Run(ctx context.Context, samples <-chan SensorSample) {
+	for {
+		select {
+		case <-ctx.Done():
+			j.mu.Lock()
+			j.saveLocked()
+			j.mu.Unlock()
+			return
+		case sample := <-samples:
+			j.observe(sample)
+		}
+	}
+}
+
+// History returns up to limit sessions, newest first, including the one in
+// progress. A limit of zero or less returns them all.
+func (j *ChargeJournal) History(limit int) []ChargeSession {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make([]ChargeSession, 0, len(j.sessions)+1)
+	if j.open != nil {
+		out = append(out, *j.open)
+	}
+	for i := len(j.sessions) - 1; i >= 0; i-- {
+		out = append(out, j.sessions[i])
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+func (j *ChargeJournal) observe(sample SensorSample) {
+	if !sample.Has(34) {
+		return
+	}
+	now := time.UnixMilli(sample.Timestamp)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	docked := j.dock.update(sample.ChargeSources&sourceHomeBase != 0, now)
+	switch {
+	case docked && j.open == nil:
+		j.open = &ChargeSession{DockedAt: sample.Timestamp, Open: true}
+		j.hasState, j.chargingFrom = false, time.Time{}
+		if sample.Has(25) {
+			j.open.StartChargeMah = int(sample.BatteryChargeMah)
+		}
+		emitRoverEvent(j.events, eventChargeJournalDocked, map[string]any{"startChargeMah": j.open.StartChargeMah})
+		j.saveLocked()
+	case !docked && j.open != nil:
+		if !j.chargingFrom.IsZero() {
+			j.open.ChargingMs += now.Sub(j.lastSample).Milliseconds()
+		}
+		j.closeLocked(now)
+		return
+	}
+	s := j.open
+	if s == nil {
+		return
+	}
+
+	if !j.chargingFrom.IsZero() {
+		s.ChargingMs += now.Sub(j.lastSample).Milliseconds()
+	}
+	j.lastSample = now
+	s.DurationMs = sample.Timestamp - s.DockedAt
+	if sample.Has(25) {
+		s.EndChargeMah = int(sample.BatteryChargeMah)
+		if s.StartChargeMah == 0 {
+			s.StartChargeMah = s.EndChargeMah
+		}
+	}
+	if sample.Has(26) {
+		s.CapacityMah = int(sample.BatteryCapacityMah)
+	}
+	if sample.Has(24) && (int(sample.TemperatureC) > s.PeakTemperatureC || len(s.States) == 0) {
+		s.PeakTemperatureC = int(sample.TemperatureC)
+	}
+	if sample.Has(21) && (!j.hasState || sample.ChargingState != j.lastState) {
+		j.lastState, j.hasState = sample.ChargingState, true
+		s.States = append(s.States, chargeStateStep{
+			State: sample.ChargingState,
+			Name:  chargingStateName(sample.ChargingState),
+			At:    sample.Timestamp,
+		})
+		if sample.ChargingState >= 1 && sample.ChargingState <= 3 {
+			if j.chargingFrom.IsZero() {
+				j.chargingFrom = now
+			}
+		} else {
+			j.chargingFrom = time.Time{}
+		}
+		j.saveLocked()
+		return
+	}
+	if now.Sub(j.lastSave) >= chargeJournalSaveInterval {
+		j.saveLocked()
+	}
+}
+
+func (j *ChargeJournal) closeLocked(now time.Time) {
+	s := *j.open
+	j.open = nil
+	s.Open = false
+	s.UndockedAt = now.UnixMilli()
+	s.DurationMs = s.UndockedAt - s.DockedAt
+	s.Result = chargeSessionResult(s)
+	j.appendLocked(s)
+	j.saveLocked()
+	j.logger.Printf("charge session closed: %s after %s, %d -> %d mAh", s.Result,
+		time.Duration(s.DurationMs)*time.Millisecond, s.StartChargeMah, s.EndChargeMah)
+	emitRoverEvent(j.events, eventChargeJournalUndocked, map[string]any{
+		"result":     s.Result,
+		"durationMs": s.DurationMs,
+		"chargingMs": s.ChargingMs,
+		"gainedMah":  s.EndChargeMah - s.StartChargeMah,
+	})
+}
+
+func (j *ChargeJournal) appendLocked(s ChargeSession) {
+	if s.Result == "" {
+		s.Result = chargeSessionResult(s)
+	}
+	j.sessions = append(j.sessions, s)
+	if over := len(j.sessions) - j.cfg.MaxSessions; over > 0 {
+		j.sessions = append([]ChargeSession(nil), j.sessions[over:]...)
+	}
+}
+
+// saveLocked rewrites the journal through a temporary file so a crash never
+// leaves it half written.
+func (j *ChargeJournal) saveLocked() {
+	j.lastSave = time.Now()
+	data, err := json.Marshal(chargeJournalFile{Sessions: j.sessions, Open: j.open})
+	if err != nil {
+		j.logger.Printf("charge journal encode failed: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(j.cfg.Path), 0o755); err != nil {
+		j.logger.Printf("charge journal save failed: %v", err)
+		return
+	}
+	tmp := j.cfg.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		j.logger.Printf("charge journal save failed: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, j.cfg.Path); err != nil {
+		j.logger.Printf("charge journal save failed: %v", err)
+	}
+}
+
+// chargeSessionResult summarises how a dock stay went: fault if the Roomba
+// reported a charging fault, full if it reached trickle charging, charged
+// if it charged at all and noCharge if it never started.
+func chargeSessionResult(s ChargeSession) string {
+	result := "noCharge"
+	for _, step := range s.States {
+		switch {
+		case step.State == chargingStateFault:
+			return "fault"
+		case step.State == 3:
+			result = "full"
+		case step.State >= 1 && step.State <= 2 && result == "noCharge":
+			result = "charged"
+		}
+	}
+	return result
+}
+
+func chargingStateName(state byte) string {
+	switch state {
+	case 0:
+		return "notCharging"
+	case 1:
+		return "reconditioning"
+	case 2:
+		return "fullCharging"
+	case 3:
+		return "trickle"
+	case 4:
+		return "waiting"
+	case 5:
+		return "fault"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,113 @@
+// Command framebench compares the JSON and binary sensor encodings: CPU time
+// and allocations per frame, and bytes on the wire including websocket
+// framing. Build it for the Pi with `make framebench` and run it on the
+// rover to get numbers for the real hardware.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"multiroombarover/pi/roverd"
+)
+
+func main() {
+	var (
+		frames  = flag.Int("frames", 200000, "Frames to encode per encoding")
+		payload = flag.Int("payload", 80, "Sensor payload bytes per frame (packet 100 is 80)")
+		rateHz  = flag.Int("rate", 20, "Stream rate used to project bytes and CPU per second")
+	)
+	flag.Parse()
+	if *frames <= 0 || *payload <= 0 || *payload > 250 || *rateHz <= 0 {
+		log.Fatalf("invalid flags: frames=%d payload=%d rate=%d", *frames, *payload, *rateHz)
+	}
+
+	frame := sampleFrame(*payload)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "encoding\tframe B\tmessage B\twire B\tns/frame\tcpu ns/frame\tallocs/frame\tB/s @%dHz\tcpu %% @%dHz\n", *rateHz, *rateHz)
+	for _, enc := range []string{roverd.SensorEncodingJSON, roverd.SensorEncodingBinary} {
+		r := run(enc, frame, *frames)
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.0f\t%.0f\t%.1f\t%d\t%.3f\n",
+			enc, len(frame), r.message, r.wire, r.wallNs, r.cpuNs, r.allocs,
+			r.wire**rateHz, r.cpuNs*float64(*rateHz)/1e7)
+	}
+	w.Flush()
+}
+
+type result struct {
+	message int
+	wire    int
+	wallNs  float64
+	cpuNs   float64
+	allocs  float64
+}
+
+func run(encoding string, frame []byte, n int) result {
+	data, _, err := roverd.EncodeSensorFrame(encoding, time.Now().UnixMilli(), 1, frame)
+	if err != nil {
+		log.Fatalf("%s: %v", encoding, err)
+	}
+	res := result{message: len(data), wire: len(data) + wsOverhead(len(data))}
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	cpuBefore := cpuTime()
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if _, _, err := roverd.EncodeSensorFrame(encoding, start.UnixMilli(), uint32(i), frame); err != nil {
+			log.Fatalf("%s: %v", encoding, err)
+		}
+	}
+	wall := time.Since(start)
+	cpu := cpuTime() - cpuBefore
+	runtime.ReadMemStats(&after)
+
+	res.wallNs = float64(wall.Nanoseconds()) / float64(n)
+	res.cpuNs = float64(cpu.Nanoseconds()) / float64(n)
+	res.allocs = float64(after.Mallocs-before.Mallocs) / float64(n)
+	return res
+}
+
+// sampleFrame builds a stream frame like the default packets (100, 21, 34)
+// produce: header, length, id/data pairs and checksum.
+func sampleFrame(payload int) []byte {
+	body := []byte{100}
+	for i := 0; i < payload; i++ {
+		body = append(body, byte(i*37))
+	}
+	body = append(body, 21, 2, 34, 2)
+	frame := append([]byte{19, byte(len(body))}, body...)
+	var sum byte
+	for _, b := range frame {
+		sum += b
+	}
+	return append(frame, -sum)
+}
+
+// wsOverhead is the websocket header a client adds to a message of n
+// bytes, including the 4-byte mask.
+func wsOverhead(n int) int {
+	switch {
+	case n < 126:
+		return 2 + 4
+	case n < 1<<16:
+		return 4 + 4
+	default:
+		return 10 + 4
+	}
+}
+
+func cpuTime() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	roverd "multiroombarover/pi/roverd"
+)
+
+func main() {
+	var (
+		link     = flag.String("link", "/tmp/roomba", "symlink to create for the simulated serial device (empty to skip)")
+		capacity = flag.Int("capacity", 2696, "simulated battery capacity in mAh")
+		charge   = flag.Int("charge", 0, "initial battery charge in mAh (0 = 75% of capacity)")
+		undocked = flag.Bool("undocked", false, "start away from the dock")
+	)
+	flag.Parse()
+
+	logger := log.New(os.Stdout, "oisim: ", log.LstdFlags|log.Lmicroseconds|log.LUTC)
+
+	pty, err := roverd.OpenPTY()
+	if err != nil {
+		logger.Fatalf("open pty: %v", err)
+	}
+	defer pty.Close()
+
+	device := pty.Path
+	if *link != "" {
+		_ = os.Remove(*link)
+		if err := os.Symlink(pty.Path, *link); err != nil {
+			logger.Fatalf("symlink %s: %v", *link, err)
+		}
+		defer os.Remove(*link)
+		device = *link
+	}
+	logger.Printf("simulated Roomba on %s (set serial.device to this path)", device)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	sim := roverd.NewOISimulator(roverd.OISimOptions{
+		CapacityMah: *capacity,
+		ChargeMah:   *charge,
+		Undocked:    *undocked,
+	}, logger)
+	if err := sim.Serve(ctx, pty.Master); err != nil && ctx.Err() == nil {
+		logger.Fatalf("simulator stopped: %v", err)
+	}
+}
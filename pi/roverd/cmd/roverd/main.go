@@ -6,8 +6,8 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
-	"time"
 
 	roverd "multiroombarover/pi/roverd"
 )
@@ -29,6 +29,11 @@ func main() {
 	defer cancel()
 
 	logger := log.New(os.Stdout, "roverd: ", log.LstdFlags|log.Lmicroseconds|log.LUTC)
+	for _, serverURL := range cfg.ServerURLs {
+		if cfg.Auth.Mode == "bearer" && strings.HasPrefix(serverURL, "ws://") {
+			logger.Printf("warning: bearer secret is sent unencrypted over %s; use wss:// or hmac", serverURL)
+		}
+	}
 
 	serialPort, err := roverd.OpenSerial(cfg.Serial)
 	if err != nil {
@@ -48,9 +53,18 @@ func main() {
 
 	sensorFrames := make(chan []byte, 8)
 	sensorSamples := make(chan roverd.SensorSample, 8)
-	eventStream := make(chan roverd.RoverEvent, 16)
+	eventStream := make(chan roverd.RoverEvent, 64)
+	eventJournal, err := roverd.NewEventJournal(cfg.EventJournal, logger)
+	if err != nil {
+		logger.Fatalf("event journal: %v", err)
+	}
+	go eventJournal.Run(ctx, eventStream)
 
-	streamer := roverd.NewSensorStreamer(serialPort, sensorFrames, sensorSamples, logger)
+	streamSettings, err := roverd.NewStreamSettings(cfg.SensorStream, cfg.StreamPacketsNeeded())
+	if err != nil {
+		logger.Fatalf("sensor stream: %v", err)
+	}
+	streamer := roverd.NewSensorStreamer(serialPort, streamSettings, sensorFrames, sensorSamples, logger)
 	go streamer.Run(ctx)
 
 	adapter := roverd.NewSerialAdapter(serialPort, logger)
@@ -78,25 +92,86 @@ func main() {
 		defer nightVision.Close()
 	}
 
-	autoCharge := roverd.NewAutoChargeController(adapter, eventStream, logger)
-	go autoCharge.Run(ctx, sensorSamples)
+	sampleBus := roverd.NewSampleBus()
 
-	client := roverd.NewWSClient(cfg, adapter, sensorFrames, eventStream, mediaSupervisor, cameraServo, nightVision, logger)
+	oiModes := roverd.NewOIModeTracker(cfg.Drive, adapter, streamSettings, eventStream, logger)
+	go oiModes.Run(ctx, sampleBus.Subscribe(8))
 
-	retryDelay := time.Second
-	for ctx.Err() == nil {
-		if err := client.Run(ctx); err != nil {
-			logger.Printf("websocket loop ended: %v", err)
-		}
+	odometry := roverd.NewOdometry(cfg.Odometry, eventStream, logger)
+	go odometry.Run(ctx, sampleBus.Subscribe(8))
+
+	battery := roverd.NewBatteryEstimator(cfg.Battery, eventStream, logger)
+	go battery.Run(ctx, sampleBus.Subscribe(8))
+
+	safety := roverd.NewSafetyInterlock(cfg.Safety, eventStream, logger)
+	go safety.Run(ctx, sampleBus.Subscribe(8))
 
-		select {
-		case <-ctx.Done():
-			return
-		case <-time.After(retryDelay):
+	shaper := roverd.NewDriveShaper(cfg.Drive, adapter, logger)
+	go shaper.Run(ctx)
+
+	deadman := roverd.NewDriveDeadman(cfg.Drive, adapter, shaper, oiModes, safety, eventStream, logger)
+	go deadman.Run(ctx)
+
+	autoCharge := roverd.NewAutoChargeController(cfg.AutoCharge, adapter, oiModes, deadman, eventStream, logger)
+	go autoCharge.Run(ctx, sampleBus.Subscribe(8))
+
+	var journal *roverd.ChargeJournal
+	if cfg.ChargeJournal.Enabled {
+		journal, err = roverd.NewChargeJournal(cfg.ChargeJournal, cfg.AutoCharge.DockDebounce.Duration, eventStream, logger)
+		if err != nil {
+			logger.Printf("charge journal disabled: %v", err)
+		} else {
+			go journal.Run(ctx, sampleBus.Subscribe(8))
 		}
+	}
 
-		if retryDelay < 30*time.Second {
-			retryDelay *= 2
+	if cfg.EStop.ButtonEnabled {
+		estopButton, err := roverd.NewEStopButton(cfg.EStop, deadman, logger)
+		if err != nil {
+			logger.Fatalf("init e-stop button: %v", err)
 		}
+		defer estopButton.Close()
+	}
+
+	motion := roverd.NewMotionController(cfg.Odometry, cfg.MaxWheelMMs, deadman, eventStream, logger)
+	go motion.Run(ctx, sampleBus.Subscribe(8))
+
+	stuck := roverd.NewStuckDetector(cfg.Stuck, deadman, motion, eventStream, logger)
+	go stuck.Run(ctx, sampleBus.Subscribe(8))
+
+	lowBattery := roverd.NewLowBatteryPolicy(cfg.LowBattery, cfg.Audio, adapter, deadman, oiModes, motion, battery, eventStream, logger)
+	go lowBattery.Run(ctx, sampleBus.Subscribe(8))
+
+	go sampleBus.Run(ctx, sensorSamples)
+
+	client := roverd.NewWSClient(cfg, roverd.WSClientDeps{
+		Adapter:      adapter,
+		Deadman:      deadman,
+		Modes:        oiModes,
+		Odometry:     odometry,
+		Battery:      battery,
+		Motion:       motion,
+		Stuck:        stuck,
+		LowBattery:   lowBattery,
+		AutoCharge:   autoCharge,
+		Journal:      journal,
+		Stream:       streamSettings,
+		Streamer:     streamer,
+		SensorFrames: sensorFrames,
+		Events:       eventStream,
+		EventJournal: eventJournal,
+		Media:        mediaSupervisor,
+		Servo:        cameraServo,
+		NightVision:  nightVision,
+	}, logger)
+	if cfg.LocalAPI.Enabled {
+		localAPI := roverd.NewLocalAPI(cfg.LocalAPI, client, logger)
+		go func() {
+			if err := localAPI.Run(ctx); err != nil {
+				logger.Printf("local API stopped: %v", err)
+			}
+		}()
 	}
+
+	client.Serve(ctx)
 }
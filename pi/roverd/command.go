@@ -3,20 +3,178 @@ package roverd
 type helloMessage struct {
 	Type          string            `json:"type"`
 	Name          string            `json:"name"`
+	Version       string            `json:"version"`
+	Protocol      protocolInfo      `json:"protocol"`
+	Capabilities  capabilitiesInfo  `json:"capabilities"`
+	Auth          *helloAuth        `json:"auth,omitempty"`
 	Battery       BatteryConfig     `json:"battery"`
 	MaxWheelSpeed int               `json:"maxWheelSpeed"`
 	Media         MediaConfig       `json:"media"`
 	CameraServo   CameraServoConfig `json:"cameraServo"`
 	Audio         AudioConfig       `json:"audio"`
 	NightVision   NightVisionConfig `json:"nightVision"`
+	Drive         driveInfo         `json:"drive"`
+	SensorStream  sensorStreamInfo  `json:"sensorStream"`
+	OI            oiInfo            `json:"oi"`
+	Safety        SafetyConfig      `json:"safety"`
+	EStop         estopInfo         `json:"estop"`
+	Stuck         stuckInfo         `json:"stuck"`
+	LowBattery    lowBatteryInfo    `json:"lowBattery"`
+	AutoCharge    autoChargeInfo    `json:"autoCharge"`
+	EventJournal  eventJournalInfo  `json:"eventJournal"`
+}
+
+// eventJournalInfo lets the server match its event cursor to the journal:
+// a different epoch means the sequence numbers started over.
+type eventJournalInfo struct {
+	Epoch   string `json:"epoch"`
+	Seq     uint64 `json:"seq"`
+	Acked   uint64 `json:"acked"`
+	Pending int    `json:"pending"`
+}
+
+type helloAuth struct {
+	Mode      string `json:"mode"`
+	Nonce     string `json:"nonce"`
+	Signature string `json:"signature"`
+}
+
+type authChallengeMessage struct {
+	Type  string `json:"type"`
+	Nonce string `json:"nonce"`
+}
+
+type protocolInfo struct {
+	Version          int `json:"version"`
+	MinServerVersion int `json:"minServerVersion"`
+}
+
+type capabilitiesInfo struct {
+	Commands        []string `json:"commands"`
+	Events          []string `json:"events"`
+	SensorEncodings []string `json:"sensorEncodings"`
+	TelemetryModes  []string `json:"telemetryModes"`
+}
+
+// serverHelloMessage is the server's answer to hello. Servers older than
+// protocol version 2 do not send one.
+type serverHelloMessage struct {
+	Type               string  `json:"type"`
+	ServerVersion      string  `json:"serverVersion"`
+	ProtocolVersion    int     `json:"protocolVersion"`
+	MinProtocolVersion int     `json:"minProtocolVersion"`
+	Accepted           bool    `json:"accepted"`
+	Reason             string  `json:"reason,omitempty"`
+	SensorEncoding     string  `json:"sensorEncoding,omitempty"`
+	Telemetry          string  `json:"telemetry,omitempty"`
+	EventSeq           *uint64 `json:"eventSeq,omitempty"`
+	EventEpoch         string  `json:"eventEpoch,omitempty"`
+}
+
+type autoChargeInfo struct {
+	Enabled    bool   `json:"enabled"`
+	State      string `json:"state"`
+	Retries    int    `json:"retries"`
+	MaxRetries int    `json:"maxRetries"`
+	TimeoutMs  int64  `json:"timeoutMs"`
+}
+
+type lowBatteryInfo struct {
+	Enabled     bool `json:"enabled"`
+	Active      bool `json:"active"`
+	DriveLocked bool `json:"driveLocked"`
+	Attempt     int  `json:"attempt,omitempty"`
+}
+
+type stuckInfo struct {
+	Enabled        bool `json:"enabled"`
+	Escape         bool `json:"escape"`
+	EscapeAttempts int  `json:"escapeAttempts"`
+	Escaping       bool `json:"escaping"`
+}
+
+type estopInfo struct {
+	Latched bool   `json:"latched"`
+	Source  string `json:"source,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	SinceMs int64  `json:"sinceMs,omitempty"`
+	Held    bool   `json:"held"`
+	Button  bool   `json:"button"`
+}
+
+type oiInfo struct {
+	Mode          string `json:"mode"`
+	DriveMode     string `json:"driveMode"`
+	PassiveOnDock bool   `json:"passiveOnDock"`
+}
+
+type sensorStreamInfo struct {
+	Packets    []int `json:"packets"`
+	IntervalMs int64 `json:"intervalMs"`
+}
+
+type driveInfo struct {
+	DeadmanTimeoutMs   int64 `json:"deadmanTimeoutMs"`
+	AccelMmS2          int   `json:"accelMmS2"`
+	DecelMmS2          int   `json:"decelMmS2"`
+	EmergencyDecelMmS2 int   `json:"emergencyDecelMmS2"`
+	ControlRateHz      int   `json:"controlRateHz"`
 }
 
 type sensorMessage struct {
 	Type      string `json:"type"`
 	Timestamp int64  `json:"ts"`
+	Seq       uint32 `json:"seq"`
 	Data      string `json:"data"`
 }
 
+type odometryMessage struct {
+	Type       string  `json:"type"`
+	Timestamp  int64   `json:"ts"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	HeadingDeg float64 `json:"headingDeg"`
+	DistanceMm float64 `json:"distanceMm"`
+}
+
+type batteryMessage struct {
+	Type           string  `json:"type"`
+	Timestamp      int64   `json:"ts"`
+	SoC            float64 `json:"soc"`
+	Source         string  `json:"source"`
+	ChargeMah      int     `json:"chargeMah"`
+	CapacityMah    int     `json:"capacityMah"`
+	VoltageMv      int     `json:"voltageMv"`
+	CurrentMa      int     `json:"currentMa"`
+	TemperatureC   int     `json:"temperatureC"`
+	ChargingState  byte    `json:"chargingState"`
+	Charging       bool    `json:"charging"`
+	DischargeMa    float64 `json:"dischargeMa"`
+	ChargeMa       float64 `json:"chargeMa"`
+	TimeToEmptySec *int64  `json:"timeToEmptySec,omitempty"`
+	TimeToFullSec  *int64  `json:"timeToFullSec,omitempty"`
+	Warn           bool    `json:"warn"`
+	Urgent         bool    `json:"urgent"`
+}
+
+type chargeHistoryMessage struct {
+	Type     string          `json:"type"`
+	ID       string          `json:"id"`
+	Sessions []ChargeSession `json:"sessions"`
+}
+
+type connectionStatusMessage struct {
+	Type   string           `json:"type"`
+	ID     string           `json:"id"`
+	Status connectionStatus `json:"status"`
+}
+
+type outboundStatsMessage struct {
+	Type    string                   `json:"type"`
+	ID      string                   `json:"id"`
+	Classes map[string]outboundStats `json:"classes"`
+}
+
 type inboundMessage struct {
 	Type         string               `json:"type"`
 	ID           string               `json:"id"`
@@ -29,11 +187,48 @@ type inboundMessage struct {
 	TTS          *ttsPayload          `json:"tts,omitempty"`
 	NightVision  *nightVisionPayload  `json:"nightVision,omitempty"`
 	Song         *songPayload         `json:"song,omitempty"`
+	OI           *oiCommand           `json:"oi,omitempty"`
+	Drive        *drivePayload        `json:"drive,omitempty"`
+	DrivePWM     *drivePWMPayload     `json:"drivePwm,omitempty"`
+	LEDs         *ledsPayload         `json:"leds,omitempty"`
+	ScheduleLEDs *scheduleLEDsPayload `json:"schedulingLeds,omitempty"`
+	DigitLEDs    *digitLEDsPayload    `json:"digitLeds,omitempty"`
+	Buttons      *buttonsPayload      `json:"buttons,omitempty"`
+	Query        *queryPayload        `json:"query,omitempty"`
+	Move         *movePayload         `json:"move,omitempty"`
+	Turn         *turnPayload         `json:"turn,omitempty"`
+	Reason       string               `json:"reason,omitempty"`
+	Limit        int                  `json:"limit,omitempty"`
+	Seq          uint64               `json:"seq,omitempty"`
+	Epoch        string               `json:"epoch,omitempty"`
+}
+
+type movePayload struct {
+	DistanceMm int `json:"distanceMm"`
+	Speed      int `json:"speed,omitempty"`
+}
+
+type turnPayload struct {
+	Degrees float64 `json:"degrees"`
+	Speed   int     `json:"speed,omitempty"`
 }
 
 type driveDirectPayload struct {
 	Left  int `json:"left"`
 	Right int `json:"right"`
+	TTLMs int `json:"ttlMs,omitempty"`
+}
+
+type drivePayload struct {
+	Velocity int `json:"velocity"`
+	Radius   int `json:"radius"`
+	TTLMs    int `json:"ttlMs,omitempty"`
+}
+
+type drivePWMPayload struct {
+	Left  int `json:"left"`
+	Right int `json:"right"`
+	TTLMs int `json:"ttlMs,omitempty"`
 }
 
 type motorPWMPayload struct {
@@ -43,13 +238,53 @@ type motorPWMPayload struct {
 }
 
 type sensorStreamPayload struct {
-	Enable bool `json:"enable"`
+	Enable     bool  `json:"enable"`
+	Packets    []int `json:"packets,omitempty"`
+	IntervalMs *int  `json:"intervalMs,omitempty"`
 }
 
 type mediaCommand struct {
 	Action string `json:"action"`
 }
 
+type oiCommand struct {
+	Action string `json:"action"`
+}
+
+type ledsPayload struct {
+	Debris     bool `json:"debris,omitempty"`
+	Spot       bool `json:"spot,omitempty"`
+	Dock       bool `json:"dock,omitempty"`
+	CheckRobot bool `json:"checkRobot,omitempty"`
+	Color      int  `json:"color"`
+	Intensity  int  `json:"intensity"`
+}
+
+type scheduleLEDsPayload struct {
+	Weekdays int `json:"weekdays"`
+	LEDs     int `json:"leds"`
+}
+
+type digitLEDsPayload struct {
+	Raw  []int  `json:"raw,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+type buttonsPayload struct {
+	Clean    bool `json:"clean,omitempty"`
+	Spot     bool `json:"spot,omitempty"`
+	Dock     bool `json:"dock,omitempty"`
+	Minute   bool `json:"minute,omitempty"`
+	Hour     bool `json:"hour,omitempty"`
+	Day      bool `json:"day,omitempty"`
+	Schedule bool `json:"schedule,omitempty"`
+	Clock    bool `json:"clock,omitempty"`
+}
+
+type queryPayload struct {
+	Packets []int `json:"packets"`
+}
+
 type servoPayload struct {
 	Angle   *float64 `json:"angle,omitempty"`
 	Nudge   *float64 `json:"nudge,omitempty"`
@@ -80,8 +315,17 @@ type songNote struct {
 }
 
 type ackMessage struct {
-	Type   string `json:"type"`
-	ID     string `json:"id"`
-	Status string `json:"status"`
-	Error  string `json:"error,omitempty"`
+	Type   string       `json:"type"`
+	ID     string       `json:"id"`
+	Status string       `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Query  *queryResult `json:"query,omitempty"`
+}
+
+// queryResult is what the Roomba answered to a query command: the reply
+// bytes in base64 and the packets decoded as in telemetry.
+type queryResult struct {
+	Packets []int            `json:"packets"`
+	Data    string           `json:"data"`
+	Sensors telemetryMessage `json:"sensors"`
 }
@@ -5,14 +5,16 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type SerialConfig struct {
-	Device string `yaml:"device"`
-	Baud   int    `yaml:"baud"`
+	Device   string `yaml:"device"`
+	Baud     int    `yaml:"baud"`
+	Simulate bool   `yaml:"simulate"`
 }
 
 type Duration struct {
@@ -103,17 +105,163 @@ type NightVisionConfig struct {
 	InitialOn bool   `yaml:"initialOn" json:"initialOn"`
 }
 
+type SensorStreamConfig struct {
+	Packets  []int    `yaml:"packets"`
+	Interval Duration `yaml:"interval"`
+}
+
+// DriveConfig shapes how drive commands reach the wheels. DeadmanTimeout,
+// 1s when unset, is the longest one command keeps them turning.
+type DriveConfig struct {
+	DeadmanTimeout     Duration `yaml:"deadmanTimeout"`
+	OIMode             string   `yaml:"oiMode"`
+	PassiveOnDock      bool     `yaml:"passiveOnDock"`
+	AccelMmS2          int      `yaml:"accelMmS2"`
+	DecelMmS2          int      `yaml:"decelMmS2"`
+	EmergencyDecelMmS2 int      `yaml:"emergencyDecelMmS2"`
+	ControlRateHz      int      `yaml:"controlRateHz"`
+}
+
+type SafetyConfig struct {
+	Enabled           bool `yaml:"enabled" json:"enabled"`
+	Bump              bool `yaml:"bump" json:"bump"`
+	Cliff             bool `yaml:"cliff" json:"cliff"`
+	WheelDrop         bool `yaml:"wheelDrop" json:"wheelDrop"`
+	Backoff           bool `yaml:"backoff" json:"backoff"`
+	BackoffDistanceMm int  `yaml:"backoffDistanceMm" json:"backoffDistanceMm"`
+	BackoffSpeed      int  `yaml:"backoffSpeed" json:"backoffSpeed"`
+}
+
+type AutoChargeConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Timeout      Duration `yaml:"timeout"`
+	MaxRetries   int      `yaml:"maxRetries"`
+	Backoff      Duration `yaml:"backoff"`
+	BackoffMax   Duration `yaml:"backoffMax"`
+	DockDebounce Duration `yaml:"dockDebounce"`
+}
+
+type ChargeJournalConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Path        string `yaml:"path"`
+	MaxSessions int    `yaml:"maxSessions"`
+}
+
+// EventJournalConfig bounds the unacknowledged events kept for replay. With
+// a Path they are also kept on disk across restarts.
+type EventJournalConfig struct {
+	MaxEvents int    `yaml:"maxEvents"`
+	Path      string `yaml:"path"`
+}
+
+type LowBatteryConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Announcement string   `yaml:"announcement"`
+	Song         bool     `yaml:"song"`
+	SeekTimeout  Duration `yaml:"seekTimeout"`
+	MaxAttempts  int      `yaml:"maxAttempts"`
+}
+
+type StuckConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Overcurrent    bool     `yaml:"overcurrent"`
+	WheelCurrentMa int      `yaml:"wheelCurrentMa"`
+	Stasis         bool     `yaml:"stasis"`
+	DetectAfter    Duration `yaml:"detectAfter"`
+	Escape         bool     `yaml:"escape"`
+	EscapeAttempts int      `yaml:"escapeAttempts"`
+	ReverseMm      int      `yaml:"reverseMm"`
+	RotateDeg      float64  `yaml:"rotateDeg"`
+	RetryMm        int      `yaml:"retryMm"`
+	EscapeSpeed    int      `yaml:"escapeSpeed"`
+}
+
+type EStopConfig struct {
+	ButtonEnabled bool     `yaml:"buttonEnabled"`
+	GPIOPin       int      `yaml:"gpioPin"`
+	GPIOChip      string   `yaml:"gpioChip"`
+	ActiveLow     bool     `yaml:"activeLow"`
+	Debounce      Duration `yaml:"debounce"`
+}
+
+type OdometryConfig struct {
+	WheelDiameterMm float64  `yaml:"wheelDiameterMm"`
+	WheelBaseMm     float64  `yaml:"wheelBaseMm"`
+	TicksPerRev     float64  `yaml:"ticksPerRev"`
+	Interval        Duration `yaml:"interval"`
+}
+
+// AuthConfig is the rover's secret and how it proves it: bearer sends it as
+// an Authorization header on the websocket handshake, hmac answers the
+// server's authChallenge with an HMAC-SHA256 of the nonce in hello.
+type AuthConfig struct {
+	Mode       string `yaml:"mode"`
+	Secret     string `yaml:"secret"`
+	SecretFile string `yaml:"secretFile"`
+}
+
+// TLSConfig applies to wss:// server URLs. ServerName pins the name the
+// server certificate must carry when it differs from the URL host.
+type TLSConfig struct {
+	CAFile     string `yaml:"caFile"`
+	CertFile   string `yaml:"certFile"`
+	KeyFile    string `yaml:"keyFile"`
+	ServerName string `yaml:"serverName"`
+}
+
+// ConnectionConfig tunes the websocket link to the server. A write that
+// takes longer than WriteTimeout drops the connection and reconnects.
+// Reconnects wait a jittered delay that doubles from BackoffMin up to
+// BackoffMax and starts over once a session has lasted HealthyAfter. The
+// server is pinged every HeartbeatInterval and the link is declared dead
+// after MissedHeartbeats pings in a row go unanswered.
+type ConnectionConfig struct {
+	WriteTimeout      Duration `yaml:"writeTimeout"`
+	BackoffMin        Duration `yaml:"backoffMin"`
+	BackoffMax        Duration `yaml:"backoffMax"`
+	HealthyAfter      Duration `yaml:"healthyAfter"`
+	HeartbeatInterval Duration `yaml:"heartbeatInterval"`
+	MissedHeartbeats  int      `yaml:"missedHeartbeats"`
+}
+
+// LocalAPIConfig is the HTTP and websocket API roverd serves on the LAN for
+// use without the central server. Every request must carry Token. Whoever
+// last drove the wheels, locally or through the server, keeps them until
+// ControlLease passes without a drive command.
+type LocalAPIConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Listen       string   `yaml:"listen"`
+	Token        string   `yaml:"token"`
+	TokenFile    string   `yaml:"tokenFile"`
+	ControlLease Duration `yaml:"controlLease"`
+}
+
 type Config struct {
-	Name        string            `yaml:"name"`
-	ServerURL   string            `yaml:"serverUrl"`
-	Serial      SerialConfig      `yaml:"serial"`
-	BRC         BRCConfig         `yaml:"brc"`
-	Battery     BatteryConfig     `yaml:"battery"`
-	MaxWheelMMs int               `yaml:"maxWheelSpeed"`
-	Media       MediaConfig       `yaml:"media"`
-	CameraServo CameraServoConfig `yaml:"cameraServo"`
-	Audio       AudioConfig       `yaml:"audio"`
-	NightVision NightVisionConfig `yaml:"nightVision" json:"nightVision"`
+	Name          string              `yaml:"name"`
+	ServerURL     string              `yaml:"serverUrl"`
+	ServerURLs    []string            `yaml:"serverUrls"`
+	Auth          AuthConfig          `yaml:"auth"`
+	TLS           TLSConfig           `yaml:"tls"`
+	Connection    ConnectionConfig    `yaml:"connection"`
+	Serial        SerialConfig        `yaml:"serial"`
+	BRC           BRCConfig           `yaml:"brc"`
+	Battery       BatteryConfig       `yaml:"battery"`
+	MaxWheelMMs   int                 `yaml:"maxWheelSpeed"`
+	Media         MediaConfig         `yaml:"media"`
+	CameraServo   CameraServoConfig   `yaml:"cameraServo"`
+	Audio         AudioConfig         `yaml:"audio"`
+	NightVision   NightVisionConfig   `yaml:"nightVision" json:"nightVision"`
+	Drive         DriveConfig         `yaml:"drive"`
+	SensorStream  SensorStreamConfig  `yaml:"sensorStream"`
+	Odometry      OdometryConfig      `yaml:"odometry"`
+	Safety        SafetyConfig        `yaml:"safety"`
+	EStop         EStopConfig         `yaml:"estop"`
+	Stuck         StuckConfig         `yaml:"stuck"`
+	LowBattery    LowBatteryConfig    `yaml:"lowBattery"`
+	AutoCharge    AutoChargeConfig    `yaml:"autoCharge"`
+	ChargeJournal ChargeJournalConfig `yaml:"chargeJournal"`
+	EventJournal  EventJournalConfig  `yaml:"eventJournal"`
+	LocalAPI      LocalAPIConfig      `yaml:"localApi"`
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -121,6 +269,9 @@ func LoadConfig(path string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Rover-side policies that act on their own (take the wheels, refuse
+	// commands, change the OI mode or write to disk) default to off, so an
+	// existing config keeps behaving as before until it opts in.
 	cfg := Config{
 		MaxWheelMMs: 500,
 		BRC: BRCConfig{
@@ -169,6 +320,76 @@ func LoadConfig(path string) (*Config, error) {
 			GPIOChip:  "gpiochip0",
 			InitialOn: true,
 		},
+		Drive: DriveConfig{
+			DeadmanTimeout: Duration{Duration: time.Second},
+			OIMode:         "safe",
+			ControlRateHz:  50,
+		},
+		SensorStream: SensorStreamConfig{
+			Packets:  []int{100, 21, 34},
+			Interval: Duration{Duration: 50 * time.Millisecond},
+		},
+		Odometry: OdometryConfig{
+			WheelDiameterMm: 72,
+			WheelBaseMm:     235,
+			TicksPerRev:     508.8,
+			Interval:        Duration{Duration: 200 * time.Millisecond},
+		},
+		Safety: SafetyConfig{
+			Bump:              true,
+			Cliff:             true,
+			WheelDrop:         true,
+			BackoffDistanceMm: 80,
+			BackoffSpeed:      150,
+		},
+		EStop: EStopConfig{
+			GPIOChip:  "gpiochip0",
+			ActiveLow: true,
+			Debounce:  Duration{Duration: 20 * time.Millisecond},
+		},
+		Stuck: StuckConfig{
+			Overcurrent:    true,
+			WheelCurrentMa: 1000,
+			Stasis:         true,
+			DetectAfter:    Duration{Duration: 1500 * time.Millisecond},
+			EscapeAttempts: 2,
+			ReverseMm:      100,
+			RotateDeg:      45,
+			RetryMm:        150,
+			EscapeSpeed:    150,
+		},
+		LowBattery: LowBatteryConfig{
+			Announcement: "Battery low. Returning to dock.",
+			Song:         true,
+			SeekTimeout:  Duration{Duration: 90 * time.Second},
+			MaxAttempts:  3,
+		},
+		AutoCharge: AutoChargeConfig{
+			Timeout:      Duration{Duration: 10 * time.Second},
+			MaxRetries:   3,
+			Backoff:      Duration{Duration: 30 * time.Second},
+			BackoffMax:   Duration{Duration: 5 * time.Minute},
+			DockDebounce: Duration{Duration: time.Second},
+		},
+		ChargeJournal: ChargeJournalConfig{
+			Path:        "/var/lib/roverd/charge-journal.json",
+			MaxSessions: 500,
+		},
+		EventJournal: EventJournalConfig{
+			MaxEvents: 1000,
+		},
+		LocalAPI: LocalAPIConfig{
+			Listen:       ":8088",
+			ControlLease: Duration{Duration: 3 * time.Second},
+		},
+		Connection: ConnectionConfig{
+			WriteTimeout:      Duration{Duration: 5 * time.Second},
+			BackoffMin:        Duration{Duration: time.Second},
+			BackoffMax:        Duration{Duration: 30 * time.Second},
+			HealthyAfter:      Duration{Duration: 30 * time.Second},
+			HeartbeatInterval: Duration{Duration: 5 * time.Second},
+			MissedHeartbeats:  3,
+		},
 	}
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, err
@@ -176,10 +397,17 @@ func LoadConfig(path string) (*Config, error) {
 	if cfg.Name == "" {
 		return nil, errors.New("missing name")
 	}
-	if cfg.ServerURL == "" {
-		return nil, errors.New("missing serverUrl")
+	if err := validateServerURLs(&cfg); err != nil {
+		return nil, err
+	}
+	if err := validateAuthConfig(&cfg.Auth); err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+	if err := validateTLSConfig(&cfg.TLS); err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
 	}
-	if cfg.Serial.Device == "" || cfg.Serial.Baud == 0 {
+	validateConnectionConfig(&cfg.Connection)
+	if !cfg.Serial.Simulate && (cfg.Serial.Device == "" || cfg.Serial.Baud == 0) {
 		return nil, errors.New("serial device/baud required")
 	}
 	if cfg.Battery.Full == 0 {
@@ -233,9 +461,112 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("nightVision: %w", err)
 	}
 	validateAudioConfig(&cfg.Audio)
+	if err := validateDriveConfig(&cfg.Drive); err != nil {
+		return nil, fmt.Errorf("drive: %w", err)
+	}
+	if err := validateSensorStreamConfig(&cfg.SensorStream); err != nil {
+		return nil, fmt.Errorf("sensorStream: %w", err)
+	}
+	if err := validateOdometryConfig(&cfg.Odometry); err != nil {
+		return nil, fmt.Errorf("odometry: %w", err)
+	}
+	validateSafetyConfig(&cfg.Safety, cfg.MaxWheelMMs)
+	if err := validateEStopConfig(&cfg.EStop); err != nil {
+		return nil, fmt.Errorf("estop: %w", err)
+	}
+	validateStuckConfig(&cfg.Stuck, cfg.MaxWheelMMs)
+	validateLowBatteryConfig(&cfg.LowBattery)
+	validateAutoChargeConfig(&cfg.AutoCharge)
+	if err := validateChargeJournalConfig(&cfg.ChargeJournal); err != nil {
+		return nil, fmt.Errorf("chargeJournal: %w", err)
+	}
+	validateEventJournalConfig(&cfg.EventJournal)
+	if err := validateLocalAPIConfig(&cfg.LocalAPI); err != nil {
+		return nil, fmt.Errorf("localApi: %w", err)
+	}
 	return &cfg, nil
 }
 
+func validateAuthConfig(cfg *AuthConfig) error {
+	if cfg.Mode == "" {
+		cfg.Mode = authNone
+	}
+	switch cfg.Mode {
+	case authNone:
+		return nil
+	case authBearer, authHMAC:
+	default:
+		return fmt.Errorf("unknown mode %q (want none, bearer or hmac)", cfg.Mode)
+	}
+	if cfg.SecretFile != "" {
+		data, err := os.ReadFile(cfg.SecretFile)
+		if err != nil {
+			return fmt.Errorf("secretFile: %w", err)
+		}
+		cfg.Secret = strings.TrimSpace(string(data))
+	}
+	if cfg.Secret == "" {
+		return fmt.Errorf("%s mode requires secret or secretFile", cfg.Mode)
+	}
+	return nil
+}
+
+func validateTLSConfig(cfg *TLSConfig) error {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return errors.New("certFile and keyFile must be set together")
+	}
+	return nil
+}
+
+// validateServerURLs makes ServerURLs the full failover order with
+// ServerURL, the primary, first. Either may be given alone.
+func validateServerURLs(cfg *Config) error {
+	if cfg.ServerURL == "" && len(cfg.ServerURLs) == 0 {
+		return errors.New("missing serverUrl")
+	}
+	urls := make([]string, 0, len(cfg.ServerURLs)+1)
+	seen := make(map[string]bool)
+	for _, raw := range append([]string{cfg.ServerURL}, cfg.ServerURLs...) {
+		raw = strings.TrimSpace(raw)
+		if raw == "" || seen[raw] {
+			continue
+		}
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("serverUrls: %w", err)
+		}
+		if parsed.Scheme != "ws" && parsed.Scheme != "wss" {
+			return fmt.Errorf("serverUrls: %s is not a ws:// or wss:// URL", raw)
+		}
+		seen[raw] = true
+		urls = append(urls, raw)
+	}
+	cfg.ServerURL = urls[0]
+	cfg.ServerURLs = urls
+	return nil
+}
+
+func validateConnectionConfig(cfg *ConnectionConfig) {
+	if cfg.WriteTimeout.Duration <= 0 {
+		cfg.WriteTimeout = Duration{Duration: 5 * time.Second}
+	}
+	if cfg.BackoffMin.Duration <= 0 {
+		cfg.BackoffMin = Duration{Duration: time.Second}
+	}
+	if cfg.BackoffMax.Duration < cfg.BackoffMin.Duration {
+		cfg.BackoffMax = Duration{Duration: max(30*time.Second, cfg.BackoffMin.Duration)}
+	}
+	if cfg.HealthyAfter.Duration <= 0 {
+		cfg.HealthyAfter = Duration{Duration: 30 * time.Second}
+	}
+	if cfg.HeartbeatInterval.Duration <= 0 {
+		cfg.HeartbeatInterval = Duration{Duration: 5 * time.Second}
+	}
+	if cfg.MissedHeartbeats <= 0 {
+		cfg.MissedHeartbeats = 3
+	}
+}
+
 func validateServoConfig(cfg *CameraServoConfig) error {
 	if !cfg.Enabled {
 		return nil
@@ -303,6 +634,220 @@ func validateAudioConfig(cfg *AudioConfig) {
 	}
 }
 
+func validateDriveConfig(cfg *DriveConfig) error {
+	if cfg.DeadmanTimeout.Duration <= 0 {
+		cfg.DeadmanTimeout = Duration{Duration: time.Second}
+	}
+	mode, err := parseDriveMode(cfg.OIMode)
+	if err != nil {
+		return err
+	}
+	cfg.OIMode = oiModeName(mode)
+	// Zero limits leave the wheels unramped. An emergency stop is never
+	// gentler than a normal one.
+	cfg.AccelMmS2 = max(cfg.AccelMmS2, 0)
+	cfg.DecelMmS2 = max(cfg.DecelMmS2, 0)
+	if cfg.DecelMmS2 == 0 || (cfg.EmergencyDecelMmS2 > 0 && cfg.EmergencyDecelMmS2 < cfg.DecelMmS2) {
+		cfg.EmergencyDecelMmS2 = cfg.DecelMmS2
+	}
+	cfg.EmergencyDecelMmS2 = max(cfg.EmergencyDecelMmS2, 0)
+	if cfg.ControlRateHz <= 0 {
+		cfg.ControlRateHz = 50
+	}
+	if cfg.ControlRateHz > 100 {
+		return fmt.Errorf("controlRateHz must be 1-100, got %d", cfg.ControlRateHz)
+	}
+	return nil
+}
+
+func validateSensorStreamConfig(cfg *SensorStreamConfig) error {
+	if len(cfg.Packets) == 0 {
+		cfg.Packets = []int{100, 21, 34}
+	}
+	if _, err := streamPacketList(cfg.Packets); err != nil {
+		return err
+	}
+	if cfg.Interval.Duration < 0 {
+		cfg.Interval = Duration{}
+	}
+	return nil
+}
+
+// StreamPacketsNeeded maps each sensor packet an enabled component reads to
+// that component, so the stream never drops what safety, odometry or the
+// battery policies rely on.
+func (c *Config) StreamPacketsNeeded() map[byte]string {
+	needed := make(map[byte]string)
+	need := func(component string, ids ...byte) {
+		for _, id := range ids {
+			if _, ok := needed[id]; !ok {
+				needed[id] = component
+			}
+		}
+	}
+	need("battery", 21, 22, 23, 24, 25, 26)
+	need("odometry", 43, 44)
+	if c.Safety.Enabled {
+		if c.Safety.Bump || c.Safety.WheelDrop {
+			need("safety", 7)
+		}
+		if c.Safety.Cliff {
+			need("safety", 9, 10, 11, 12)
+		}
+	}
+	if c.Stuck.Enabled {
+		if c.Stuck.Overcurrent {
+			need("stuck", 14)
+		}
+		if c.Stuck.WheelCurrentMa > 0 {
+			need("stuck", 54, 55)
+		}
+		if c.Stuck.Stasis {
+			need("stuck", 58)
+		}
+	}
+	if c.LowBattery.Enabled {
+		need("lowBattery", 34)
+	}
+	if c.AutoCharge.Enabled {
+		need("autoCharge", 34)
+	}
+	if c.ChargeJournal.Enabled {
+		need("chargeJournal", 34)
+	}
+	return needed
+}
+
+func validateOdometryConfig(cfg *OdometryConfig) error {
+	if cfg.WheelDiameterMm <= 0 || cfg.WheelBaseMm <= 0 || cfg.TicksPerRev <= 0 {
+		return errors.New("wheelDiameterMm, wheelBaseMm and ticksPerRev must be > 0")
+	}
+	if cfg.Interval.Duration <= 0 {
+		cfg.Interval = Duration{Duration: 200 * time.Millisecond}
+	}
+	return nil
+}
+
+func validateSafetyConfig(cfg *SafetyConfig, maxWheel int) {
+	if cfg.BackoffDistanceMm <= 0 {
+		cfg.BackoffDistanceMm = 80
+	}
+	if cfg.BackoffSpeed <= 0 {
+		cfg.BackoffSpeed = 150
+	}
+	cfg.BackoffSpeed = clampInt(cfg.BackoffSpeed, 1, maxWheel)
+}
+
+func validateChargeJournalConfig(cfg *ChargeJournalConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Path == "" {
+		return errors.New("path required")
+	}
+	if cfg.MaxSessions <= 0 {
+		cfg.MaxSessions = 500
+	}
+	return nil
+}
+
+func validateEventJournalConfig(cfg *EventJournalConfig) {
+	if cfg.MaxEvents <= 0 {
+		cfg.MaxEvents = 1000
+	}
+}
+
+func validateLocalAPIConfig(cfg *LocalAPIConfig) error {
+	if cfg.ControlLease.Duration <= 0 {
+		cfg.ControlLease = Duration{Duration: 3 * time.Second}
+	}
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = ":8088"
+	}
+	if cfg.TokenFile != "" {
+		data, err := os.ReadFile(cfg.TokenFile)
+		if err != nil {
+			return fmt.Errorf("tokenFile: %w", err)
+		}
+		cfg.Token = strings.TrimSpace(string(data))
+	}
+	if cfg.Token == "" {
+		return errors.New("token or tokenFile required")
+	}
+	return nil
+}
+
+func validateAutoChargeConfig(cfg *AutoChargeConfig) {
+	if cfg.Timeout.Duration <= 0 {
+		cfg.Timeout = Duration{Duration: 10 * time.Second}
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.Backoff.Duration <= 0 {
+		cfg.Backoff = Duration{Duration: 30 * time.Second}
+	}
+	if cfg.BackoffMax.Duration < cfg.Backoff.Duration {
+		cfg.BackoffMax = cfg.Backoff
+	}
+	if cfg.DockDebounce.Duration < 0 {
+		cfg.DockDebounce = Duration{}
+	}
+}
+
+func validateLowBatteryConfig(cfg *LowBatteryConfig) {
+	if cfg.SeekTimeout.Duration <= 0 {
+		cfg.SeekTimeout = Duration{Duration: 90 * time.Second}
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+}
+
+func validateStuckConfig(cfg *StuckConfig, maxWheel int) {
+	if cfg.DetectAfter.Duration <= 0 {
+		cfg.DetectAfter = Duration{Duration: 1500 * time.Millisecond}
+	}
+	if cfg.WheelCurrentMa < 0 {
+		cfg.WheelCurrentMa = 0
+	}
+	if cfg.EscapeAttempts <= 0 {
+		cfg.EscapeAttempts = 2
+	}
+	if cfg.ReverseMm <= 0 {
+		cfg.ReverseMm = 100
+	}
+	if cfg.RotateDeg <= 0 {
+		cfg.RotateDeg = 45
+	}
+	if cfg.RetryMm < 0 {
+		cfg.RetryMm = 0
+	}
+	if cfg.EscapeSpeed <= 0 {
+		cfg.EscapeSpeed = 150
+	}
+	cfg.EscapeSpeed = clampInt(cfg.EscapeSpeed, motionMinSpeed, maxWheel)
+}
+
+func validateEStopConfig(cfg *EStopConfig) error {
+	if !cfg.ButtonEnabled {
+		return nil
+	}
+	if cfg.GPIOPin <= 0 {
+		return errors.New("gpioPin must be > 0")
+	}
+	if cfg.GPIOChip == "" {
+		cfg.GPIOChip = "gpiochip0"
+	}
+	if cfg.Debounce.Duration < 0 {
+		cfg.Debounce = Duration{}
+	}
+	return nil
+}
+
 func validateNightVisionConfig(cfg *NightVisionConfig) error {
 	if !cfg.Enabled {
 		return nil
@@ -0,0 +1,191 @@
+package roverd
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Events for the server link as the connection manager sees it.
+const (
+	eventConnectionConnected    = "connection.connected"
+	eventConnectionDisconnected = "connection.disconnected"
+)
+
+// Connection states reported by connectionStatus.
+const (
+	connConnecting = "connecting"
+	connConnected  = "connected"
+	connBackoff    = "backoff"
+)
+
+// connectionStatus is what the connection manager is doing right now.
+type connectionStatus struct {
+	State          string                   `json:"state"`
+	ServerURL      string                   `json:"serverUrl"`
+	ServerIndex    int                      `json:"serverIndex"`
+	Servers        []string                 `json:"servers"`
+	ConnectedSince int64                    `json:"connectedSince,omitempty"`
+	Attempts       int                      `json:"attempts"`
+	Failures       int                      `json:"failures"`
+	Sessions       int                      `json:"sessions"`
+	LastError      string                   `json:"lastError,omitempty"`
+	RetryAt        int64                    `json:"retryAt,omitempty"`
+	Outbound       map[string]outboundStats `json:"outbound,omitempty"`
+	Link           *linkMessage             `json:"link,omitempty"`
+}
+
+// Serve keeps roverd connected until ctx ends. Servers are tried in the
+// configured order, moving to the next after each failure, with a jittered
+// delay that doubles every time the whole list has failed. A session that
+// lasted HealthyAfter resets the delay and sends the next attempt back to
+// the primary, so a rover that failed over returns once the primary is up.
+// Refused credentials wait the longest delay straight away.
+func (c *WSClient) Serve(ctx context.Context) {
+	servers := c.cfg.ServerURLs
+	backoff := c.cfg.Connection.BackoffMin.Duration
+	index := 0
+	// Speech runs whether or not a server is connected; the local API and
+	// rover-side policies use it too.
+	c.startTTSWorker(ctx)
+	for ctx.Err() == nil {
+		serverURL := servers[index]
+		c.setLinkState(func(st *connectionStatus) {
+			st.State = connConnecting
+			st.ServerURL = serverURL
+			st.ServerIndex = index
+			st.Attempts++
+			st.RetryAt = 0
+		})
+		started := time.Now()
+		err := c.Run(ctx, serverURL)
+		if ctx.Err() != nil {
+			return
+		}
+		session := time.Since(started)
+		healthy := c.wasConnected(started) && session >= c.cfg.Connection.HealthyAfter.Duration
+		index, backoff = c.cfg.Connection.retry(index, len(servers), backoff, healthy, errors.Is(err, errCredentialsRefused))
+		delay := jitter(backoff)
+		errText := "closed"
+		if err != nil {
+			errText = err.Error()
+		}
+		c.log.Printf("websocket to %s ended after %s: %s; retrying %s in %s",
+			serverURL, session.Round(time.Millisecond), errText, servers[index], delay.Round(time.Millisecond))
+		wasConnected := c.wasConnected(started)
+		c.setLinkState(func(st *connectionStatus) {
+			st.State = connBackoff
+			st.ConnectedSince = 0
+			st.LastError = errText
+			st.RetryAt = time.Now().Add(delay).UnixMilli()
+			if !wasConnected {
+				st.Failures++
+			}
+		})
+		if wasConnected {
+			c.emitEvent(eventConnectionDisconnected, map[string]any{
+				"serverUrl": serverURL,
+				"sessionMs": session.Milliseconds(),
+				"error":     errText,
+				"retryInMs": delay.Milliseconds(),
+				"nextUrl":   servers[index],
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retry picks the server and the delay before jitter for the attempt after
+// one on server index of n ended, given the delay used before it.
+func (cfg ConnectionConfig) retry(index, n int, backoff time.Duration, healthy, refused bool) (int, time.Duration) {
+	if healthy {
+		backoff = cfg.BackoffMin.Duration
+		index = 0
+	} else {
+		index = (index + 1) % n
+		if index == 0 {
+			backoff = min(backoff*2, cfg.BackoffMax.Duration)
+		}
+	}
+	if refused {
+		backoff = cfg.BackoffMax.Duration
+	}
+	return index, backoff
+}
+
+// jitter spreads a delay over [d/2, d) so rovers that lost the same server
+// do not all reconnect in the same instant.
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+// linkConnected records a successful hello on the current server.
+func (c *WSClient) linkConnected(out *outbound, monitor *linkMonitor) {
+	var st connectionStatus
+	c.setLinkState(func(link *connectionStatus) {
+		link.State = connConnected
+		link.ConnectedSince = time.Now().UnixMilli()
+		link.Sessions++
+		link.LastError = ""
+		st = *link
+		link.Failures = 0
+	})
+	c.linkMu.Lock()
+	c.linkOut = out
+	c.linkMonitor = monitor
+	c.linkMu.Unlock()
+	c.log.Printf("connected to %s (server %d of %d)", st.ServerURL, st.ServerIndex+1, len(c.cfg.ServerURLs))
+	c.emitEvent(eventConnectionConnected, map[string]any{
+		"serverUrl":   st.ServerURL,
+		"serverIndex": st.ServerIndex,
+		"failover":    st.ServerIndex > 0,
+		"failures":    st.Failures,
+	})
+}
+
+// wasConnected reports whether the attempt started at since got as far as
+// hello.
+func (c *WSClient) wasConnected(since time.Time) bool {
+	c.linkMu.Lock()
+	defer c.linkMu.Unlock()
+	return c.link.ConnectedSince >= since.UnixMilli()
+}
+
+func (c *WSClient) setLinkState(update func(*connectionStatus)) {
+	c.linkMu.Lock()
+	update(&c.link)
+	if c.link.State != connConnected {
+		c.linkOut = nil
+		c.linkMonitor = nil
+	}
+	c.linkMu.Unlock()
+}
+
+// connectionStatus returns the manager's state with the outbound queue
+// counters and link telemetry of the current connection.
+func (c *WSClient) connectionStatus() connectionStatus {
+	c.linkMu.Lock()
+	st := c.link
+	out := c.linkOut
+	monitor := c.linkMonitor
+	c.linkMu.Unlock()
+	st.Servers = c.cfg.ServerURLs
+	if out != nil {
+		st.Outbound = out.Stats()
+	}
+	if monitor != nil {
+		link := monitor.message(time.Now())
+		st.Link = &link
+	}
+	return st
+}
@@ -0,0 +1,76 @@
+package roverd
+
+import (
+	"testing"
+	"time"
+)
+
+var testConnection = ConnectionConfig{
+	BackoffMin: Duration{Duration: time.Second},
+	BackoffMax: Duration{Duration: 8 * time.Second},
+}
+
+func TestRetryRotatesServers(t *testing.T) {
+	index, backoff := 0, time.Second
+	// Failures walk the list in order and double the delay each time it
+	// wraps back to the primary.
+	for _, want := range []struct {
+		index   int
+		backoff time.Duration
+	}{
+		{1, time.Second},
+		{2, time.Second},
+		{0, 2 * time.Second},
+		{1, 2 * time.Second},
+	} {
+		index, backoff = testConnection.retry(index, 3, backoff, false, false)
+		if index != want.index || backoff != want.backoff {
+			t.Fatalf("after a failure: server %d, backoff %s; want %d, %s", index, backoff, want.index, want.backoff)
+		}
+	}
+
+	// A healthy session on a standby goes back to the primary without delay.
+	index, backoff = testConnection.retry(index, 3, backoff, true, false)
+	if index != 0 || backoff != time.Second {
+		t.Fatalf("after a healthy session: server %d, backoff %s; want 0, 1s", index, backoff)
+	}
+
+	// A single server is retried each time.
+	if index, _ := testConnection.retry(0, 1, time.Second, false, false); index != 0 {
+		t.Fatalf("single server: next %d, want 0", index)
+	}
+}
+
+func TestRetryBackoffBounds(t *testing.T) {
+	backoff := testConnection.BackoffMin.Duration
+	for range 10 {
+		_, backoff = testConnection.retry(0, 1, backoff, false, false)
+		if backoff > testConnection.BackoffMax.Duration {
+			t.Fatalf("backoff %s above the %s maximum", backoff, testConnection.BackoffMax.Duration)
+		}
+	}
+	if backoff != testConnection.BackoffMax.Duration {
+		t.Fatalf("backoff %s after repeated failures, want the %s maximum", backoff, testConnection.BackoffMax.Duration)
+	}
+
+	// Refused credentials wait the longest straight away, healthy or not.
+	for _, healthy := range []bool{false, true} {
+		if _, backoff := testConnection.retry(0, 2, time.Second, healthy, true); backoff != testConnection.BackoffMax.Duration {
+			t.Fatalf("refused (healthy %v): backoff %s, want %s", healthy, backoff, testConnection.BackoffMax.Duration)
+		}
+	}
+}
+
+func TestJitterBounds(t *testing.T) {
+	for _, d := range []time.Duration{time.Second, 30 * time.Second, time.Nanosecond, 0} {
+		for range 100 {
+			got := jitter(d)
+			if d > 1 && (got < d/2 || got >= d) {
+				t.Fatalf("jitter(%s) = %s, want within [%s, %s)", d, got, d/2, d)
+			}
+			if d <= 1 && got != d {
+				t.Fatalf("jitter(%s) = %s, want it unchanged", d, got)
+			}
+		}
+	}
+}
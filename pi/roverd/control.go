@@ -0,0 +1,116 @@
+package roverd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Events for changes of the controller holding the wheels.
+const (
+	eventControlClaimed  = "control.claimed"
+	eventControlReleased = "control.released"
+)
+
+// controllerUpstream is the central server; local API clients are named
+// "local:" plus their host.
+const controllerUpstream = "upstream"
+
+var errControlHeld = errors.New("wheels held by another controller")
+
+type controllerKey struct{}
+
+// withController tags ctx with the controller a command came from, so
+// dispatch can arbitrate the wheels without a parameter on every handler.
+func withController(ctx context.Context, controller string) context.Context {
+	return context.WithValue(ctx, controllerKey{}, controller)
+}
+
+func controllerFrom(ctx context.Context) string {
+	if controller, ok := ctx.Value(controllerKey{}).(string); ok {
+		return controller
+	}
+	return controllerUpstream
+}
+
+// controlArbiter lets one controller drive at a time. A controller takes the
+// wheels by moving them while nobody else holds them, including through raw
+// opcodes, buttons and the Roomba's own clean, spot and dock behaviours, and
+// keeps them as long as it sends drive commands at least every lease. While
+// it holds them every other actuator command from others is refused too:
+// cleaning motors, OI modes, lights, songs, speech, the camera servo and
+// night vision. Stop commands from others are refused rather than obeyed so
+// an idle browser cannot fight a local driver. Only estop and estop.clear,
+// sensorStream, query and media stay shared; an estop is always accepted
+// from anyone.
+type controlArbiter struct {
+	lease  time.Duration
+	events chan<- RoverEvent
+
+	mu     sync.Mutex
+	holder string
+	until  time.Time
+}
+
+type controlStatus struct {
+	Holder    string `json:"holder,omitempty"`
+	ExpiresAt int64  `json:"expiresAt,omitempty"`
+	LeaseMs   int64  `json:"leaseMs"`
+}
+
+func newControlArbiter(lease time.Duration, events chan<- RoverEvent) *controlArbiter {
+	return &controlArbiter{lease: lease, events: events}
+}
+
+// claim checks that controller may send an actuator command and, if it moves
+// the wheels, gives or extends its lease.
+func (a *controlArbiter) claim(controller string, moving bool) error {
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expireLocked(now)
+	if a.holder != "" && a.holder != controller {
+		return fmt.Errorf("%w: %s", errControlHeld, a.holder)
+	}
+	if a.holder == "" && !moving {
+		return nil
+	}
+	if a.holder == "" {
+		a.holder = controller
+		emitRoverEvent(a.events, eventControlClaimed, map[string]any{"controller": controller})
+	}
+	a.until = now.Add(a.lease)
+	return nil
+}
+
+// release gives the wheels up early, for a controller that disconnects or
+// asks to hand over.
+func (a *controlArbiter) release(controller, reason string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.holder != controller {
+		return
+	}
+	a.holder = ""
+	emitRoverEvent(a.events, eventControlReleased, map[string]any{"controller": controller, "reason": reason})
+}
+
+func (a *controlArbiter) expireLocked(now time.Time) {
+	if a.holder != "" && now.After(a.until) {
+		emitRoverEvent(a.events, eventControlReleased, map[string]any{"controller": a.holder, "reason": "idle"})
+		a.holder = ""
+	}
+}
+
+func (a *controlArbiter) status() controlStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expireLocked(time.Now())
+	st := controlStatus{Holder: a.holder, LeaseMs: a.lease.Milliseconds()}
+	if a.holder != "" {
+		st.ExpiresAt = a.until.UnixMilli()
+	}
+	return st
+}
@@ -0,0 +1,344 @@
+package roverd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Events for stops the deadman makes on its own.
+const (
+	eventDriveDeadman      = "drive.deadman"
+	eventSafetyBackoffDone = "safety.backoffDone"
+	eventSafetyStop        = "safety.stop"
+)
+
+// errNotDriveMode is returned by steer when the Roomba has left Safe or
+// Full mode, for example after a wheel drop put it in Passive.
+var errNotDriveMode = errors.New("oi not in drive mode")
+
+// DriveDeadman forwards wheel commands to the Roomba and stops the wheels
+// when no fresh drive command arrives before the previous one's TTL expires.
+type DriveDeadman struct {
+	adapter *SerialAdapter
+	shaper  *DriveShaper
+	modes   *OIModeTracker
+	safety  *SafetyInterlock
+	events  chan<- RoverEvent
+	logger  *log.Logger
+	timeout time.Duration
+	kick    chan struct{}
+
+	mu       sync.Mutex
+	deadline time.Time
+	ttl      time.Duration
+	last     map[string]any
+	wheels   [2]int
+	estop    estopState
+	onEStop  []func()
+}
+
+func NewDriveDeadman(cfg DriveConfig, adapter *SerialAdapter, shaper *DriveShaper, modes *OIModeTracker, safety *SafetyInterlock, events chan<- RoverEvent, logger *log.Logger) *DriveDeadman {
+	return &DriveDeadman{
+		adapter: adapter,
+		shaper:  shaper,
+		modes:   modes,
+		safety:  safety,
+		events:  events,
+		logger:  logger,
+		timeout: cfg.DeadmanTimeout.Duration,
+		kick:    make(chan struct{}, 1),
+	}
+}
+
+// Commanded returns the wheel speeds of the last command that is still in
+// effect (mm/s, or PWM for Drive PWM); both are zero once the wheels were
+// stopped.
+func (d *DriveDeadman) Commanded() (left, right int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.wheels[0], d.wheels[1]
+}
+
+// Timeout is the longest a single drive command keeps the wheels turning.
+func (d *DriveDeadman) Timeout() time.Duration {
+	return d.timeout
+}
+
+// DriveDirect sends the wheel velocities and arms the deadman. A ttl of zero
+// or one longer than the configured timeout falls back to the timeout; a
+// zero velocity disarms it. Commands are checked against the safety
+// interlock, and moving ones first restore Safe or Full mode if the Roomba
+// was left in Passive.
+func (d *DriveDeadman) DriveDirect(left, right int, ttl time.Duration) error {
+	return d.send(ttl, left, right, map[string]any{
+		"command": "driveDirect",
+		"left":    left,
+		"right":   right,
+	}, func() error {
+		return d.shaper.Set(left, right)
+	})
+}
+
+// PrepareDrive restores Safe or Full mode ahead of drive commands sent with
+// steer. The switch pauses for the Roomba to settle, so callers run it
+// before taking their own locks rather than leaving it to the drive.
+func (d *DriveDeadman) PrepareDrive() error {
+	if err := d.CheckEStop(); err != nil {
+		return err
+	}
+	if d.modes == nil {
+		return nil
+	}
+	return d.modes.EnsureDriveMode()
+}
+
+// steer is DriveDirect for a caller that holds its own lock. It never
+// switches the OI mode and fails with errNotDriveMode instead, so the
+// caller stops rather than sleeping inside its critical section.
+func (d *DriveDeadman) steer(left, right int, ttl time.Duration) error {
+	if d.modes != nil && (left != 0 || right != 0) {
+		if mode, ok := d.modes.Mode(); ok && !isDriveMode(mode) {
+			return fmt.Errorf("%w: %s", errNotDriveMode, oiModeName(mode))
+		}
+	}
+	return d.sendMode(false, ttl, left, right, map[string]any{
+		"command": "driveDirect",
+		"left":    left,
+		"right":   right,
+	}, func() error {
+		return d.shaper.Set(left, right)
+	})
+}
+
+func (d *DriveDeadman) Drive(velocity, radius int, ttl time.Duration) error {
+	left, right := driveWheelSpeeds(velocity, radius, nominalWheelBaseMm)
+	return d.send(ttl, int(left), int(right), map[string]any{
+		"command":  "drive",
+		"velocity": velocity,
+		"radius":   radius,
+	}, func() error {
+		d.shaper.Release()
+		return d.adapter.Drive(velocity, radius)
+	})
+}
+
+func (d *DriveDeadman) DrivePWM(left, right int, ttl time.Duration) error {
+	return d.send(ttl, left, right, map[string]any{
+		"command": "drivePwm",
+		"left":    left,
+		"right":   right,
+	}, func() error {
+		d.shaper.Release()
+		return d.adapter.DrivePWM(left, right)
+	})
+}
+
+// RawDrive sends a raw Drive, Drive Direct or Drive PWM opcode. It passes
+// the emergency stop and safety interlock and takes the wheels back from the
+// shaper. Raw commands carry no TTL, so a moving one is armed with the
+// configured timeout and has to be repeated like any other drive command.
+func (d *DriveDeadman) RawDrive(buf []byte) error {
+	left, right, ok := rawDriveWheels(buf, nominalWheelBaseMm)
+	if ok && d.safety != nil {
+		if err := d.safety.Check(left, right); err != nil {
+			return err
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.estop.latched && (!ok || left != 0 || right != 0) {
+		return errEStopLatched
+	}
+	d.shaper.Release()
+	if err := d.adapter.SendRaw(buf); err != nil {
+		return err
+	}
+	if left != 0 || right != 0 {
+		d.deadline = time.Now().Add(d.timeout)
+	} else {
+		d.deadline = time.Time{}
+	}
+	d.ttl = d.timeout
+	d.last = map[string]any{"command": "raw", "opcode": int(buf[0])}
+	d.wheels = [2]int{left, right}
+
+	select {
+	case d.kick <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (d *DriveDeadman) send(ttl time.Duration, left, right int, last map[string]any, write func() error) error {
+	return d.sendMode(true, ttl, left, right, last, write)
+}
+
+// sendMode checks and writes one drive command and arms the deadman for it.
+// ensureMode restores the drive mode first for a moving command.
+func (d *DriveDeadman) sendMode(ensureMode bool, ttl time.Duration, left, right int, last map[string]any, write func() error) error {
+	if ttl <= 0 || ttl > d.timeout {
+		ttl = d.timeout
+	}
+	moving := left != 0 || right != 0
+	if moving {
+		if err := d.CheckEStop(); err != nil {
+			return err
+		}
+	}
+	if d.safety != nil {
+		if err := d.safety.Check(left, right); err != nil {
+			return err
+		}
+	}
+	if moving && ensureMode && d.modes != nil {
+		if err := d.modes.EnsureDriveMode(); err != nil {
+			return err
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Re-check under the lock so a stop latched while the mode was being
+	// restored is not overtaken by this command.
+	if moving && d.estop.latched {
+		return errEStopLatched
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	if moving {
+		d.deadline = time.Now().Add(ttl)
+	} else {
+		d.deadline = time.Time{}
+	}
+	d.ttl = ttl
+	d.last = last
+	d.wheels = [2]int{left, right}
+
+	select {
+	case d.kick <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (d *DriveDeadman) Run(ctx context.Context) {
+	timer := time.NewTimer(d.timeout)
+	defer timer.Stop()
+
+	var trips <-chan safetyTrip
+	if d.safety != nil {
+		trips = d.safety.tripCh
+	}
+
+	rearm := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		d.mu.Lock()
+		deadline := d.deadline
+		d.mu.Unlock()
+		if !deadline.IsZero() {
+			timer.Reset(time.Until(deadline))
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.kick:
+			rearm()
+		case trip := <-trips:
+			d.safetyStop(trip)
+			rearm()
+		case <-timer.C:
+			d.expire()
+			rearm()
+		}
+	}
+}
+
+func (d *DriveDeadman) expire() {
+	d.mu.Lock()
+	if d.deadline.IsZero() || time.Now().Before(d.deadline) {
+		d.mu.Unlock()
+		return
+	}
+	ttl, last := d.ttl, d.last
+	d.deadline = time.Time{}
+	d.last = nil
+	d.wheels = [2]int{}
+	err := d.shaper.Stop(true)
+	d.mu.Unlock()
+	if d.safety != nil {
+		d.safety.stopped()
+	}
+
+	if last["command"] == "safety.backoff" {
+		data := map[string]any{"durationMs": ttl.Milliseconds()}
+		if err != nil {
+			data["error"] = err.Error()
+		}
+		emitRoverEvent(d.events, eventSafetyBackoffDone, data)
+		return
+	}
+
+	data := map[string]any{
+		"ttlMs": ttl.Milliseconds(),
+		"last":  last,
+	}
+	if err != nil {
+		d.logger.Printf("deadman stop failed: %v", err)
+		data["error"] = err.Error()
+	} else {
+		d.logger.Printf("deadman stopped wheels after %s without drive command", ttl)
+	}
+	emitRoverEvent(d.events, eventDriveDeadman, data)
+}
+
+// safetyStop halts the wheels for the interlock and, if requested, reverses
+// for the back-off period. The back-off is armed like any other command, so
+// the regular expiry stops it.
+func (d *DriveDeadman) safetyStop(trip safetyTrip) {
+	d.mu.Lock()
+	if d.wheels == [2]int{} {
+		// Already stopped by a later command or the deadman itself. The
+		// wheels rather than the deadline are checked so a raw drive, which
+		// may carry no deadline, is stopped too.
+		d.mu.Unlock()
+		return
+	}
+	err := d.shaper.Stop(true)
+	d.deadline = time.Time{}
+	d.last = nil
+	d.wheels = [2]int{}
+	backoff := err == nil && trip.backoffPeriod > 0
+	if backoff {
+		if err = d.shaper.Set(-trip.backoffSpeed, -trip.backoffSpeed); err == nil {
+			d.deadline = time.Now().Add(trip.backoffPeriod)
+			d.ttl = trip.backoffPeriod
+			d.last = map[string]any{"command": "safety.backoff"}
+			d.wheels = [2]int{-trip.backoffSpeed, -trip.backoffSpeed}
+			d.safety.holdUntil(d.deadline)
+		}
+	}
+	d.mu.Unlock()
+
+	data := map[string]any{"reason": trip.reason, "backoff": backoff}
+	if backoff {
+		data["backoffMs"] = trip.backoffPeriod.Milliseconds()
+	}
+	if err != nil {
+		d.logger.Printf("safety stop failed: %v", err)
+		data["error"] = err.Error()
+	}
+	emitRoverEvent(d.events, eventSafetyStop, data)
+}
@@ -0,0 +1,120 @@
+package roverd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const testDeadmanTimeout = "drive:\n  deadmanTimeout: 200ms\n"
+
+// awaitDeadman waits for the deadman to report a stop and returns when it
+// came, or fails the test after within.
+func awaitDeadman(t *testing.T, c *WSClient, within time.Duration) (RoverEvent, time.Time) {
+	t.Helper()
+	deadline := time.After(within)
+	for {
+		select {
+		case evt := <-c.events:
+			if evt.Event == eventDriveDeadman {
+				return evt, time.Now()
+			}
+		case <-deadline:
+			t.Fatalf("deadman did not stop the wheels within %s", within)
+		}
+	}
+}
+
+// noDeadman fails the test if the deadman reports a stop within d.
+func noDeadman(t *testing.T, c *WSClient, d time.Duration) {
+	t.Helper()
+	deadline := time.After(d)
+	for {
+		select {
+		case evt := <-c.events:
+			if evt.Event == eventDriveDeadman {
+				t.Fatalf("deadman stopped the wheels: %+v", evt.Data)
+			}
+		case <-deadline:
+			return
+		}
+	}
+}
+
+func TestDeadmanExpiresAfterTTL(t *testing.T) {
+	c, port := newTestClient(t, testDeadmanTimeout)
+	start := time.Now()
+	if err := c.deadman.DriveDirect(100, 100, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	evt, stopped := awaitDeadman(t, c, time.Second)
+	if elapsed := stopped.Sub(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("stopped after %s, before the 50ms ttl", elapsed)
+	}
+	if evt.Data["ttlMs"] != int64(50) {
+		t.Fatalf("deadman event %+v, want ttlMs 50", evt.Data)
+	}
+	if left, right := c.deadman.Commanded(); left != 0 || right != 0 {
+		t.Fatalf("Commanded after expiry = %d, %d", left, right)
+	}
+	written := port.commands()
+	if last := written[len(written)-1]; string(last) != string([]byte{145, 0, 0, 0, 0}) {
+		t.Fatalf("last command % x, want a Drive Direct stop", last)
+	}
+}
+
+func TestDeadmanZeroCommandDisarms(t *testing.T) {
+	c, _ := newTestClient(t, testDeadmanTimeout)
+	if err := c.deadman.DriveDirect(100, 100, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.deadman.DriveDirect(0, 0, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	c.deadman.mu.Lock()
+	armed := !c.deadman.deadline.IsZero()
+	c.deadman.mu.Unlock()
+	if armed {
+		t.Fatal("a zero command left the deadman armed")
+	}
+	noDeadman(t, c, 300*time.Millisecond)
+}
+
+func TestDeadmanClampsTTLToTimeout(t *testing.T) {
+	c, _ := newTestClient(t, testDeadmanTimeout)
+	start := time.Now()
+	if err := c.deadman.DriveDirect(100, 100, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	evt, stopped := awaitDeadman(t, c, 2*time.Second)
+	if evt.Data["ttlMs"] != int64(200) {
+		t.Fatalf("deadman event %+v, want the ttl clamped to 200ms", evt.Data)
+	}
+	if elapsed := stopped.Sub(start); elapsed > time.Second {
+		t.Fatalf("stopped after %s, want about 200ms", elapsed)
+	}
+}
+
+func TestDeadmanArmsRawDrives(t *testing.T) {
+	c, port := newTestClient(t, testDeadmanTimeout)
+	if err := c.dispatch(context.Background(), rawMessage(145, 0, 100, 0, 100)); err != nil {
+		t.Fatal(err)
+	}
+	evt, _ := awaitDeadman(t, c, time.Second)
+	if last, _ := evt.Data["last"].(map[string]any); last["command"] != "raw" {
+		t.Fatalf("deadman event %+v, want the raw drive as last", evt.Data)
+	}
+	written := port.commands()
+	if last := written[len(written)-1]; string(last) != string([]byte{145, 0, 0, 0, 0}) {
+		t.Fatalf("last command % x, want a Drive Direct stop", last)
+	}
+
+	// A raw stop disarms it again.
+	if err := c.dispatch(context.Background(), rawMessage(145, 0, 100, 0, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.dispatch(context.Background(), rawMessage(137, 0, 0, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	noDeadman(t, c, 300*time.Millisecond)
+}
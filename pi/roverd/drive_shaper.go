@@ -0,0 +1,151 @@
+package roverd
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// DriveShaper slews DriveDirect wheel speeds towards their targets at the
+// configured acceleration limits so the Roomba does not wheelie or shake
+// the camera mast. It writes to the serial port at a fixed control rate. A
+// zero limit lets that change happen in one step.
+type DriveShaper struct {
+	adapter   *SerialAdapter
+	logger    *log.Logger
+	accel     float64
+	decel     float64
+	emergency float64
+	period    time.Duration
+
+	mu          sync.Mutex
+	active      bool
+	target      [2]float64
+	current     [2]float64
+	emergencyOn bool
+	lastTick    time.Time
+	lastErr     time.Time
+}
+
+func NewDriveShaper(cfg DriveConfig, adapter *SerialAdapter, logger *log.Logger) *DriveShaper {
+	return &DriveShaper{
+		adapter:   adapter,
+		logger:    logger,
+		accel:     float64(cfg.AccelMmS2),
+		decel:     float64(cfg.DecelMmS2),
+		emergency: float64(cfg.EmergencyDecelMmS2),
+		period:    time.Second / time.Duration(cfg.ControlRateHz),
+	}
+}
+
+// Set makes left/right the new wheel targets and sends the first step
+// immediately, returning its write error.
+func (s *DriveShaper) Set(left, right int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.active {
+		// Another drive opcode may have moved the wheels; assume they are
+		// stopped rather than ramping from a stale speed.
+		s.current = [2]float64{}
+		s.lastTick = time.Now()
+	}
+	s.active = true
+	s.target = [2]float64{float64(left), float64(right)}
+	return s.stepLocked(time.Now())
+}
+
+// Stop ramps both wheels to zero, using the emergency deceleration when
+// emergency is set.
+func (s *DriveShaper) Stop(emergency bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.active {
+		return s.adapter.DriveDirect(0, 0)
+	}
+	s.target = [2]float64{}
+	if emergency {
+		s.emergencyOn = true
+	}
+	return s.stepLocked(time.Now())
+}
+
+// Release hands the wheels to a command the shaper does not manage, such as
+// Drive or Drive PWM, so it stops writing DriveDirect.
+func (s *DriveShaper) Release() {
+	s.mu.Lock()
+	s.active = false
+	s.emergencyOn = false
+	s.target, s.current = [2]float64{}, [2]float64{}
+	s.mu.Unlock()
+}
+
+func (s *DriveShaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			if s.active && s.current != s.target {
+				if err := s.stepLocked(now); err != nil && now.Sub(s.lastErr) > time.Second {
+					s.lastErr = now
+					s.logger.Printf("shaped drive write failed: %v", err)
+				}
+			} else {
+				s.lastTick = now
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// stepLocked advances both wheels towards the target by one control period
+// and writes the result. Both wheels are scaled by the same fraction so the
+// commanded curvature is kept while ramping.
+func (s *DriveShaper) stepLocked(now time.Time) error {
+	dt := now.Sub(s.lastTick).Seconds()
+	s.lastTick = now
+	if dt <= 0 || dt > s.period.Seconds()*2 {
+		dt = s.period.Seconds()
+	}
+
+	var goal, next [2]float64
+	fraction := 1.0
+	for i := range s.current {
+		cur, tgt := s.current[i], s.target[i]
+		goal[i] = tgt
+		if cur == tgt {
+			continue
+		}
+		limit := s.accel
+		if cur != 0 && (math.Signbit(cur) != math.Signbit(tgt) || math.Abs(tgt) < math.Abs(cur)) {
+			limit = s.decel
+			if s.emergencyOn {
+				limit = s.emergency
+			}
+			// Stop at zero before reversing so the direction change
+			// uses the acceleration limit on the other side.
+			if limit > 0 && tgt != 0 && math.Signbit(cur) != math.Signbit(tgt) {
+				goal[i] = 0
+			}
+		}
+		if limit <= 0 {
+			continue
+		}
+		if need := math.Abs(goal[i]-cur) / (limit * dt); need > 1 {
+			fraction = math.Min(fraction, 1/need)
+		}
+	}
+	for i := range s.current {
+		next[i] = s.current[i] + (goal[i]-s.current[i])*fraction
+	}
+	if next == [2]float64{} {
+		s.emergencyOn = false
+	}
+	s.current = next
+	return s.adapter.DriveDirect(int(math.Round(next[0])), int(math.Round(next[1])))
+}
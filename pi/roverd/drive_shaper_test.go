@@ -0,0 +1,86 @@
+package roverd
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+type discardPort struct{}
+
+func (discardPort) Read([]byte) (int, error)    { return 0, io.EOF }
+func (discardPort) Write(p []byte) (int, error) { return len(p), nil }
+func (discardPort) Close() error                { return nil }
+
+// newTestShaper runs at 50 Hz, so each step is 20 ms of the limits.
+func newTestShaper(accel, decel, emergency int) *DriveShaper {
+	cfg := DriveConfig{AccelMmS2: accel, DecelMmS2: decel, EmergencyDecelMmS2: emergency, ControlRateHz: 50}
+	return NewDriveShaper(cfg, NewSerialAdapter(discardPort{}, log.New(io.Discard, "", 0)), log.New(io.Discard, "", 0))
+}
+
+// ramp starts s from current towards target and returns the speeds of the
+// next steps control periods apart.
+func ramp(s *DriveShaper, current, target [2]float64, steps int) [][2]float64 {
+	now := time.Unix(1000, 0)
+	s.active = true
+	s.current, s.target, s.lastTick = current, target, now
+	var out [][2]float64
+	for range steps {
+		now = now.Add(s.period)
+		s.stepLocked(now)
+		out = append(out, s.current)
+	}
+	return out
+}
+
+func TestShaperRamps(t *testing.T) {
+	tests := []struct {
+		name            string
+		accel, decel    int
+		emergency       bool
+		current, target [2]float64
+		want            [][2]float64
+	}{
+		{"accelerates 20 mm/s per step", 1000, 1500, false,
+			[2]float64{}, [2]float64{50, 50}, [][2]float64{{20, 20}, {40, 40}, {50, 50}, {50, 50}}},
+		{"keeps the curvature", 1000, 1500, false,
+			[2]float64{}, [2]float64{200, 100}, [][2]float64{{20, 10}, {40, 20}}},
+		{"decelerates 30 mm/s per step", 1000, 1500, false,
+			[2]float64{100, 100}, [2]float64{}, [][2]float64{{70, 70}, {40, 40}, {10, 10}, {0, 0}}},
+		{"stops at zero before reversing", 1000, 1500, false,
+			[2]float64{20, 20}, [2]float64{-100, -100}, [][2]float64{{0, 0}, {-20, -20}, {-40, -40}}},
+		{"emergency stop uses its own limit", 1000, 1500, true,
+			[2]float64{250, 250}, [2]float64{}, [][2]float64{{150, 150}, {50, 50}, {0, 0}}},
+		{"zero limits jump to the target", 0, 0, false,
+			[2]float64{}, [2]float64{300, -300}, [][2]float64{{300, -300}}},
+		{"zero limits reverse directly", 0, 0, false,
+			[2]float64{300, 300}, [2]float64{-300, -300}, [][2]float64{{-300, -300}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShaper(tt.accel, tt.decel, 5000)
+			s.emergencyOn = tt.emergency
+			got := ramp(s, tt.current, tt.target, len(tt.want))
+			for i := range tt.want {
+				for w := range 2 {
+					if diff := got[i][w] - tt.want[i][w]; diff > 1e-9 || diff < -1e-9 {
+						t.Fatalf("steps = %v, want %v", got, tt.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestShaperClampsLongGaps(t *testing.T) {
+	s := newTestShaper(1000, 1500, 5000)
+	now := time.Unix(1000, 0)
+	s.active = true
+	s.target, s.lastTick = [2]float64{500, 500}, now
+	// A late tick must not turn a stalled control loop into one big jump.
+	s.stepLocked(now.Add(time.Second))
+	if s.current != [2]float64{20, 20} {
+		t.Fatalf("after a 1 s gap current = %v, want one 20 ms step", s.current)
+	}
+}
@@ -0,0 +1,162 @@
+package roverd
+
+import (
+	"errors"
+	"time"
+)
+
+// Emergency stop latch events.
+const (
+	eventEStopCleared   = "estop.cleared"
+	eventEStopTriggered = "estop.triggered"
+)
+
+var errEStopLatched = errors.New("emergency stop latched; send estop.clear to resume")
+
+// estopState is the latched emergency stop. held is set while a physical
+// e-stop button is still pressed, which keeps estop.clear from releasing it.
+type estopState struct {
+	latched bool
+	held    bool
+	source  string
+	reason  string
+	since   time.Time
+}
+
+// EmergencyStop puts the Roomba in Safe mode, zeroes the wheels and
+// cleaning motors without ramping and latches: every motion command is
+// rejected until ClearEmergencyStop. Safe comes first because the OI ignores
+// drive and motor commands in Passive, which is where Seek Dock, Clean, Spot
+// and Max leave it. Moves, stuck escapes and the low-battery return are
+// cancelled whether the stop came from a command or the button.
+func (d *DriveDeadman) EmergencyStop(source, reason string) error {
+	d.mu.Lock()
+	wasLatched := d.estop.latched
+	if !wasLatched {
+		d.estop.latched = true
+		d.estop.source = source
+		d.estop.reason = reason
+		d.estop.since = time.Now()
+	}
+	d.shaper.Release()
+	err := d.adapter.SafeMode()
+	if driveErr := d.adapter.DriveDirect(0, 0); err == nil {
+		err = driveErr
+	}
+	if motorErr := d.adapter.MotorPWM(0, 0, 0); err == nil {
+		err = motorErr
+	}
+	d.deadline = time.Time{}
+	d.last = nil
+	d.wheels = [2]int{}
+	hooks := d.onEStop
+	d.mu.Unlock()
+	if d.modes != nil {
+		d.modes.Commanded(oiModeSafe, "estop")
+	}
+	if d.safety != nil {
+		d.safety.stopped()
+	}
+	for _, cancel := range hooks {
+		cancel()
+	}
+	select {
+	case d.kick <- struct{}{}:
+	default:
+	}
+
+	if !wasLatched {
+		d.logger.Printf("emergency stop latched by %s: %s", source, reason)
+		data := map[string]any{"source": source, "reason": reason}
+		if err != nil {
+			data["error"] = err.Error()
+		}
+		emitRoverEvent(d.events, eventEStopTriggered, data)
+	}
+	return err
+}
+
+// onEmergencyStop registers cancel to run every time EmergencyStop is
+// called, after the wheels are stopped. Components that drive the rover on
+// their own register while they are constructed.
+func (d *DriveDeadman) onEmergencyStop(cancel func()) {
+	d.mu.Lock()
+	d.onEStop = append(d.onEStop, cancel)
+	d.mu.Unlock()
+}
+
+// ClearEmergencyStop releases the latch unless the e-stop button is still
+// held down.
+func (d *DriveDeadman) ClearEmergencyStop(source string) error {
+	d.mu.Lock()
+	if d.estop.held {
+		d.mu.Unlock()
+		return errors.New("e-stop button is still pressed")
+	}
+	if !d.estop.latched {
+		d.mu.Unlock()
+		return nil
+	}
+	latchedFor := time.Since(d.estop.since)
+	d.estop = estopState{}
+	d.mu.Unlock()
+
+	d.logger.Printf("emergency stop cleared by %s after %s", source, latchedFor.Round(time.Second))
+	emitRoverEvent(d.events, eventEStopCleared, map[string]any{
+		"source":    source,
+		"latchedMs": latchedFor.Milliseconds(),
+	})
+	return nil
+}
+
+// CheckEStop returns errEStopLatched while the emergency stop is latched.
+// Callers that move the rover without going through the deadman use it.
+func (d *DriveDeadman) CheckEStop() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.estop.latched {
+		return errEStopLatched
+	}
+	return nil
+}
+
+// sendUnlessLatched writes an actuator command that is not a drive, such as
+// the cleaning motors or the Roomba's own behaviours. A moving one is
+// checked against the emergency stop under the lock EmergencyStop holds,
+// so it cannot slip in after the stop.
+func (d *DriveDeadman) sendUnlessLatched(moving bool, write func() error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if moving && d.estop.latched {
+		return errEStopLatched
+	}
+	return write()
+}
+
+// setEStopHeld follows the e-stop button: pressing it latches the stop and
+// releasing it only allows estop.clear to succeed.
+func (d *DriveDeadman) setEStopHeld(held bool) {
+	d.mu.Lock()
+	d.estop.held = held
+	d.mu.Unlock()
+	if held {
+		if err := d.EmergencyStop("button", "e-stop button pressed"); err != nil {
+			d.logger.Printf("e-stop button stop failed: %v", err)
+		}
+	}
+}
+
+func (d *DriveDeadman) estopInfo() estopInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	info := estopInfo{
+		Latched: d.estop.latched,
+		Source:  d.estop.source,
+		Reason:  d.estop.reason,
+		Held:    d.estop.held,
+	}
+	if d.estop.latched {
+		info.SinceMs = d.estop.since.UnixMilli()
+	}
+	return info
+}
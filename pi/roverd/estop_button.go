@@ -0,0 +1,68 @@
+//go:build !dummy
+
+package roverd
+
+import (
+	"fmt"
+	"log"
+
+	gpiocdev "github.com/warthog618/go-gpiocdev"
+)
+
+// EStopButton latches the emergency stop when a push-button on a GPIO line
+// becomes active and keeps it from being cleared while it stays pressed.
+type EStopButton struct {
+	line    *gpiocdev.Line
+	deadman *DriveDeadman
+	logger  *log.Logger
+}
+
+func NewEStopButton(cfg EStopConfig, deadman *DriveDeadman, logger *log.Logger) (*EStopButton, error) {
+	chip := cfg.GPIOChip
+	if chip == "" {
+		chip = "gpiochip0"
+	}
+	b := &EStopButton{deadman: deadman, logger: logger}
+	opts := []gpiocdev.LineReqOption{
+		gpiocdev.AsInput,
+		gpiocdev.WithBothEdges,
+		gpiocdev.WithDebounce(cfg.Debounce.Duration),
+		gpiocdev.WithEventHandler(b.handleEvent),
+		gpiocdev.WithConsumer("roverd-estop"),
+	}
+	if cfg.ActiveLow {
+		opts = append(opts, gpiocdev.AsActiveLow, gpiocdev.WithPullUp)
+	}
+	line, err := gpiocdev.RequestLine(chip, cfg.GPIOPin, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("gpio request: %w", err)
+	}
+	b.line = line
+
+	value, err := line.Value()
+	if err != nil {
+		line.Close()
+		return nil, fmt.Errorf("gpio read: %w", err)
+	}
+	if value == 1 {
+		deadman.setEStopHeld(true)
+	}
+	logger.Printf("e-stop button on GPIO %d (activeLow=%v pressed=%v)", cfg.GPIOPin, cfg.ActiveLow, value == 1)
+	return b, nil
+}
+
+func (b *EStopButton) Close() {
+	if b.line != nil {
+		b.line.Close()
+	}
+}
+
+func (b *EStopButton) handleEvent(evt gpiocdev.LineEvent) {
+	switch evt.Type {
+	case gpiocdev.LineEventRisingEdge:
+		b.deadman.setEStopHeld(true)
+	case gpiocdev.LineEventFallingEdge:
+		b.logger.Printf("e-stop button released; latch stays until estop.clear")
+		b.deadman.setEStopHeld(false)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build dummy
+
+package roverd
+
+import (
+	"fmt"
+	"log"
+)
+
+type EStopButton struct{}
+
+func NewEStopButton(cfg EStopConfig, deadman *DriveDeadman, logger *log.Logger) (*EStopButton, error) {
+	return nil, fmt.Errorf("e-stop button not supported in dummy build")
+}
+
+func (b *EStopButton) Close() {}
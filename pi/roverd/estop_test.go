@@ -0,0 +1,72 @@
+package roverd
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// estopCommands move the wheels or the motors in every way a client can.
+var estopCommands = []struct {
+	name string
+	msg  *inboundMessage
+}{
+	{"driveDirect", &inboundMessage{Type: "driveDirect", DriveDirect: &driveDirectPayload{Left: 100, Right: 100}}},
+	{"drive", &inboundMessage{Type: "drive", Drive: &drivePayload{Velocity: 100, Radius: driveRadiusStraight}}},
+	{"raw drive", rawMessage(137, 0, 100, 0x80, 0)},
+	{"raw drive direct", rawMessage(145, 0, 100, 0, 100)},
+	{"raw clean", rawMessage(135)},
+	{"raw motors", rawMessage(138, 1)},
+	{"raw motor pwm", rawMessage(144, 50, 0, 0)},
+	{"motorPwm", &inboundMessage{Type: "motorPwm", MotorPWM: &motorPWMPayload{Main: 50}}},
+	{"oi clean", &inboundMessage{Type: "oi", OI: &oiCommand{Action: "clean"}}},
+}
+
+func TestLatchedEStopBlocksMotion(t *testing.T) {
+	c, port := newTestClient(t, "")
+	ctx := context.Background()
+	if err := c.dispatch(ctx, &inboundMessage{Type: "estop", Reason: "test"}); err != nil {
+		t.Fatalf("estop: %v", err)
+	}
+	port.commands()
+
+	for _, tt := range estopCommands {
+		if err := c.dispatch(ctx, tt.msg); !errors.Is(err, errEStopLatched) {
+			t.Errorf("%s while latched = %v, want errEStopLatched", tt.name, err)
+		}
+	}
+	if written := port.commands(); len(written) != 0 {
+		t.Fatalf("latched e-stop let through % x", written)
+	}
+
+	// Stopping is always allowed.
+	for _, msg := range []*inboundMessage{
+		{Type: "driveDirect", DriveDirect: &driveDirectPayload{}},
+		rawMessage(137, 0, 0, 0, 0),
+		{Type: "motorPwm", MotorPWM: &motorPWMPayload{}},
+	} {
+		if err := c.dispatch(ctx, msg); err != nil {
+			t.Errorf("stop %+v while latched: %v", msg, err)
+		}
+	}
+}
+
+func TestClearedEStopRestoresMotion(t *testing.T) {
+	c, port := newTestClient(t, "")
+	ctx := context.Background()
+	if err := c.dispatch(ctx, &inboundMessage{Type: "estop", Reason: "test"}); err != nil {
+		t.Fatalf("estop: %v", err)
+	}
+	if err := c.dispatch(ctx, &inboundMessage{Type: "estop.clear"}); err != nil {
+		t.Fatalf("estop.clear: %v", err)
+	}
+	port.commands()
+	for _, tt := range estopCommands {
+		if err := c.dispatch(ctx, tt.msg); err != nil {
+			t.Errorf("%s after clear: %v", tt.name, err)
+		}
+	}
+	if written := port.commands(); len(written) < len(estopCommands) {
+		t.Fatalf("only %d commands written after clear: % x", len(written), written)
+	}
+}
@@ -0,0 +1,338 @@
+package roverd
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// eventEventsDropped marks a gap where the journal overflowed.
+const eventEventsDropped = "events.dropped"
+
+// droppedEvents counts events emitRoverEvent could not queue because the
+// intake channel was full. The journal reports them as events.dropped.
+var droppedEvents atomic.Uint64
+
+// eventJournalLine is one line of the on-disk journal: the epoch header, an
+// event or an acknowledgement.
+type eventJournalLine struct {
+	Epoch string      `json:"epoch,omitempty"`
+	Ack   uint64      `json:"ack,omitempty"`
+	Event *RoverEvent `json:"event,omitempty"`
+}
+
+// EventJournal numbers every rover event and keeps the ones the server has
+// not acknowledged yet, up to MaxEvents, so they can be replayed after a
+// reconnect. With a Path it appends to a JSON lines file and survives
+// restarts; without one it only bridges connection drops.
+//
+// Sequence numbers only grow within an epoch. A journal that starts without
+// its file gets a new epoch, which tells the server to reset its cursor.
+//
+// Lines are encoded under mu but written under fileMu, so readers of the
+// pending events never wait on the disk.
+type EventJournal struct {
+	cfg    EventJournalConfig
+	logger *log.Logger
+	notify chan struct{}
+
+	mu        sync.Mutex
+	epoch     string
+	seq       uint64
+	acked     uint64
+	pending   []RoverEvent
+	unwritten []byte
+	newLines  int
+
+	fileMu sync.Mutex
+	file   *os.File
+	lines  int
+}
+
+func NewEventJournal(cfg EventJournalConfig, logger *log.Logger) (*EventJournal, error) {
+	j := &EventJournal{
+		cfg:    cfg,
+		logger: logger,
+		notify: make(chan struct{}, 1),
+	}
+	if cfg.Path != "" {
+		if err := j.load(); err != nil {
+			return nil, err
+		}
+	}
+	if j.epoch == "" {
+		j.epoch = newEventEpoch()
+	}
+	if cfg.Path != "" {
+		if err := j.compact(j.snapshotLocked()); err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// Run moves events from the intake channel into the journal until ctx ends.
+func (j *EventJournal) Run(ctx context.Context, in <-chan RoverEvent) {
+	defer j.close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt := <-in:
+			if n := droppedEvents.Swap(0); n > 0 {
+				j.Append(RoverEvent{Type: "event", Event: eventEventsDropped, Ts: evt.Ts,
+					Data: map[string]any{"count": n, "reason": "intake full"}})
+			}
+			j.Append(evt)
+		}
+	}
+}
+
+// Append assigns the next sequence number and keeps the event until it is
+// acknowledged. When the journal is full the oldest event is dropped.
+func (j *EventJournal) Append(evt RoverEvent) {
+	j.mu.Lock()
+	j.seq++
+	evt.Seq = j.seq
+	j.pending = append(j.pending, evt)
+	overflow := len(j.pending) - j.cfg.MaxEvents
+	if overflow > 0 {
+		j.pending = append([]RoverEvent(nil), j.pending[overflow:]...)
+	}
+	j.encodeLocked(eventJournalLine{Event: &evt})
+	j.mu.Unlock()
+	j.flush()
+	if overflow > 0 {
+		j.logger.Printf("event journal full, dropped %d unacknowledged events", overflow)
+	}
+	select {
+	case j.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Ack forgets every event up to and including seq. An ack for another
+// epoch counts sequence numbers this journal never issued and is ignored.
+func (j *EventJournal) Ack(epoch string, seq uint64) {
+	j.mu.Lock()
+	if epoch != j.epoch || seq <= j.acked {
+		j.mu.Unlock()
+		return
+	}
+	if seq > j.seq {
+		seq = j.seq
+	}
+	j.acked = seq
+	drop := 0
+	for drop < len(j.pending) && j.pending[drop].Seq <= seq {
+		drop++
+	}
+	j.pending = append([]RoverEvent(nil), j.pending[drop:]...)
+	j.encodeLocked(eventJournalLine{Ack: seq})
+	j.mu.Unlock()
+	j.flush()
+}
+
+// After returns the kept events with a sequence number above seq, oldest
+// first.
+func (j *EventJournal) After(seq uint64) []RoverEvent {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i, evt := range j.pending {
+		if evt.Seq > seq {
+			return append([]RoverEvent(nil), j.pending[i:]...)
+		}
+	}
+	return nil
+}
+
+// Notify is signalled after every Append.
+func (j *EventJournal) Notify() <-chan struct{} {
+	return j.notify
+}
+
+// Acked is the highest sequence number the server has acknowledged.
+func (j *EventJournal) Acked() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.acked
+}
+
+func (j *EventJournal) eventJournalInfo() eventJournalInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return eventJournalInfo{
+		Epoch:   j.epoch,
+		Seq:     j.seq,
+		Acked:   j.acked,
+		Pending: len(j.pending),
+	}
+}
+
+func (j *EventJournal) load() error {
+	f, err := os.Open(j.cfg.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var line eventJournalLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			// A torn last line from a crash; everything before it is good.
+			j.logger.Printf("event journal: skipping bad line: %v", err)
+			continue
+		}
+		switch {
+		case line.Epoch != "":
+			j.epoch = line.Epoch
+		case line.Event != nil:
+			if line.Event.Seq > j.seq {
+				j.seq = line.Event.Seq
+			}
+			j.pending = append(j.pending, *line.Event)
+		case line.Ack > j.acked:
+			j.acked = line.Ack
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	kept := j.pending[:0]
+	for _, evt := range j.pending {
+		if evt.Seq > j.acked {
+			kept = append(kept, evt)
+		}
+	}
+	if over := len(kept) - j.cfg.MaxEvents; over > 0 {
+		kept = kept[over:]
+	}
+	j.pending = append([]RoverEvent(nil), kept...)
+	if j.seq < j.acked {
+		j.seq = j.acked
+	}
+	return nil
+}
+
+// encodeLocked queues a line for the next flush.
+func (j *EventJournal) encodeLocked(line eventJournalLine) {
+	if j.cfg.Path == "" {
+		return
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		j.logger.Printf("event journal encode failed: %v", err)
+		return
+	}
+	j.unwritten = append(append(j.unwritten, data...), '\n')
+	j.newLines++
+}
+
+// snapshotLocked is the epoch, the last ack and the pending events, the
+// lines a compacted file holds.
+func (j *EventJournal) snapshotLocked() []eventJournalLine {
+	lines := []eventJournalLine{{Epoch: j.epoch}}
+	if j.acked > 0 {
+		lines = append(lines, eventJournalLine{Ack: j.acked})
+	}
+	for i := range j.pending {
+		evt := j.pending[i]
+		lines = append(lines, eventJournalLine{Event: &evt})
+	}
+	return lines
+}
+
+// flush appends the queued lines to the file, or rewrites it instead once
+// acknowledged lines would make up most of it.
+func (j *EventJournal) flush() {
+	j.fileMu.Lock()
+	defer j.fileMu.Unlock()
+	j.mu.Lock()
+	data, n := j.unwritten, j.newLines
+	j.unwritten, j.newLines = nil, 0
+	var snapshot []eventJournalLine
+	if j.file != nil && j.lines+n > 2*j.cfg.MaxEvents+64 {
+		snapshot = j.snapshotLocked()
+	}
+	j.mu.Unlock()
+	if j.file == nil || n == 0 {
+		return
+	}
+	if snapshot != nil {
+		if err := j.compact(snapshot); err != nil {
+			j.logger.Printf("event journal compaction failed: %v", err)
+		}
+		return
+	}
+	if _, err := j.file.Write(data); err != nil {
+		j.logger.Printf("event journal write failed: %v", err)
+		return
+	}
+	j.lines += n
+}
+
+// compact rewrites the file as lines, through a temporary file so a crash
+// never leaves it half written. The caller holds fileMu or has not shared
+// the journal yet.
+func (j *EventJournal) compact(lines []eventJournalLine) error {
+	if err := os.MkdirAll(filepath.Dir(j.cfg.Path), 0o755); err != nil {
+		return err
+	}
+	tmp := j.cfg.Path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.cfg.Path); err != nil {
+		return err
+	}
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, err = os.OpenFile(j.cfg.Path, os.O_APPEND|os.O_WRONLY, 0o640)
+	j.lines = len(lines)
+	return err
+}
+
+func (j *EventJournal) close() {
+	j.fileMu.Lock()
+	defer j.fileMu.Unlock()
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+}
+
+func newEventEpoch() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
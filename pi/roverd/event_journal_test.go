@@ -0,0 +1,143 @@
+package roverd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestEventJournal(t *testing.T, path string, maxEvents int) *EventJournal {
+	t.Helper()
+	j, err := NewEventJournal(EventJournalConfig{MaxEvents: maxEvents, Path: path}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(j.close)
+	return j
+}
+
+func appendEvents(j *EventJournal, names ...string) {
+	for _, name := range names {
+		j.Append(RoverEvent{Type: "event", Event: name})
+	}
+}
+
+func eventSeqs(events []RoverEvent) []uint64 {
+	seqs := make([]uint64, len(events))
+	for i, evt := range events {
+		seqs[i] = evt.Seq
+	}
+	return seqs
+}
+
+func TestEventJournalSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	j := newTestEventJournal(t, path, 100)
+	appendEvents(j, "a", "b", "c")
+	epoch := j.eventJournalInfo().Epoch
+	j.Ack(epoch, 1)
+	j.close()
+
+	j = newTestEventJournal(t, path, 100)
+	info := j.eventJournalInfo()
+	if info.Epoch != epoch || info.Seq != 3 || info.Acked != 1 || info.Pending != 2 {
+		t.Fatalf("reloaded %+v, want epoch %s, seq 3, acked 1, 2 pending", info, epoch)
+	}
+	pending := j.After(0)
+	if len(pending) != 2 || pending[0].Event != "b" || pending[1].Event != "c" {
+		t.Fatalf("reloaded pending %+v", pending)
+	}
+	appendEvents(j, "d")
+	if got := j.eventJournalInfo().Seq; got != 4 {
+		t.Fatalf("seq after restart = %d, want 4", got)
+	}
+}
+
+func TestEventJournalCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	j := newTestEventJournal(t, path, 4)
+	epoch := j.eventJournalInfo().Epoch
+	for i := range 200 {
+		appendEvents(j, "tick")
+		if i%2 == 1 {
+			j.Ack(epoch, uint64(i))
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > 2*4+64 {
+		t.Fatalf("journal file has %d lines, compaction keeps it to %d", lines, 2*4+64)
+	}
+	j.close()
+
+	j = newTestEventJournal(t, path, 4)
+	if got := eventSeqs(j.After(0)); len(got) != 1 || got[0] != 200 {
+		t.Fatalf("pending after compaction = %v, want [200]", got)
+	}
+}
+
+func TestEventJournalReportsDroppedEvents(t *testing.T) {
+	j := newTestEventJournal(t, "", 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan RoverEvent)
+	go j.Run(ctx, in)
+
+	droppedEvents.Add(5)
+	in <- RoverEvent{Type: "event", Event: "after"}
+	deadline := time.After(5 * time.Second)
+	for j.eventJournalInfo().Seq < 2 {
+		select {
+		case <-j.Notify():
+		case <-deadline:
+			t.Fatal("events never reached the journal")
+		}
+	}
+	events := j.After(0)
+	if len(events) != 2 || events[0].Event != eventEventsDropped || events[1].Event != "after" {
+		t.Fatalf("journal holds %+v, want events.dropped then the event", events)
+	}
+	if events[0].Data["count"] != uint64(5) {
+		t.Fatalf("events.dropped data = %+v, want count 5", events[0].Data)
+	}
+
+	// A full journal drops its oldest events.
+	appendEvents(j, "x", "y")
+	if got := eventSeqs(j.After(0)); len(got) != 3 || got[0] != 2 {
+		t.Fatalf("full journal kept %v, want the newest 3 from seq 2", got)
+	}
+}
+
+func TestEventJournalIgnoresAckFromAnotherEpoch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	j := newTestEventJournal(t, path, 100)
+	oldEpoch := j.eventJournalInfo().Epoch
+	j.close()
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is gone, so the journal starts a new epoch from seq 1.
+	j = newTestEventJournal(t, path, 100)
+	appendEvents(j, "a", "b", "c")
+	info := j.eventJournalInfo()
+	if info.Epoch == oldEpoch {
+		t.Fatal("journal kept its epoch after losing its file")
+	}
+	j.Ack(oldEpoch, 50)
+	j.Ack("", 2)
+	if got := j.eventJournalInfo(); got.Acked != 0 || got.Pending != 3 {
+		t.Fatalf("acks from other epochs applied: %+v", got)
+	}
+	j.Ack(info.Epoch, 2)
+	if got := eventSeqs(j.After(0)); len(got) != 1 || got[0] != 3 {
+		t.Fatalf("pending after ack = %v, want [3]", got)
+	}
+}
@@ -1,8 +1,27 @@
 package roverd
 
+import "time"
+
 type RoverEvent struct {
 	Type  string         `json:"type"`
+	Seq   uint64         `json:"seq,omitempty"`
 	Event string         `json:"event"`
 	Ts    int64          `json:"ts"`
 	Data  map[string]any `json:"data,omitempty"`
 }
+
+func emitRoverEvent(events chan<- RoverEvent, event string, data map[string]any) {
+	if events == nil {
+		return
+	}
+	select {
+	case events <- RoverEvent{
+		Type:  "event",
+		Event: event,
+		Ts:    time.Now().UnixMilli(),
+		Data:  data,
+	}:
+	default:
+		droppedEvents.Add(1)
+	}
+}
@@ -0,0 +1,81 @@
+package roverd
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Sensor encodings a server can pick in its serverHello. JSON wraps each
+// frame in a base64 sensorMessage and is what servers without a serverHello
+// get; binary sends the raw frame behind a BinaryHeaderLen byte header.
+const (
+	SensorEncodingJSON   = "json"
+	SensorEncodingBinary = "binary"
+)
+
+// Binary messages start with a type byte, the timestamp in milliseconds as
+// a big-endian int64 and a big-endian uint32 sequence number; the payload
+// follows unchanged.
+const (
+	BinaryTypeSensor = 0x01
+	BinaryHeaderLen  = 1 + 8 + 4
+)
+
+var errShortBinaryFrame = errors.New("binary frame shorter than its header")
+
+// sensorEncodings lists the encodings roverd offers, most preferred first.
+var sensorEncodings = []string{SensorEncodingBinary, SensorEncodingJSON}
+
+// AppendBinaryFrame appends a binary message to dst and returns the result.
+func AppendBinaryFrame(dst []byte, msgType byte, ts int64, seq uint32, payload []byte) []byte {
+	dst = append(dst, msgType)
+	dst = binary.BigEndian.AppendUint64(dst, uint64(ts))
+	dst = binary.BigEndian.AppendUint32(dst, seq)
+	return append(dst, payload...)
+}
+
+// ParseBinaryFrame splits a binary message into its header fields and
+// payload. The payload aliases data.
+func ParseBinaryFrame(data []byte) (msgType byte, ts int64, seq uint32, payload []byte, err error) {
+	if len(data) < BinaryHeaderLen {
+		return 0, 0, 0, nil, errShortBinaryFrame
+	}
+	msgType = data[0]
+	ts = int64(binary.BigEndian.Uint64(data[1:9]))
+	seq = binary.BigEndian.Uint32(data[9:13])
+	return msgType, ts, seq, data[BinaryHeaderLen:], nil
+}
+
+// EncodeSensorFrame builds the websocket message for one sensor frame in the
+// given encoding; binary reports whether it must be sent as a binary
+// message.
+func EncodeSensorFrame(encoding string, ts int64, seq uint32, frame []byte) (data []byte, binary bool, err error) {
+	switch encoding {
+	case SensorEncodingBinary:
+		return AppendBinaryFrame(make([]byte, 0, BinaryHeaderLen+len(frame)), BinaryTypeSensor, ts, seq, frame), true, nil
+	case SensorEncodingJSON, "":
+		data, err := json.Marshal(sensorMessage{
+			Type:      "sensor",
+			Timestamp: ts,
+			Seq:       seq,
+			Data:      base64.StdEncoding.EncodeToString(frame),
+		})
+		return data, false, err
+	default:
+		return nil, false, fmt.Errorf("unknown sensor encoding %q", encoding)
+	}
+}
+
+// chooseSensorEncoding accepts the server's pick if roverd offered it and
+// falls back to JSON otherwise.
+func chooseSensorEncoding(requested string) string {
+	for _, enc := range sensorEncodings {
+		if enc == requested {
+			return enc
+		}
+	}
+	return SensorEncodingJSON
+}
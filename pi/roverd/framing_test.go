@@ -0,0 +1,140 @@
+package roverd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// binaryFrameFixture is a sensor frame with ts 1700000000123, seq 42 and
+// payload 13 02 07 00. server/src/helpers/roverFraming.test.js parses the
+// same bytes, so the two sides cannot drift apart unnoticed.
+const binaryFrameFixture = "010000018bcfe5687b0000002a13020700"
+
+func TestBinaryFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		msgType byte
+		ts      int64
+		seq     uint32
+		payload []byte
+	}{
+		{"sensor", BinaryTypeSensor, 1700000000123, 42, []byte{0x13, 0x02, 0x07, 0x00}},
+		{"empty payload", BinaryTypeSensor, 1, 0, nil},
+		{"max seq", 0x7f, 0, 1<<32 - 1, []byte{0xff}},
+		{"negative ts", BinaryTypeSensor, -1, 7, []byte{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := AppendBinaryFrame(nil, tt.msgType, tt.ts, tt.seq, tt.payload)
+			if len(data) != BinaryHeaderLen+len(tt.payload) {
+				t.Fatalf("len = %d, want %d", len(data), BinaryHeaderLen+len(tt.payload))
+			}
+			msgType, ts, seq, payload, err := ParseBinaryFrame(data)
+			if err != nil {
+				t.Fatalf("ParseBinaryFrame: %v", err)
+			}
+			if msgType != tt.msgType || ts != tt.ts || seq != tt.seq || !bytes.Equal(payload, tt.payload) {
+				t.Fatalf("got (%#x, %d, %d, % x), want (%#x, %d, %d, % x)",
+					msgType, ts, seq, payload, tt.msgType, tt.ts, tt.seq, tt.payload)
+			}
+		})
+	}
+}
+
+func TestBinaryFrameFixture(t *testing.T) {
+	data := AppendBinaryFrame(nil, BinaryTypeSensor, 1700000000123, 42, []byte{0x13, 0x02, 0x07, 0x00})
+	if got := hex.EncodeToString(data); got != binaryFrameFixture {
+		t.Fatalf("AppendBinaryFrame = %s, want %s", got, binaryFrameFixture)
+	}
+}
+
+func TestAppendBinaryFrameKeepsPrefix(t *testing.T) {
+	data := AppendBinaryFrame([]byte("xy"), BinaryTypeSensor, 5, 6, []byte{7})
+	if string(data[:2]) != "xy" {
+		t.Fatalf("prefix overwritten: % x", data)
+	}
+	if _, ts, seq, payload, err := ParseBinaryFrame(data[2:]); err != nil || ts != 5 || seq != 6 || !bytes.Equal(payload, []byte{7}) {
+		t.Fatalf("ParseBinaryFrame after prefix = %d, %d, % x, %v", ts, seq, payload, err)
+	}
+}
+
+func TestParseBinaryFrameShort(t *testing.T) {
+	for n := 0; n < BinaryHeaderLen; n++ {
+		if _, _, _, _, err := ParseBinaryFrame(make([]byte, n)); !errors.Is(err, errShortBinaryFrame) {
+			t.Fatalf("%d bytes: err = %v, want errShortBinaryFrame", n, err)
+		}
+	}
+}
+
+func TestEncodeSensorFrame(t *testing.T) {
+	frame := []byte{19, 3, 7, 0, 42, 0xd1}
+
+	data, isBinary, err := EncodeSensorFrame(SensorEncodingBinary, 10, 11, frame)
+	if err != nil || !isBinary {
+		t.Fatalf("binary: binary=%v err=%v", isBinary, err)
+	}
+	if _, ts, seq, payload, _ := ParseBinaryFrame(data); ts != 10 || seq != 11 || !bytes.Equal(payload, frame) {
+		t.Fatalf("binary round trip = %d, %d, % x", ts, seq, payload)
+	}
+
+	for _, encoding := range []string{SensorEncodingJSON, ""} {
+		data, isBinary, err = EncodeSensorFrame(encoding, 10, 11, frame)
+		if err != nil || isBinary {
+			t.Fatalf("%q: binary=%v err=%v", encoding, isBinary, err)
+		}
+		var msg sensorMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("%q: %v", encoding, err)
+		}
+		decoded, _ := base64.StdEncoding.DecodeString(msg.Data)
+		if msg.Type != "sensor" || msg.Timestamp != 10 || msg.Seq != 11 || !bytes.Equal(decoded, frame) {
+			t.Fatalf("%q round trip = %+v", encoding, msg)
+		}
+	}
+
+	if _, _, err := EncodeSensorFrame("cbor", 0, 0, frame); err == nil {
+		t.Fatal("unknown encoding accepted")
+	}
+}
+
+func TestChooseSensorEncoding(t *testing.T) {
+	for requested, want := range map[string]string{
+		SensorEncodingBinary: SensorEncodingBinary,
+		SensorEncodingJSON:   SensorEncodingJSON,
+		"":                   SensorEncodingJSON,
+		"cbor":               SensorEncodingJSON,
+	} {
+		if got := chooseSensorEncoding(requested); got != want {
+			t.Errorf("chooseSensorEncoding(%q) = %q, want %q", requested, got, want)
+		}
+	}
+}
+
+// benchmarkFrame is a stream frame carrying group 100, the largest packet
+// roverd streams by default.
+var benchmarkFrame = append([]byte{19, 81, 100}, make([]byte, 81)...)
+
+func BenchmarkEncodeSensorFrameJSON(b *testing.B) {
+	benchmarkEncodeSensorFrame(b, SensorEncodingJSON)
+}
+
+func BenchmarkEncodeSensorFrameBinary(b *testing.B) {
+	benchmarkEncodeSensorFrame(b, SensorEncodingBinary)
+}
+
+func benchmarkEncodeSensorFrame(b *testing.B, encoding string) {
+	b.ReportAllocs()
+	var size int
+	for i := 0; b.Loop(); i++ {
+		data, _, err := EncodeSensorFrame(encoding, 1700000000123, uint32(i), benchmarkFrame)
+		if err != nil {
+			b.Fatal(err)
+		}
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "bytes/msg")
+}
@@ -0,0 +1,219 @@
+package roverd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// eventLinkDead is emitted when heartbeats stop coming back.
+const eventLinkDead = "link.dead"
+
+var errLinkDead = errors.New("link dead")
+
+// rttStats smooths round-trip samples the way TCP does: the average moves
+// an eighth of the way to each sample and the jitter, as in RFC 3550, a
+// sixteenth of the way to the change since the previous sample.
+type rttStats struct {
+	last    time.Duration
+	min     time.Duration
+	max     time.Duration
+	avg     time.Duration
+	jitter  time.Duration
+	samples uint64
+	lost    uint64
+}
+
+func (s *rttStats) add(rtt time.Duration) {
+	if s.samples == 0 {
+		s.min, s.max, s.avg = rtt, rtt, rtt
+	} else {
+		s.min = min(s.min, rtt)
+		s.max = max(s.max, rtt)
+		s.avg += (rtt - s.avg) / 8
+		delta := rtt - s.last
+		if delta < 0 {
+			delta = -delta
+		}
+		s.jitter += (delta - s.jitter) / 16
+	}
+	s.last = rtt
+	s.samples++
+}
+
+func (s *rttStats) info() *linkRTT {
+	if s.samples == 0 && s.lost == 0 {
+		return nil
+	}
+	return &linkRTT{
+		LastMs:   millis(s.last),
+		MinMs:    millis(s.min),
+		MaxMs:    millis(s.max),
+		AvgMs:    millis(s.avg),
+		JitterMs: millis(s.jitter),
+		Samples:  s.samples,
+		Lost:     s.lost,
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return math.Round(float64(d.Microseconds())/100) / 10
+}
+
+// linkRTT is one kind of round trip in the link telemetry.
+type linkRTT struct {
+	LastMs   float64 `json:"lastMs"`
+	MinMs    float64 `json:"minMs"`
+	MaxMs    float64 `json:"maxMs"`
+	AvgMs    float64 `json:"avgMs"`
+	JitterMs float64 `json:"jitterMs"`
+	Samples  uint64  `json:"samples"`
+	Lost     uint64  `json:"lost"`
+}
+
+// linkMessage is the link telemetry sent after every heartbeat. Ping is the
+// websocket ping, answered by the server's websocket library; echo is the
+// application round trip through the server's message handling, so the
+// difference between them is time spent inside the server.
+type linkMessage struct {
+	Type        string   `json:"type"`
+	Timestamp   int64    `json:"ts"`
+	IntervalMs  int64    `json:"intervalMs"`
+	Missed      int      `json:"missed"`
+	MissedLimit int      `json:"missedLimit"`
+	Ping        *linkRTT `json:"ping,omitempty"`
+	Echo        *linkRTT `json:"echo,omitempty"`
+}
+
+type echoMessage struct {
+	Type      string `json:"type"`
+	Seq       uint32 `json:"seq"`
+	Timestamp int64  `json:"ts"`
+}
+
+// linkMonitor holds the heartbeat state of one connection.
+type linkMonitor struct {
+	interval    time.Duration
+	missedLimit int
+
+	mu      sync.Mutex
+	ping    rttStats
+	echo    rttStats
+	missed  int
+	echoSeq uint32
+	echoes  map[uint32]time.Time
+}
+
+func newLinkMonitor(interval time.Duration, missedLimit int) *linkMonitor {
+	return &linkMonitor{
+		interval:    interval,
+		missedLimit: missedLimit,
+		echoes:      make(map[uint32]time.Time),
+	}
+}
+
+// nextEcho records an echo about to be sent. Echoes older than the missed
+// heartbeat window are counted as lost.
+func (m *linkMonitor) nextEcho(now time.Time) echoMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for seq, sent := range m.echoes {
+		if now.Sub(sent) > m.interval*time.Duration(m.missedLimit) {
+			delete(m.echoes, seq)
+			m.echo.lost++
+		}
+	}
+	m.echoSeq++
+	m.echoes[m.echoSeq] = now
+	return echoMessage{Type: "echo", Seq: m.echoSeq, Timestamp: now.UnixMilli()}
+}
+
+// echoReply completes the round trip of an echo; unknown or expired
+// sequence numbers are ignored.
+func (m *linkMonitor) echoReply(seq uint32, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sent, ok := m.echoes[seq]
+	if !ok {
+		return
+	}
+	delete(m.echoes, seq)
+	m.echo.add(now.Sub(sent))
+}
+
+// pinged records a heartbeat result and returns the consecutive misses.
+func (m *linkMonitor) pinged(rtt time.Duration, err error) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.missed++
+		m.ping.lost++
+		return m.missed
+	}
+	m.missed = 0
+	m.ping.add(rtt)
+	return 0
+}
+
+func (m *linkMonitor) message(now time.Time) linkMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return linkMessage{
+		Type:        "link",
+		Timestamp:   now.UnixMilli(),
+		IntervalMs:  m.interval.Milliseconds(),
+		Missed:      m.missed,
+		MissedLimit: m.missedLimit,
+		Ping:        m.ping.info(),
+		Echo:        m.echo.info(),
+	}
+}
+
+// heartbeat pings the server every interval and publishes the link
+// telemetry. Once MissedHeartbeats pings in a row go unanswered it returns
+// errLinkDead, which ends the connection and starts the usual disconnect
+// handling. Echoes only feed the statistics: servers that predate them never
+// answer, and the websocket ping alone decides whether the link is alive.
+func (c *WSClient) heartbeat(ctx context.Context, conn *websocket.Conn, out *outbound, monitor *linkMonitor) error {
+	ticker := time.NewTicker(monitor.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		now := time.Now()
+		if c.session().protocol >= 2 {
+			if err := out.sendJSON(ctx, classControl, monitor.nextEcho(now)); err != nil {
+				return nil
+			}
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, monitor.interval)
+		err := conn.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return nil
+		}
+		missed := monitor.pinged(time.Since(now), err)
+		if err := out.sendLatestJSON("link", monitor.message(time.Now())); err != nil {
+			c.log.Printf("link encode failed: %v", err)
+		}
+		if missed == 0 {
+			continue
+		}
+		c.log.Printf("heartbeat missed (%d of %d): %v", missed, monitor.missedLimit, err)
+		if missed >= monitor.missedLimit {
+			c.emitEvent(eventLinkDead, map[string]any{
+				"missed":     missed,
+				"intervalMs": monitor.interval.Milliseconds(),
+			})
+			return fmt.Errorf("%w: %d heartbeats missed", errLinkDead, missed)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package roverd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+const (
+	// localStatusInterval is how often websocket clients get a status push.
+	localStatusInterval = time.Second
+	localWriteTimeout   = 5 * time.Second
+	localMaxBody        = 64 * 1024
+)
+
+// LocalAPI serves the rover's commands on the LAN so it can be driven from
+// a phone or laptop next to it while the central server is down. Commands
+// go through the same dispatch as the server's, tagged with the local
+// client as controller so the rover is arbitrated with the server.
+//
+//	GET  /api/status          rover, connection and control state
+//	POST /api/command         one command message as the server sends it
+//	POST /api/{command}       a command by name, its payload as the body
+//	POST /api/release         hand the wheels back before the lease runs out
+//	GET  /api/ws              command messages in, acks and status out
+//
+// Local clients are named "local:" plus their host. Every request needs the
+// token as "Authorization: Bearer <token>" or, for browsers opening the
+// websocket, a token query parameter.
+type LocalAPI struct {
+	cfg    LocalAPIConfig
+	client *WSClient
+	log    *log.Logger
+	ids    atomic.Uint64
+}
+
+// localStatus is the /api/status reply and the websocket status push.
+type localStatus struct {
+	Type         string           `json:"type"`
+	Name         string           `json:"name"`
+	Version      string           `json:"version"`
+	Controller   string           `json:"controller,omitempty"`
+	Connection   connectionStatus `json:"connection"`
+	Control      controlStatus    `json:"control"`
+	EStop        estopInfo        `json:"estop"`
+	OI           oiInfo           `json:"oi"`
+	SensorStream sensorStreamInfo `json:"sensorStream"`
+	Battery      *batteryMessage  `json:"battery,omitempty"`
+}
+
+func NewLocalAPI(cfg LocalAPIConfig, client *WSClient, logger *log.Logger) *LocalAPI {
+	return &LocalAPI{cfg: cfg, client: client, log: logger}
+}
+
+// Run serves until ctx ends.
+func (a *LocalAPI) Run(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              a.cfg.Listen,
+		Handler:           a.handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	a.log.Printf("local API listening on %s", a.cfg.Listen)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handler routes the API behind the token check.
+func (a *LocalAPI) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", a.handleStatus)
+	mux.HandleFunc("POST /api/command", a.handleCommand)
+	mux.HandleFunc("POST /api/release", a.handleRelease)
+	mux.HandleFunc("POST /api/{command}", a.handleNamedCommand)
+	mux.HandleFunc("GET /api/ws", a.handleWebsocket)
+	return a.authorize(mux)
+}
+
+func (a *LocalAPI) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || token == r.Header.Get("Authorization") {
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.cfg.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="roverd"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *LocalAPI) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeLocalJSON(w, http.StatusOK, a.status(localController(r)))
+}
+
+func (a *LocalAPI) handleCommand(w http.ResponseWriter, r *http.Request) {
+	var msg inboundMessage
+	body, err := io.ReadAll(io.LimitReader(r.Body, localMaxBody))
+	if err == nil {
+		err = json.Unmarshal(body, &msg)
+	}
+	if err != nil {
+		writeLocalJSON(w, http.StatusBadRequest, ackMessage{Type: "ack", Status: "error", Error: fmt.Sprintf("invalid command: %v", err)})
+		return
+	}
+	a.reply(w, r, &msg)
+}
+
+// handleNamedCommand takes the command name from the path and its payload
+// from the body, so POST /api/drive with {"velocity":100} is the server's
+// {"type":"drive","drive":{"velocity":100}}. estop takes {"reason":...}.
+func (a *LocalAPI) handleNamedCommand(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("command")
+	body, err := io.ReadAll(io.LimitReader(r.Body, localMaxBody))
+	if err != nil {
+		writeLocalJSON(w, http.StatusBadRequest, ackMessage{Type: "ack", Status: "error", Error: err.Error()})
+		return
+	}
+	msg := inboundMessage{Type: name}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		data := body
+		if name != "estop" && name != "estop.clear" {
+			data, _ = json.Marshal(map[string]json.RawMessage{name: body})
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			writeLocalJSON(w, http.StatusBadRequest, ackMessage{Type: "ack", Status: "error", Error: fmt.Sprintf("invalid %s payload: %v", name, err)})
+			return
+		}
+		msg.Type = name
+	}
+	a.reply(w, r, &msg)
+}
+
+func (a *LocalAPI) handleRelease(w http.ResponseWriter, r *http.Request) {
+	a.client.control.release(localController(r), "released")
+	writeLocalJSON(w, http.StatusOK, a.client.control.status())
+}
+
+// reply runs one HTTP command and answers with its ack. A move or turn is
+// answered once it finishes, and cancelled if the client goes away first.
+func (a *LocalAPI) reply(w http.ResponseWriter, r *http.Request, msg *inboundMessage) {
+	if msg.ID == "" {
+		msg.ID = fmt.Sprintf("local-%d", a.ids.Add(1))
+	}
+	ctx := withController(r.Context(), localController(r))
+	var (
+		result *queryResult
+		err    error
+	)
+	if msg.Move != nil || msg.Turn != nil {
+		var done <-chan error
+		if done, err = a.client.beginMotion(ctx, msg); err == nil {
+			select {
+			case <-ctx.Done():
+				a.client.motion.Cancel("local client gone", true)
+				return
+			case err = <-done:
+			}
+		}
+	} else {
+		result, err = a.run(ctx, msg)
+	}
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, errControlHeld):
+		status = http.StatusConflict
+	case err != nil:
+		status = http.StatusUnprocessableEntity
+	}
+	ack := localAck(msg.ID, err)
+	ack.Query = result
+	writeLocalJSON(w, status, ack)
+}
+
+// run dispatches everything but moves and turns and returns a sensor
+// query's reply; the server-only queries have their answers in /api/status
+// instead.
+func (a *LocalAPI) run(ctx context.Context, msg *inboundMessage) (*queryResult, error) {
+	switch msg.Type {
+	case "chargeHistory", "connectionStatus", "outboundStats":
+		return nil, fmt.Errorf("%s is not available locally; see /api/status", msg.Type)
+	}
+	if msg.Query != nil {
+		return a.client.handleQuery(ctx, msg.Query.Packets)
+	}
+	return nil, a.client.dispatch(ctx, msg)
+}
+
+// handleWebsocket takes command messages as the server would send them and
+// answers each with an ack, pushing status every second. The client gives
+// up the wheels when it disconnects.
+func (a *LocalAPI) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: []string{"*"}})
+	if err != nil {
+		return
+	}
+	defer conn.Close(websocket.StatusInternalError, "closed")
+	controller := localController(r)
+	ctx, cancel := context.WithCancel(withController(r.Context(), controller))
+	defer cancel()
+	defer a.client.control.release(controller, "disconnected")
+	a.log.Printf("local controller %s connected", controller)
+
+	// A failed write ends the read loop through ctx.
+	send := func(v any) {
+		writeCtx, writeCancel := context.WithTimeout(ctx, localWriteTimeout)
+		defer writeCancel()
+		if err := writeJSON(writeCtx, conn, v); err != nil {
+			cancel()
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(localStatusInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				send(a.status(controller))
+			}
+		}
+	}()
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			a.log.Printf("local controller %s disconnected: %v", controller, err)
+			return
+		}
+		var msg inboundMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			send(ackMessage{Type: "ack", Status: "error", Error: fmt.Sprintf("invalid command: %v", err)})
+			continue
+		}
+		if msg.ID == "" {
+			msg.ID = fmt.Sprintf("local-%d", a.ids.Add(1))
+		}
+		if msg.Move != nil || msg.Turn != nil {
+			done, err := a.client.beginMotion(ctx, &msg)
+			if err != nil {
+				send(localAck(msg.ID, err))
+				continue
+			}
+			go func(id string) {
+				select {
+				case <-ctx.Done():
+					a.client.motion.Cancel("disconnected", true)
+				case result := <-done:
+					send(localAck(id, result))
+				}
+			}(msg.ID)
+			continue
+		}
+		result, err := a.run(ctx, &msg)
+		ack := localAck(msg.ID, err)
+		ack.Query = result
+		send(ack)
+	}
+}
+
+func (a *LocalAPI) status(controller string) localStatus {
+	c := a.client
+	st := localStatus{
+		Type:         "status",
+		Name:         c.cfg.Name,
+		Version:      Version,
+		Controller:   controller,
+		Connection:   c.connectionStatus(),
+		Control:      c.control.status(),
+		EStop:        c.deadman.estopInfo(),
+		OI:           c.oiInfo(),
+		SensorStream: c.sensorStreamInfo(),
+	}
+	if c.battery != nil {
+		if bat, _, ok := c.battery.State(); ok {
+			msg := newBatteryMessage(bat)
+			st.Battery = &msg
+		}
+	}
+	return st
+}
+
+// localController names a local client by host, so its HTTP requests and
+// websocket share one lease.
+func localController(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "local:" + host
+}
+
+func localAck(id string, err error) ackMessage {
+	ack := ackMessage{Type: "ack", ID: id, Status: "ok"}
+	if err != nil {
+		ack.Status = "error"
+		ack.Error = err.Error()
+	}
+	return ack
+}
+
+func writeLocalJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
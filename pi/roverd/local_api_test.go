@@ -0,0 +1,96 @@
+package roverd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testLocalToken = "local-s3cret"
+
+func newTestLocalAPI(t *testing.T) (*WSClient, *httptest.Server) {
+	t.Helper()
+	c, _ := newTestClient(t, "localApi:\n  enabled: true\n  token: "+testLocalToken+"\n")
+	srv := httptest.NewServer(NewLocalAPI(c.cfg.LocalAPI, c, log.New(io.Discard, "", 0)).handler())
+	t.Cleanup(srv.Close)
+	return c, srv
+}
+
+// localRequest sends body to path with the authorization header given and
+// returns the status code.
+func localRequest(t *testing.T, srv *httptest.Server, method, path, auth, body string) int {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestLocalAPIRequiresToken(t *testing.T) {
+	_, srv := newTestLocalAPI(t)
+	tests := []struct {
+		name, path, auth string
+		want             int
+	}{
+		{"no token", "/api/status", "", http.StatusUnauthorized},
+		{"wrong token", "/api/status", "Bearer wrong", http.StatusUnauthorized},
+		{"not bearer", "/api/status", testLocalToken, http.StatusUnauthorized},
+		{"wrong query token", "/api/status?token=wrong", "", http.StatusUnauthorized},
+		{"bearer", "/api/status", "Bearer " + testLocalToken, http.StatusOK},
+		{"query token", "/api/status?token=" + testLocalToken, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := localRequest(t, srv, http.MethodGet, tt.path, tt.auth, ""); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if got := localRequest(t, srv, http.MethodPost, "/api/driveDirect", "Bearer wrong", `{"left":100,"right":100}`); got != http.StatusUnauthorized {
+		t.Fatalf("drive with a wrong token: status %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestLocalAPIArbitratesWithServer(t *testing.T) {
+	c, srv := newTestLocalAPI(t)
+	auth := "Bearer " + testLocalToken
+	drive := &inboundMessage{Type: "driveDirect", DriveDirect: &driveDirectPayload{Left: 100, Right: 100}}
+
+	if got := localRequest(t, srv, http.MethodPost, "/api/driveDirect", auth, `{"left":100,"right":100}`); got != http.StatusOK {
+		t.Fatalf("local drive: status %d", got)
+	}
+	if holder := c.control.status().Holder; holder != "local:127.0.0.1" {
+		t.Fatalf("holder after a local drive = %q", holder)
+	}
+	if err := c.dispatch(context.Background(), drive); !errors.Is(err, errControlHeld) {
+		t.Fatalf("server drive while local drives = %v, want errControlHeld", err)
+	}
+	if got := localRequest(t, srv, http.MethodPost, "/api/estop", auth, `{"reason":"test"}`); got != http.StatusOK {
+		t.Fatalf("local estop: status %d", got)
+	}
+	if err := c.dispatch(context.Background(), &inboundMessage{Type: "estop.clear"}); err != nil {
+		t.Fatalf("server estop.clear while local holds the wheels: %v", err)
+	}
+
+	if got := localRequest(t, srv, http.MethodPost, "/api/release", auth, ""); got != http.StatusOK {
+		t.Fatalf("release: status %d", got)
+	}
+	if err := c.dispatch(context.Background(), drive); err != nil {
+		t.Fatalf("server drive after release: %v", err)
+	}
+	if got := localRequest(t, srv, http.MethodPost, "/api/driveDirect", auth, `{"left":100,"right":100}`); got != http.StatusConflict {
+		t.Fatalf("local drive while the server drives: status %d, want %d", got, http.StatusConflict)
+	}
+}
@@ -0,0 +1,287 @@
+package roverd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Events for each step of the low-battery return.
+const (
+	eventLowBatteryAnnounced       = "lowBattery.announced"
+	eventLowBatteryCancelled       = "lowBattery.cancelled"
+	eventLowBatteryDocked          = "lowBattery.docked"
+	eventLowBatteryGaveUp          = "lowBattery.gaveUp"
+	eventLowBatteryReleased        = "lowBattery.released"
+	eventLowBatterySeekDockError   = "lowBattery.seekDockError"
+	eventLowBatterySeekDockIssued  = "lowBattery.seekDockIssued"
+	eventLowBatterySeekDockTimeout = "lowBattery.seekDockTimeout"
+	eventLowBatteryTriggered       = "lowBattery.triggered"
+	eventLowBatteryUndocked        = "lowBattery.undocked"
+)
+
+// lowBatterySongSlot is the song slot the announcement tune is stored in;
+// the last slot, so it is the one least likely to hold a driver's song.
+const lowBatterySongSlot = 4
+
+var lowBatterySong = []songNote{
+	{Note: 79, Duration: 12},
+	{Note: 74, Duration: 12},
+	{Note: 67, Duration: 24},
+}
+
+var errLowBattery = errors.New("battery urgent; returning to dock, only stop is accepted")
+
+// LowBatteryPolicy sends the rover home on its own when the estimated charge
+// reaches the urgent threshold, whether or not a server is connected. It
+// announces the return, refuses drive commands other than stop and keeps
+// issuing Seek Dock until the rover is on the dock or it runs out of
+// attempts, reporting every step as an event.
+type LowBatteryPolicy struct {
+	cfg     LowBatteryConfig
+	audio   AudioConfig
+	adapter *SerialAdapter
+	deadman *DriveDeadman
+	modes   *OIModeTracker
+	motion  *MotionController
+	battery *BatteryEstimator
+	events  chan<- RoverEvent
+	logger  *log.Logger
+
+	mu        sync.Mutex
+	ctx       context.Context
+	active    bool
+	locked    bool
+	docked    bool
+	attempt   int
+	seekStart time.Time
+	triggered time.Time
+}
+
+func NewLowBatteryPolicy(cfg LowBatteryConfig, audio AudioConfig, adapter *SerialAdapter, deadman *DriveDeadman, modes *OIModeTracker, motion *MotionController, battery *BatteryEstimator, events chan<- RoverEvent, logger *log.Logger) *LowBatteryPolicy {
+	p := &LowBatteryPolicy{
+		cfg:     cfg,
+		audio:   audio,
+		adapter: adapter,
+		deadman: deadman,
+		modes:   modes,
+		motion:  motion,
+		battery: battery,
+		events:  events,
+		logger:  logger,
+	}
+	deadman.onEmergencyStop(p.cancel)
+	return p
+}
+
+func (p *LowBatteryPolicy) Run(ctx context.Context, samples <-chan SensorSample) {
+	p.mu.Lock()
+	p.ctx = ctx
+	p.mu.Unlock()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sample := <-samples:
+			p.processSample(sample)
+		}
+	}
+}
+
+// CheckDrive refuses moving driver commands while the policy holds the
+// wheels; stops are always let through.
+func (p *LowBatteryPolicy) CheckDrive(moving bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if moving && p.locked {
+		return errLowBattery
+	}
+	return nil
+}
+
+func (p *LowBatteryPolicy) processSample(sample SensorSample) {
+	if !p.cfg.Enabled || !sample.Has(34) {
+		return
+	}
+	st, _, ok := p.battery.State()
+	if !ok {
+		return
+	}
+	now := time.Now()
+	docked := sample.ChargeSources&sourceHomeBase != 0
+
+	// The state changes under the lock; the stop, song and Seek Dock go to
+	// the serial port after it is released so CheckDrive never waits on I/O.
+	p.mu.Lock()
+	trigger, seek := p.stepLocked(st, docked, now)
+	attempt, ctx := p.attempt, p.ctx
+	p.mu.Unlock()
+	if trigger {
+		p.stopAndAnnounce(ctx)
+	}
+	if seek {
+		p.seekDock(attempt)
+	}
+}
+
+// stepLocked advances the return for one sample and reports whether the
+// wheels have to be stopped and announced and whether to issue Seek Dock.
+func (p *LowBatteryPolicy) stepLocked(st BatteryState, docked bool, now time.Time) (trigger, seek bool) {
+	wasDocked := p.docked
+	p.docked = docked
+
+	if !p.active {
+		if st.Urgent && !docked && p.deadman.CheckEStop() == nil {
+			p.triggerLocked(st, now)
+			return true, true
+		}
+		return false, false
+	}
+
+	if !st.Urgent {
+		p.active, p.locked = false, false
+		p.emitEvent(eventLowBatteryReleased, map[string]any{
+			"chargeMah":  st.ChargeMah,
+			"durationMs": time.Since(p.triggered).Milliseconds(),
+		})
+		p.logger.Printf("low battery return released at %d mAh", st.ChargeMah)
+		return false, false
+	}
+
+	switch {
+	case docked && !wasDocked:
+		p.seekStart = time.Time{}
+		p.emitEvent(eventLowBatteryDocked, map[string]any{
+			"attempt":    p.attempt,
+			"durationMs": time.Since(p.triggered).Milliseconds(),
+		})
+	case !docked && wasDocked:
+		// Knocked or driven off the dock before recovering: start over.
+		p.attempt = 0
+		p.emitEvent(eventLowBatteryUndocked, nil)
+		p.nextSeekLocked(now)
+		return false, true
+	case !docked && !p.seekStart.IsZero() && now.Sub(p.seekStart) >= p.cfg.SeekTimeout.Duration:
+		if p.attempt >= p.cfg.MaxAttempts {
+			p.seekStart = time.Time{}
+			p.locked = false
+			p.emitEvent(eventLowBatteryGaveUp, map[string]any{
+				"attempts":      p.attempt,
+				"driveUnlocked": true,
+			})
+			p.logger.Printf("low battery return gave up after %d seek dock attempts", p.attempt)
+			return false, false
+		}
+		p.emitEvent(eventLowBatterySeekDockTimeout, map[string]any{
+			"attempt":   p.attempt,
+			"waitingMs": p.cfg.SeekTimeout.Milliseconds(),
+		})
+		p.nextSeekLocked(now)
+		return false, true
+	}
+	return false, false
+}
+
+// cancel abandons the return for an emergency stop and unlocks the wheels.
+// If the battery is still urgent the return starts over once the stop is
+// cleared.
+func (p *LowBatteryPolicy) cancel() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.active {
+		return
+	}
+	p.active, p.locked = false, false
+	p.seekStart = time.Time{}
+	p.emitEvent(eventLowBatteryCancelled, map[string]any{
+		"reason":  "emergency stop",
+		"attempt": p.attempt,
+	})
+	p.logger.Printf("low battery return cancelled by emergency stop")
+}
+
+func (p *LowBatteryPolicy) triggerLocked(st BatteryState, now time.Time) {
+	p.active, p.locked = true, true
+	p.triggered = now
+	p.attempt = 0
+	data := map[string]any{
+		"chargeMah":    st.ChargeMah,
+		"thresholdMah": p.battery.cfg.Urgent,
+	}
+	if st.TimeToEmpty > 0 {
+		data["timeToEmptySec"] = int(st.TimeToEmpty.Seconds())
+	}
+	p.emitEvent(eventLowBatteryTriggered, data)
+	p.logger.Printf("battery urgent at %d mAh, returning to dock", st.ChargeMah)
+	p.nextSeekLocked(now)
+}
+
+// nextSeekLocked counts the next Seek Dock attempt and starts its timeout.
+func (p *LowBatteryPolicy) nextSeekLocked(now time.Time) {
+	p.attempt++
+	p.seekStart = now
+}
+
+// stopAndAnnounce halts the wheels and plays the song and announcement.
+func (p *LowBatteryPolicy) stopAndAnnounce(ctx context.Context) {
+	p.motion.Cancel("low battery", false)
+	if err := p.deadman.DriveDirect(0, 0, 0); err != nil {
+		p.logger.Printf("low battery stop failed: %v", err)
+	}
+	if p.cfg.Song {
+		if err := p.adapter.PlaySong(lowBatterySongSlot, lowBatterySong); err != nil {
+			p.logger.Printf("low battery song failed: %v", err)
+		}
+	}
+	text := p.cfg.Announcement
+	if text == "" || !p.audio.TTSEnabled || ctx == nil {
+		p.emitEvent(eventLowBatteryAnnounced, map[string]any{"song": p.cfg.Song, "tts": false})
+		return
+	}
+	audio := p.audio
+	go func() {
+		data := map[string]any{"song": p.cfg.Song, "tts": true, "text": text}
+		if err := speakTTS(ctx, audio, &ttsPayload{Text: text, Speak: true}); err != nil {
+			data["error"] = err.Error()
+		}
+		p.emitEvent(eventLowBatteryAnnounced, data)
+	}()
+}
+
+// seekDock issues Seek Dock for attempt. A latched emergency stop counts as
+// a failed attempt so the timeout retries once it is cleared.
+func (p *LowBatteryPolicy) seekDock(attempt int) {
+	err := p.deadman.CheckEStop()
+	if err == nil {
+		err = p.adapter.SeekDock()
+	}
+	if err != nil {
+		p.emitEvent(eventLowBatterySeekDockError, map[string]any{
+			"attempt": attempt,
+			"error":   err.Error(),
+		})
+		return
+	}
+	p.modes.Commanded(oiModePassive, "lowBattery")
+	p.emitEvent(eventLowBatterySeekDockIssued, map[string]any{
+		"attempt":     attempt,
+		"maxAttempts": p.cfg.MaxAttempts,
+	})
+}
+
+func (p *LowBatteryPolicy) lowBatteryInfo() lowBatteryInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return lowBatteryInfo{
+		Enabled:     p.cfg.Enabled,
+		Active:      p.active,
+		DriveLocked: p.locked,
+		Attempt:     p.attempt,
+	}
+}
+
+func (p *LowBatteryPolicy) emitEvent(event string, data map[string]any) {
+	emitRoverEvent(p.events, event, data)
+}
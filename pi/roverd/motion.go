@@ -0,0 +1,309 @@
+package roverd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// Motion events; every started motion ends in finished or aborted.
+const (
+	eventMotionAborted  = "motion.aborted"
+	eventMotionFinished = "motion.finished"
+	eventMotionProgress = "motion.progress"
+	eventMotionStarted  = "motion.started"
+)
+
+const (
+	motionDefaultSpeed     = 200
+	motionMinSpeed         = 30
+	motionDistanceTol      = 5.0           // mm
+	motionAngleTol         = math.Pi / 180 // 1 degree
+	motionSlowdownGain     = 2.0           // mm/s of speed per mm left
+	motionStraightGain     = 3.0           // mm/s of correction per mm of wheel mismatch
+	motionCommandTTL       = 500 * time.Millisecond
+	motionSampleTimeout    = time.Second
+	motionProgressInterval = 250 * time.Millisecond
+	motionTimeoutSlack     = 3 * time.Second
+)
+
+// motion is one move or turn in progress. Distances are accumulated per
+// wheel from the encoder counts so the controller does not depend on the
+// odometry origin, which may be reset mid-motion by dock contact.
+type motion struct {
+	id       string
+	kind     string
+	target   float64 // mm for move, radians for turn; sign is direction
+	speed    float64
+	done     chan error
+	started  time.Time
+	deadline time.Time
+
+	hasLast      bool
+	lastL, lastR uint16
+	travL, travR float64
+	lastSample   time.Time
+	lastProgress time.Time
+}
+
+// MotionController runs closed-loop move and turn primitives against the
+// wheel encoders, commanding the wheels through the drive deadman.
+type MotionController struct {
+	deadman   *DriveDeadman
+	events    chan<- RoverEvent
+	logger    *log.Logger
+	mmPerTick float64
+	wheelBase float64
+	maxSpeed  int
+
+	mu      sync.Mutex
+	active  *motion
+	encoder [2]uint16
+	hasEnc  bool
+}
+
+func NewMotionController(cfg OdometryConfig, maxSpeed int, deadman *DriveDeadman, events chan<- RoverEvent, logger *log.Logger) *MotionController {
+	m := &MotionController{
+		deadman:   deadman,
+		events:    events,
+		logger:    logger,
+		mmPerTick: math.Pi * cfg.WheelDiameterMm / cfg.TicksPerRev,
+		wheelBase: cfg.WheelBaseMm,
+		maxSpeed:  maxSpeed,
+	}
+	deadman.onEmergencyStop(func() { m.Cancel("emergency stop", false) })
+	return m
+}
+
+// Move drives distanceMm straight ahead (negative reverses). The returned
+// channel receives nil when the distance is covered or an error if the
+// motion is aborted.
+func (m *MotionController) Move(id string, distanceMm, speed int) (<-chan error, error) {
+	if distanceMm == 0 {
+		return nil, errors.New("move requires a non-zero distanceMm")
+	}
+	return m.start(id, "move", float64(distanceMm), speed)
+}
+
+// Turn rotates in place by degrees, counter-clockwise positive.
+func (m *MotionController) Turn(id string, degrees float64, speed int) (<-chan error, error) {
+	if degrees == 0 || math.IsNaN(degrees) || math.IsInf(degrees, 0) {
+		return nil, errors.New("turn requires non-zero degrees")
+	}
+	return m.start(id, "turn", degrees*math.Pi/180, speed)
+}
+
+// Cancel aborts the active motion. stop is false when the caller is about
+// to command the wheels itself, so they are not briefly halted in between.
+func (m *MotionController) Cancel(reason string, stop bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active != nil {
+		m.abortLocked(reason, stop)
+	}
+}
+
+func (m *MotionController) Run(ctx context.Context, samples <-chan SensorSample) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			m.Cancel("shutdown", true)
+			return
+		case sample := <-samples:
+			m.step(sample)
+		case now := <-ticker.C:
+			m.checkStalled(now)
+		}
+	}
+}
+
+func (m *MotionController) start(id, kind string, target float64, speed int) (<-chan error, error) {
+	if speed <= 0 {
+		speed = motionDefaultSpeed
+	}
+	speed = clampInt(speed, motionMinSpeed, m.maxSpeed)
+
+	now := time.Now()
+	mv := &motion{
+		id:           id,
+		kind:         kind,
+		target:       target,
+		speed:        float64(speed),
+		done:         make(chan error, 1),
+		started:      now,
+		lastSample:   now,
+		lastProgress: now,
+	}
+	expected := math.Abs(target) / mv.speed
+	if kind == "turn" {
+		expected = math.Abs(target) * m.wheelBase / 2 / mv.speed
+	}
+	mv.deadline = now.Add(2*time.Duration(expected*float64(time.Second)) + motionTimeoutSlack)
+
+	// Switch to the drive mode before taking the lock; commandLocked only
+	// steers and will not wait for a mode change under it.
+	if err := m.deadman.PrepareDrive(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active != nil {
+		m.abortLocked("superseded", false)
+	}
+	// Baseline on the last reading seen before the wheels start so the
+	// motion between that frame and the next one is counted.
+	mv.lastL, mv.lastR, mv.hasLast = m.encoder[0], m.encoder[1], m.hasEnc
+	m.active = mv
+	if err := m.commandLocked(); err != nil {
+		m.active = nil
+		return nil, err
+	}
+	data := map[string]any{"id": id, "kind": kind, "speed": speed}
+	if kind == "turn" {
+		data["degrees"] = target * 180 / math.Pi
+	} else {
+		data["distanceMm"] = target
+	}
+	m.emitEvent(eventMotionStarted, data)
+	return mv.done, nil
+}
+
+func (m *MotionController) step(sample SensorSample) {
+	if !sample.Has(43) || !sample.Has(44) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.encoder = [2]uint16{sample.EncoderLeft, sample.EncoderRight}
+	m.hasEnc = true
+	mv := m.active
+	if mv == nil {
+		return
+	}
+	mv.lastSample = time.Now()
+	if !mv.hasLast {
+		mv.lastL, mv.lastR, mv.hasLast = sample.EncoderLeft, sample.EncoderRight, true
+		return
+	}
+	mv.travL += encoderDeltaMm(mv.lastL, sample.EncoderLeft, m.mmPerTick)
+	mv.travR += encoderDeltaMm(mv.lastR, sample.EncoderRight, m.mmPerTick)
+	mv.lastL, mv.lastR = sample.EncoderLeft, sample.EncoderRight
+
+	if m.remaining(mv) <= mv.tolerance() {
+		m.finishLocked(nil, true)
+		return
+	}
+	if time.Since(mv.lastProgress) >= motionProgressInterval {
+		mv.lastProgress = time.Now()
+		m.emitEvent(eventMotionProgress, m.status(mv))
+	}
+	if err := m.commandLocked(); err != nil {
+		// A safety veto has already stopped the wheels and may be backing
+		// off; a stop from here would cut that short.
+		m.abortLocked(fmt.Sprintf("drive failed: %v", err), !errors.Is(err, errSafetyVeto))
+	}
+}
+
+func (m *MotionController) checkStalled(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mv := m.active
+	if mv == nil {
+		return
+	}
+	switch {
+	case now.After(mv.deadline):
+		m.abortLocked("timeout", true)
+	case now.Sub(mv.lastSample) > motionSampleTimeout:
+		m.abortLocked("no encoder feedback", true)
+	}
+}
+
+// progressed is how far mv has moved in the target's units, signed the
+// same way as the target.
+func (m *MotionController) progressed(mv *motion) float64 {
+	if mv.kind == "turn" {
+		return (mv.travR - mv.travL) / m.wheelBase
+	}
+	return (mv.travL + mv.travR) / 2
+}
+
+func (m *MotionController) remaining(mv *motion) float64 {
+	return math.Abs(mv.target) - math.Copysign(1, mv.target)*m.progressed(mv)
+}
+
+func (mv *motion) tolerance() float64 {
+	if mv.kind == "turn" {
+		return motionAngleTol
+	}
+	return motionDistanceTol
+}
+
+// commandLocked sends the wheel speeds for the current error: full speed
+// until close to the target, then proportionally slower down to
+// motionMinSpeed so the rover does not overshoot.
+func (m *MotionController) commandLocked() error {
+	mv := m.active
+	remaining := m.remaining(mv)
+	if mv.kind == "turn" {
+		remaining *= m.wheelBase / 2
+	}
+	v := math.Max(motionMinSpeed, math.Min(mv.speed, remaining*motionSlowdownGain))
+	dir := math.Copysign(1, mv.target)
+
+	var left, right float64
+	if mv.kind == "turn" {
+		left, right = -dir*v, dir*v
+	} else {
+		correction := clampFloat((mv.travL-mv.travR)*motionStraightGain, -v/4, v/4)
+		left, right = dir*v-correction, dir*v+correction
+	}
+	return m.deadman.steer(int(math.Round(left)), int(math.Round(right)), motionCommandTTL)
+}
+
+func (m *MotionController) abortLocked(reason string, stop bool) {
+	m.finishLocked(fmt.Errorf("%s aborted: %s", m.active.kind, reason), stop)
+}
+
+func (m *MotionController) finishLocked(result error, stop bool) {
+	mv := m.active
+	m.active = nil
+	if stop {
+		if err := m.deadman.DriveDirect(0, 0, 0); err != nil {
+			m.logger.Printf("motion stop failed: %v", err)
+		}
+	}
+
+	data := m.status(mv)
+	data["durationMs"] = time.Since(mv.started).Milliseconds()
+	event := eventMotionFinished
+	if result != nil {
+		event = eventMotionAborted
+		data["reason"] = result.Error()
+		m.logger.Printf("%s %s: %v", mv.kind, mv.id, result)
+	}
+	m.emitEvent(event, data)
+	mv.done <- result
+}
+
+func (m *MotionController) status(mv *motion) map[string]any {
+	data := map[string]any{"id": mv.id, "kind": mv.kind}
+	done := m.progressed(mv)
+	data["progress"] = math.Round(clampFloat(done/mv.target, 0, 1)*100) / 100
+	if mv.kind == "turn" {
+		data["rotatedDeg"] = math.Round(done*180/math.Pi*10) / 10
+	} else {
+		data["travelledMm"] = math.Round(done)
+	}
+	return data
+}
+
+func (m *MotionController) emitEvent(event string, data map[string]any) {
+	emitRoverEvent(m.events, event, data)
+}
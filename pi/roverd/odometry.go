@@ -0,0 +1,150 @@
+package roverd
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// eventOdometryReset is emitted when the pose goes back to the origin.
+const eventOdometryReset = "odometry.reset"
+
+// odometryMaxGap is the longest silence between encoder samples that is
+// still integrated; after a longer gap the counts are re-baselined because
+// the wheels may have moved by more than one 16-bit wrap.
+const odometryMaxGap = time.Second
+
+// Pose is the dead-reckoned position relative to the last reset. X points
+// along the heading at reset, Y to its left; Heading is in radians,
+// counter-clockwise positive.
+type Pose struct {
+	X          float64
+	Y          float64
+	Heading    float64
+	DistanceMm float64
+	Timestamp  int64
+}
+
+// Odometry integrates the left/right encoder counts (packets 43/44) into a
+// pose and resets it on dock contact so the dock is the map origin.
+type Odometry struct {
+	events    chan<- RoverEvent
+	logger    *log.Logger
+	mmPerTick float64
+	wheelBase float64
+	interval  time.Duration
+
+	mu       sync.Mutex
+	pose     Pose
+	seq      uint64
+	hasLast  bool
+	lastL    uint16
+	lastR    uint16
+	lastTime time.Time
+	docked   bool
+}
+
+func NewOdometry(cfg OdometryConfig, events chan<- RoverEvent, logger *log.Logger) *Odometry {
+	return &Odometry{
+		events:    events,
+		logger:    logger,
+		mmPerTick: math.Pi * cfg.WheelDiameterMm / cfg.TicksPerRev,
+		wheelBase: cfg.WheelBaseMm,
+		interval:  cfg.Interval.Duration,
+	}
+}
+
+func (o *Odometry) Run(ctx context.Context, samples <-chan SensorSample) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sample := <-samples:
+			o.observe(sample)
+		}
+	}
+}
+
+// Interval is how often the websocket client publishes the pose.
+func (o *Odometry) Interval() time.Duration {
+	return o.interval
+}
+
+// Pose returns the current pose and a sequence number that changes every
+// time the pose does.
+func (o *Odometry) Pose() (Pose, uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.pose, o.seq
+}
+
+// Reset moves the origin to the current position.
+func (o *Odometry) Reset(reason string) {
+	o.mu.Lock()
+	o.pose = Pose{Timestamp: time.Now().UnixMilli()}
+	o.seq++
+	o.mu.Unlock()
+	o.logger.Printf("odometry reset (%s)", reason)
+	emitRoverEvent(o.events, eventOdometryReset, map[string]any{"reason": reason})
+}
+
+func (o *Odometry) observe(sample SensorSample) {
+	if sample.Has(34) {
+		docked := sample.ChargeSources&sourceHomeBase != 0
+		o.mu.Lock()
+		arrived := docked && !o.docked
+		o.docked = docked
+		o.mu.Unlock()
+		if arrived {
+			o.Reset("dock")
+		}
+	}
+	if !sample.Has(43) || !sample.Has(44) {
+		return
+	}
+
+	now := time.UnixMilli(sample.Timestamp)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.hasLast || now.Sub(o.lastTime) > odometryMaxGap {
+		o.lastL, o.lastR, o.lastTime, o.hasLast = sample.EncoderLeft, sample.EncoderRight, now, true
+		return
+	}
+	dl := encoderDeltaMm(o.lastL, sample.EncoderLeft, o.mmPerTick)
+	dr := encoderDeltaMm(o.lastR, sample.EncoderRight, o.mmPerTick)
+	o.lastL, o.lastR, o.lastTime = sample.EncoderLeft, sample.EncoderRight, now
+	if dl == 0 && dr == 0 {
+		return
+	}
+
+	center := (dl + dr) / 2
+	dTheta := (dr - dl) / o.wheelBase
+	mid := o.pose.Heading + dTheta/2
+	o.pose.X += center * math.Cos(mid)
+	o.pose.Y += center * math.Sin(mid)
+	o.pose.Heading = normalizeAngle(o.pose.Heading + dTheta)
+	o.pose.DistanceMm += math.Abs(center)
+	o.pose.Timestamp = sample.Timestamp
+	o.seq++
+}
+
+// encoderDeltaMm converts the change between two encoder readings to mm.
+// Counts are unsigned 16-bit and wrap in both directions; the signed
+// difference is correct as long as a wheel moves less than half a wrap
+// between samples.
+func encoderDeltaMm(prev, cur uint16, mmPerTick float64) float64 {
+	return float64(int16(cur-prev)) * mmPerTick
+}
+
+// normalizeAngle wraps a radian angle into (-π, π].
+func normalizeAngle(a float64) float64 {
+	a = math.Mod(a, 2*math.Pi)
+	if a > math.Pi {
+		a -= 2 * math.Pi
+	} else if a <= -math.Pi {
+		a += 2 * math.Pi
+	}
+	return a
+}
@@ -0,0 +1,91 @@
+package roverd
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEncoderDeltaWraps(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur uint16
+		ticks     int
+	}{
+		{"still", 1000, 1000, 0},
+		{"forward", 1000, 1010, 10},
+		{"backward", 1010, 1000, -10},
+		{"forward through wrap", 65530, 5, 11},
+		{"backward through wrap", 5, 65530, -11},
+		{"top of range", 65535, 0, 1},
+		{"half wrap forward", 0, 32767, 32767},
+		{"beyond half wrap reads as backward", 0, 32769, -32767},
+	}
+	for _, tt := range tests {
+		if got := encoderDeltaMm(tt.prev, tt.cur, 0.5); got != float64(tt.ticks)*0.5 {
+			t.Errorf("%s: encoderDeltaMm(%d, %d) = %v, want %v", tt.name, tt.prev, tt.cur, got, float64(tt.ticks)*0.5)
+		}
+	}
+}
+
+func TestNormalizeAngle(t *testing.T) {
+	for _, tt := range []struct{ in, want float64 }{
+		{0, 0},
+		{math.Pi, math.Pi},
+		{-math.Pi, math.Pi},
+		{3 * math.Pi / 2, -math.Pi / 2},
+		{-3 * math.Pi / 2, math.Pi / 2},
+		{5 * math.Pi, math.Pi},
+	} {
+		if got := normalizeAngle(tt.in); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("normalizeAngle(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// encoderSample is a frame carrying only packets 43 and 44.
+func encoderSample(t *testing.T, left, right uint16, ts int64) SensorSample {
+	t.Helper()
+	s, err := decodeQueryReply([]byte{43, 44}, []byte{byte(left >> 8), byte(left), byte(right >> 8), byte(right)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Timestamp = ts
+	return s
+}
+
+func TestOdometryIntegratesThroughWrap(t *testing.T) {
+	// 1 mm per tick and a 200 mm wheel base keep the arithmetic exact.
+	o := NewOdometry(OdometryConfig{WheelDiameterMm: 1 / math.Pi, TicksPerRev: 1, WheelBaseMm: 200}, nil, nil)
+	ts := time.Now().UnixMilli()
+
+	// Straight ahead across the 16-bit wrap on both wheels.
+	o.observe(encoderSample(t, 65500, 65500, ts))
+	o.observe(encoderSample(t, 64, 64, ts+50))
+	pose, _ := o.Pose()
+	if math.Abs(pose.X-100) > 1e-9 || math.Abs(pose.Y) > 1e-9 || pose.Heading != 0 {
+		t.Fatalf("after 100 mm straight: %+v", pose)
+	}
+
+	// Spin in place a quarter turn counter-clockwise: the left wheel runs
+	// backwards through the wrap again.
+	quarter := uint16(math.Round(math.Pi / 2 * 200 / 2))
+	o.observe(encoderSample(t, 64-quarter, 64+quarter, ts+100))
+	pose, _ = o.Pose()
+	if math.Abs(pose.Heading-math.Pi/2) > 0.01 || math.Abs(pose.X-100) > 1e-9 {
+		t.Fatalf("after quarter turn: %+v", pose)
+	}
+	if math.Abs(pose.DistanceMm-100) > 1e-9 {
+		t.Fatalf("spinning in place added distance: %v", pose.DistanceMm)
+	}
+}
+
+func TestOdometryRebaselinesAfterGap(t *testing.T) {
+	o := NewOdometry(OdometryConfig{WheelDiameterMm: 1 / math.Pi, TicksPerRev: 1, WheelBaseMm: 200}, nil, nil)
+	ts := time.Now().UnixMilli()
+	o.observe(encoderSample(t, 0, 0, ts))
+	o.observe(encoderSample(t, 500, 500, ts+odometryMaxGap.Milliseconds()+1))
+	if pose, _ := o.Pose(); pose.X != 0 {
+		t.Fatalf("counts across a gap were integrated: %+v", pose)
+	}
+}
@@ -0,0 +1,114 @@
+package roverd
+
+import "fmt"
+
+// OI modes as reported by sensor packet 35.
+const (
+	oiModeOff byte = iota
+	oiModePassive
+	oiModeSafe
+	oiModeFull
+)
+
+const (
+	driveRadiusStraight = 32767
+	driveRadiusMax      = 2000
+	drivePWMMax         = 255
+	// nominalWheelBaseMm is the 600-series wheel spacing, used where only
+	// the direction of each wheel matters.
+	nominalWheelBaseMm = 235.0
+)
+
+func appendInt16(buf []byte, value int) []byte {
+	return append(buf, byte((value>>8)&0xFF), byte(value&0xFF))
+}
+
+func digitASCII(text string) ([4]byte, error) {
+	chars := [4]byte{' ', ' ', ' ', ' '}
+	if len(text) > len(chars) {
+		return chars, fmt.Errorf("digit text supports up to 4 characters, got %d", len(text))
+	}
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c < 32 || c > 126 {
+			return chars, fmt.Errorf("digit text has unsupported character %q", c)
+		}
+		chars[i] = c
+	}
+	return chars, nil
+}
+
+func normalizeDriveRadius(radius int) int {
+	switch {
+	case radius == 0, radius == driveRadiusStraight, radius == -32768, radius == 32768:
+		return driveRadiusStraight
+	default:
+		return clampInt(radius, -driveRadiusMax, driveRadiusMax)
+	}
+}
+
+// driveWheelSpeeds converts a Drive (137) velocity and radius into the
+// left and right wheel speeds the Roomba will run. A zero radius drives
+// straight, as normalizeDriveRadius treats it.
+func driveWheelSpeeds(velocity, radius int, wheelBase float64) (left, right float64) {
+	v := float64(velocity)
+	switch {
+	case velocity == 0:
+		return 0, 0
+	case radius == 0, radius == driveRadiusStraight, radius == -32768:
+		return v, v
+	case radius == 1:
+		return -v, v
+	case radius == -1:
+		return v, -v
+	default:
+		r := float64(radius)
+		return v * (r - wheelBase/2) / r, v * (r + wheelBase/2) / r
+	}
+}
+
+// rawDriveWheels extracts the wheel speeds from a raw Drive, Drive Direct
+// or Drive PWM command. Only the signs matter to callers, so PWM duty is
+// returned unscaled.
+func rawDriveWheels(buf []byte, wheelBase float64) (left, right int, ok bool) {
+	if len(buf) < 5 {
+		return 0, 0, false
+	}
+	a, b := int(int16BE(buf[1:3])), int(int16BE(buf[3:5]))
+	switch buf[0] {
+	case 137:
+		l, r := driveWheelSpeeds(a, b, wheelBase)
+		return int(l), int(r), true
+	case 145, 146:
+		return b, a, true
+	default:
+		return 0, 0, false
+	}
+}
+
+func ledBits(p *ledsPayload) byte {
+	var bits byte
+	if p.Debris {
+		bits |= 1 << 0
+	}
+	if p.Spot {
+		bits |= 1 << 1
+	}
+	if p.Dock {
+		bits |= 1 << 2
+	}
+	if p.CheckRobot {
+		bits |= 1 << 3
+	}
+	return bits
+}
+
+func buttonBits(p *buttonsPayload) byte {
+	var bits byte
+	for i, pressed := range []bool{p.Clean, p.Spot, p.Dock, p.Minute, p.Hour, p.Day, p.Schedule, p.Clock} {
+		if pressed {
+			bits |= 1 << i
+		}
+	}
+	return bits
+}
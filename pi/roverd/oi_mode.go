@@ -0,0 +1,233 @@
+package roverd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Open Interface mode events.
+const (
+	eventOIError       = "oi.error"
+	eventOIModeChanged = "oi.modeChanged"
+)
+
+const (
+	// oiModeSwitchPause gives the Roomba time to change mode before the next
+	// opcode; commands sent too early are dropped.
+	oiModeSwitchPause = 20 * time.Millisecond
+	// oiModeGrace ignores packet 35 reports that contradict a mode roverd
+	// just commanded, since frames already in flight still carry the old one.
+	oiModeGrace = time.Second
+	// oiDockPassiveDelay keeps a rover that was just driven from being
+	// dropped to Passive while it is still pulling away from the dock.
+	oiDockPassiveDelay = 2 * time.Second
+)
+
+func oiModeName(mode byte) string {
+	switch mode {
+	case oiModeOff:
+		return "off"
+	case oiModePassive:
+		return "passive"
+	case oiModeSafe:
+		return "safe"
+	case oiModeFull:
+		return "full"
+	default:
+		return fmt.Sprintf("unknown(%d)", mode)
+	}
+}
+
+func parseDriveMode(name string) (byte, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "safe":
+		return oiModeSafe, nil
+	case "full":
+		return oiModeFull, nil
+	default:
+		return 0, fmt.Errorf("oiMode must be safe or full, got %q", name)
+	}
+}
+
+func isDriveMode(mode byte) bool {
+	return mode == oiModeSafe || mode == oiModeFull
+}
+
+// OIModeTracker follows the Open Interface mode reported in packet 35. It
+// drops the Roomba to Passive on the dock so it charges and brings it back
+// to Safe or Full before the next drive command.
+type OIModeTracker struct {
+	adapter       *SerialAdapter
+	stream        *StreamSettings
+	events        chan<- RoverEvent
+	logger        *log.Logger
+	passiveOnDock bool
+
+	mu         sync.Mutex
+	mode       byte
+	known      bool
+	driveMode  byte
+	docked     bool
+	lastDrive  time.Time
+	graceUntil time.Time
+}
+
+func NewOIModeTracker(cfg DriveConfig, adapter *SerialAdapter, stream *StreamSettings, events chan<- RoverEvent, logger *log.Logger) *OIModeTracker {
+	driveMode, err := parseDriveMode(cfg.OIMode)
+	if err != nil {
+		driveMode = oiModeSafe
+	}
+	return &OIModeTracker{
+		adapter:       adapter,
+		stream:        stream,
+		events:        events,
+		logger:        logger,
+		passiveOnDock: cfg.PassiveOnDock,
+		driveMode:     driveMode,
+	}
+}
+
+func (t *OIModeTracker) Run(ctx context.Context, samples <-chan SensorSample) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sample := <-samples:
+			t.observe(sample)
+		}
+	}
+}
+
+// Mode returns the last known OI mode; ok is false until the first packet
+// 35 report or mode command.
+func (t *OIModeTracker) Mode() (mode byte, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.mode, t.known
+}
+
+func (t *OIModeTracker) DriveMode() byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.driveMode
+}
+
+func (t *OIModeTracker) PassiveOnDock() bool {
+	return t.passiveOnDock
+}
+
+// Commanded records a mode change roverd just requested so the tracker does
+// not wait for the next sensor frame. Explicit Safe or Full requests also
+// become the mode restored before driving.
+func (t *OIModeTracker) Commanded(mode byte, reason string) {
+	t.mu.Lock()
+	if isDriveMode(mode) && reason == "command" {
+		t.driveMode = mode
+	}
+	t.mu.Unlock()
+	t.setMode(mode, reason)
+}
+
+// EnsureDriveMode re-enters the drive mode when the Roomba is in Off or
+// Passive, so a drive command issued after docking or a watchdog restart
+// actually moves the wheels. It does nothing while the mode is unknown.
+// A switch sleeps while the Roomba settles, so callers must not hold a lock
+// that the sensor loop or other commands wait on.
+func (t *OIModeTracker) EnsureDriveMode() error {
+	t.mu.Lock()
+	t.lastDrive = time.Now()
+	mode, known, target := t.mode, t.known, t.driveMode
+	t.mu.Unlock()
+
+	if !known || isDriveMode(mode) {
+		return nil
+	}
+	if mode == oiModeOff {
+		if err := t.adapter.StartOI(); err != nil {
+			return fmt.Errorf("start oi: %w", err)
+		}
+		time.Sleep(oiModeSwitchPause)
+		if err := t.adapter.StartSensorStream(t.stream.Packets()); err != nil {
+			t.logger.Printf("restart sensor stream after oi start failed: %v", err)
+		}
+	}
+	var err error
+	if target == oiModeFull {
+		err = t.adapter.FullMode()
+	} else {
+		err = t.adapter.SafeMode()
+	}
+	if err != nil {
+		return fmt.Errorf("enter %s mode: %w", oiModeName(target), err)
+	}
+	t.setMode(target, "drive")
+	time.Sleep(oiModeSwitchPause)
+	return nil
+}
+
+func (t *OIModeTracker) observe(sample SensorSample) {
+	t.mu.Lock()
+	if sample.Has(34) {
+		t.docked = sample.ChargeSources&sourceHomeBase != 0
+	}
+	if !sample.Has(35) {
+		t.mu.Unlock()
+		return
+	}
+	if sample.OIMode != t.mode && time.Now().Before(t.graceUntil) {
+		t.mu.Unlock()
+		return
+	}
+	toPassive := t.passiveOnDock && t.docked && isDriveMode(sample.OIMode) &&
+		time.Since(t.lastDrive) >= oiDockPassiveDelay
+	t.mu.Unlock()
+
+	t.setMode(sample.OIMode, "sensor")
+	if toPassive {
+		t.enterPassive()
+	}
+}
+
+func (t *OIModeTracker) enterPassive() {
+	if err := t.adapter.PassiveMode(); err != nil {
+		t.logger.Printf("passive on dock failed: %v", err)
+		t.emitEvent(eventOIError, map[string]any{"action": "passive", "error": err.Error()})
+		return
+	}
+	t.setMode(oiModePassive, "dock")
+	t.logger.Printf("docked in drive mode, switched to passive so the battery charges")
+	time.Sleep(oiModeSwitchPause)
+	if err := t.adapter.StartSensorStream(t.stream.Packets()); err != nil {
+		t.logger.Printf("restart sensor stream after passive failed: %v", err)
+	}
+}
+
+func (t *OIModeTracker) setMode(mode byte, reason string) {
+	t.mu.Lock()
+	from, known := t.mode, t.known
+	t.mode, t.known = mode, true
+	if reason != "sensor" {
+		t.graceUntil = time.Now().Add(oiModeGrace)
+	}
+	t.mu.Unlock()
+
+	if known && from == mode {
+		return
+	}
+	data := map[string]any{
+		"mode":   oiModeName(mode),
+		"reason": reason,
+	}
+	if known {
+		data["from"] = oiModeName(from)
+	}
+	t.emitEvent(eventOIModeChanged, data)
+}
+
+func (t *OIModeTracker) emitEvent(event string, data map[string]any) {
+	emitRoverEvent(t.events, event, data)
+}
@@ -0,0 +1,46 @@
+package roverd
+
+import "testing"
+
+// driveFrame builds a raw Drive (137) command.
+func driveFrame(velocity, radius int16) []byte {
+	return []byte{137, byte(uint16(velocity) >> 8), byte(velocity), byte(uint16(radius) >> 8), byte(radius)}
+}
+
+func TestRawDriveWheels(t *testing.T) {
+	tests := []struct {
+		name        string
+		frame       []byte
+		left, right int
+	}{
+		{"stop", []byte{137, 0, 0, 0, 0}, 0, 0},
+		{"stop straight", driveFrame(0, driveRadiusStraight), 0, 0},
+		{"stop spinning", driveFrame(0, 1), 0, 0},
+		{"radius zero is straight", driveFrame(200, 0), 200, 200},
+		{"straight", driveFrame(200, driveRadiusStraight), 200, 200},
+		{"straight alt", driveFrame(-150, -32768), -150, -150},
+		{"spin left", driveFrame(100, 1), -100, 100},
+		{"spin right", driveFrame(100, -1), 100, -100},
+		{"arc left", driveFrame(200, 500), 153, 247},
+		{"arc right", driveFrame(200, -500), 247, 153},
+		{"reverse arc", driveFrame(-100, 235), -50, -150},
+		{"drive direct", []byte{145, 0x00, 0x64, 0xff, 0x9c}, -100, 100},
+		{"drive pwm", []byte{146, 0x00, 0x10, 0x00, 0x20}, 32, 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left, right, ok := rawDriveWheels(tt.frame, nominalWheelBaseMm)
+			if !ok || left != tt.left || right != tt.right {
+				t.Fatalf("rawDriveWheels(% x) = %d, %d, %v; want %d, %d, true", tt.frame, left, right, ok, tt.left, tt.right)
+			}
+		})
+	}
+}
+
+func TestRawDriveWheelsIgnoresOtherCommands(t *testing.T) {
+	for _, frame := range [][]byte{{137, 0, 0}, {143, 0, 0, 0, 0}, {128}} {
+		if _, _, ok := rawDriveWheels(frame, nominalWheelBaseMm); ok {
+			t.Errorf("rawDriveWheels(% x) reported a drive", frame)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package roverd
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	simTick            = 15 * time.Millisecond
+	simWheelBaseMm     = 235.0
+	simTicksPerMm      = 508.8 / (72.0 * math.Pi)
+	simDockRadiusMm    = 30.0
+	simSeekSpeed       = 150.0
+	simIdleCurrentMa   = 180.0
+	simDriveCurrentMa  = 0.8
+	simChargeCurrentMa = 1500.0
+	simTrickleMa       = 50.0
+)
+
+// opcodeArgs is the number of data bytes that follow each fixed-length OI
+// opcode. Song (140), Stream (148), Query List (149) and Script (152) carry
+// their own length and are handled separately.
+var opcodeArgs = map[byte]int{
+	7: 0, 128: 0, 129: 1, 130: 0, 131: 0, 132: 0, 133: 0, 134: 0, 135: 0,
+	136: 0, 137: 4, 138: 1, 139: 3, 141: 1, 142: 1, 143: 0, 144: 3, 145: 4,
+	146: 4, 147: 1, 150: 1, 151: 1, 153: 0, 154: 0, 155: 1, 156: 2, 157: 2,
+	158: 1, 162: 2, 163: 4, 164: 4, 165: 1, 167: 15, 168: 3, 173: 0,
+}
+
+type OISimOptions struct {
+	CapacityMah int
+	ChargeMah   int
+	Undocked    bool
+}
+
+// OISimulator emulates a Roomba 600-series Open Interface closely enough to
+// exercise roverd's real serial code: it tracks the OI mode, integrates wheel
+// velocities into a pose and encoder counts, drains or charges a battery
+// and streams checksummed sensor frames.
+type OISimulator struct {
+	logger *log.Logger
+
+	mu          sync.Mutex
+	mode        byte
+	x, y, theta float64
+	encLeft     float64
+	encRight    float64
+	distance    float64
+	angle       float64
+	velLeft     float64
+	velRight    float64
+	reqVelocity int
+	reqRadius   int
+	seeking     bool
+	docked      bool
+	chargeMah   float64
+	capacityMah float64
+	currentMa   float64
+	buttons     byte
+	songNumber  byte
+	streaming   bool
+	stream      []byte
+}
+
+func NewOISimulator(opts OISimOptions, logger *log.Logger) *OISimulator {
+	capacity := opts.CapacityMah
+	if capacity <= 0 {
+		capacity = 2696
+	}
+	charge := opts.ChargeMah
+	if charge <= 0 || charge > capacity {
+		charge = capacity * 3 / 4
+	}
+	return &OISimulator{
+		logger:      logger,
+		mode:        oiModeOff,
+		docked:      !opts.Undocked,
+		chargeMah:   float64(charge),
+		capacityMah: float64(capacity),
+	}
+}
+
+// Pipe starts the simulator in-process and returns the roverd end of the
+// link. Closing it stops the simulator.
+func (s *OISimulator) Pipe() io.ReadWriteCloser {
+	roverEnd, simEnd := net.Pipe()
+	go func() {
+		defer simEnd.Close()
+		if err := s.Serve(context.Background(), simEnd); err != nil && err != io.EOF {
+			s.logger.Printf("oisim: %v", err)
+		}
+	}()
+	return roverEnd
+}
+
+// Serve reads OI commands from rw and streams sensor frames back until ctx
+// is done or the link fails.
+func (s *OISimulator) Serve(ctx context.Context, rw io.ReadWriter) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var writeMu sync.Mutex
+	write := func(buf []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_, err := rw.Write(buf)
+		return err
+	}
+
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- s.readCommands(rw, write)
+	}()
+	go func() {
+		ticker := time.NewTicker(simTick)
+		defer ticker.Stop()
+		last := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			case now := <-ticker.C:
+				frame := s.step(now.Sub(last))
+				last = now
+				if frame == nil {
+					continue
+				}
+				if err := write(frame); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}
+	}()
+	return <-errCh
+}
+
+func (s *OISimulator) readCommands(r io.Reader, write func([]byte) error) error {
+	reader := bufio.NewReader(r)
+	readN := func(n int) ([]byte, error) {
+		buf := make([]byte, n)
+		_, err := io.ReadFull(reader, buf)
+		return buf, err
+	}
+	for {
+		op, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		var args []byte
+		switch op {
+		case 140:
+			head, err := readN(2)
+			if err != nil {
+				return err
+			}
+			notes, err := readN(2 * int(head[1]))
+			if err != nil {
+				return err
+			}
+			args = append(head, notes...)
+		case 148, 149, 152:
+			n, err := reader.ReadByte()
+			if err != nil {
+				return err
+			}
+			rest, err := readN(int(n))
+			if err != nil {
+				return err
+			}
+			args = append([]byte{n}, rest...)
+		default:
+			size, ok := opcodeArgs[op]
+			if !ok {
+				s.logger.Printf("oisim: ignoring unknown opcode %d", op)
+				continue
+			}
+			if args, err = readN(size); err != nil {
+				return err
+			}
+		}
+		if reply := s.apply(op, args); reply != nil {
+			if err := write(reply); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// apply executes one command and returns any bytes the Roomba would send
+// back immediately.
+func (s *OISimulator) apply(op byte, args []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	driving := s.mode == oiModeSafe || s.mode == oiModeFull
+	switch op {
+	case 7, 173:
+		s.mode = oiModeOff
+		s.streaming = false
+		s.stopLocked()
+	case 128, 133:
+		s.mode = oiModePassive
+		s.stopLocked()
+	case 130, 131:
+		s.mode = oiModeSafe
+		s.stopLocked()
+	case 132:
+		s.mode = oiModeFull
+		s.stopLocked()
+	case 134, 135, 136:
+		s.mode = oiModePassive
+		s.stopLocked()
+	case 143:
+		s.mode = oiModePassive
+		s.stopLocked()
+		s.seeking = !s.docked
+	case 137:
+		if driving {
+			s.setDriveLocked(int(int16BE(args[0:2])), int(int16BE(args[2:4])))
+		}
+	case 145:
+		if driving {
+			s.setWheelsLocked(float64(int16BE(args[2:4])), float64(int16BE(args[0:2])))
+		}
+	case 146:
+		if driving {
+			right := float64(int16BE(args[0:2])) / drivePWMMax * 500
+			left := float64(int16BE(args[2:4])) / drivePWMMax * 500
+			s.setWheelsLocked(left, right)
+		}
+	case 141:
+		s.songNumber = args[0]
+	case 165:
+		s.buttons = args[0]
+	case 148:
+		s.stream = append([]byte(nil), args[1:]...)
+		s.streaming = len(s.stream) > 0
+	case 150:
+		s.streaming = args[0] == 1 && len(s.stream) > 0
+	case 142:
+		return s.packetLocked(args[0])
+	case 149:
+		var reply []byte
+		for _, id := range args[1:] {
+			reply = append(reply, s.packetLocked(id)...)
+		}
+		return reply
+	}
+	return nil
+}
+
+func (s *OISimulator) stopLocked() {
+	s.seeking = false
+	s.reqVelocity, s.reqRadius = 0, 0
+	s.velLeft, s.velRight = 0, 0
+}
+
+func (s *OISimulator) setDriveLocked(velocity, radius int) {
+	s.seeking = false
+	s.reqVelocity, s.reqRadius = velocity, radius
+	s.velLeft, s.velRight = driveWheelSpeeds(velocity, radius, simWheelBaseMm)
+}
+
+func (s *OISimulator) setWheelsLocked(left, right float64) {
+	s.seeking = false
+	s.reqVelocity, s.reqRadius = 0, 0
+	s.velLeft = clampFloat(left, -500, 500)
+	s.velRight = clampFloat(right, -500, 500)
+}
+
+// step advances the simulation by dt and returns the next stream frame, or
+// nil when streaming is off.
+func (s *OISimulator) step(dt time.Duration) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secs := dt.Seconds()
+	if s.seeking {
+		s.steerToDockLocked()
+	}
+
+	dl := s.velLeft * secs
+	dr := s.velRight * secs
+	if dl != 0 || dr != 0 {
+		s.docked = false
+		center := (dl + dr) / 2
+		dTheta := (dr - dl) / simWheelBaseMm
+		s.x += center * math.Cos(s.theta+dTheta/2)
+		s.y += center * math.Sin(s.theta+dTheta/2)
+		s.theta = math.Mod(s.theta+dTheta, 2*math.Pi)
+		s.encLeft += dl * simTicksPerMm
+		s.encRight += dr * simTicksPerMm
+		s.distance += center
+		s.angle += dTheta * 180 / math.Pi
+	}
+	if s.seeking && math.Hypot(s.x, s.y) < simDockRadiusMm {
+		s.stopLocked()
+		s.x, s.y, s.theta = 0, 0, 0
+		s.docked = true
+	}
+
+	s.currentMa = -(simIdleCurrentMa + simDriveCurrentMa*(math.Abs(s.velLeft)+math.Abs(s.velRight)))
+	if s.chargingLocked() {
+		if s.chargeMah < s.capacityMah {
+			s.currentMa = simChargeCurrentMa
+		} else {
+			s.currentMa = simTrickleMa
+		}
+	}
+	s.chargeMah = clampFloat(s.chargeMah+s.currentMa*secs/3600, 0, s.capacityMah)
+
+	if !s.streaming {
+		return nil
+	}
+	payload := make([]byte, 0, streamPayloadLength(s.stream))
+	for _, id := range s.stream {
+		payload = append(payload, id)
+		payload = append(payload, s.packetLocked(id)...)
+	}
+	s.buttons = 0
+	frame := append([]byte{sensorHeader, byte(len(payload))}, payload...)
+	return append(frame, calcChecksum(frame))
+}
+
+func (s *OISimulator) steerToDockLocked() {
+	heading := math.Atan2(-s.y, -s.x)
+	diff := math.Remainder(heading-s.theta, 2*math.Pi)
+	turn := clampFloat(diff*200, -simSeekSpeed, simSeekSpeed)
+	forward := simSeekSpeed * math.Max(0, math.Cos(diff))
+	s.velLeft = forward - turn
+	s.velRight = forward + turn
+}
+
+// chargingLocked mirrors the real OI: the battery only charges on the dock
+// while the Roomba is in Passive (or Off) mode.
+func (s *OISimulator) chargingLocked() bool {
+	return s.docked && (s.mode == oiModePassive || s.mode == oiModeOff)
+}
+
+func (s *OISimulator) chargingStateLocked() byte {
+	switch {
+	case !s.chargingLocked():
+		return 0
+	case s.chargeMah < s.capacityMah:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func (s *OISimulator) packetLocked(id byte) []byte {
+	if members, ok := packetGroups[id]; ok {
+		var data []byte
+		for _, member := range members {
+			data = append(data, s.packetLocked(member)...)
+		}
+		return data
+	}
+	u16 := func(v int) []byte { return appendInt16(nil, v) }
+	soc := s.chargeMah / s.capacityMah
+	switch id {
+	case 17:
+		if s.docked || math.Hypot(s.x, s.y) < 1000 {
+			return []byte{172} // red + green buoy + force field
+		}
+		return []byte{0}
+	case 18:
+		return []byte{s.buttons}
+	case 19:
+		d := int(math.Round(s.distance))
+		s.distance -= float64(d)
+		return u16(d)
+	case 20:
+		a := int(math.Round(s.angle))
+		s.angle -= float64(a)
+		return u16(a)
+	case 21:
+		return []byte{s.chargingStateLocked()}
+	case 22:
+		mv := 13000 + 3500*soc
+		if s.chargingLocked() {
+			mv += 500
+		}
+		return u16(int(mv))
+	case 23:
+		return u16(int(s.currentMa))
+	case 24:
+		temp := 24.0
+		if s.chargingLocked() {
+			temp = 31
+		}
+		return []byte{byte(int8(temp))}
+	case 25:
+		return u16(int(s.chargeMah))
+	case 26:
+		return u16(int(s.capacityMah))
+	case 34:
+		if s.docked {
+			return []byte{0b10}
+		}
+		return []byte{0}
+	case 35:
+		return []byte{s.mode}
+	case 36:
+		return []byte{s.songNumber}
+	case 39:
+		return u16(s.reqVelocity)
+	case 40:
+		return u16(s.reqRadius)
+	case 41:
+		return u16(int(s.velRight))
+	case 42:
+		return u16(int(s.velLeft))
+	case 43:
+		return u16(int(s.encLeft))
+	case 44:
+		return u16(int(s.encRight))
+	case 54:
+		return u16(int(math.Abs(s.velLeft) * 0.4))
+	case 55:
+		return u16(int(math.Abs(s.velRight) * 0.4))
+	case 58:
+		if s.velLeft+s.velRight > 0 {
+			return []byte{1}
+		}
+		return []byte{0}
+	default:
+		return make([]byte, packetSizes[id])
+	}
+}
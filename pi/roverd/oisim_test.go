@@ -0,0 +1,85 @@
+//go:build !dummy
+
+package roverd
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// awaitSample reads decoded frames until one satisfies ok.
+func awaitSample(t *testing.T, parsed <-chan SensorSample, what string, ok func(SensorSample) bool) SensorSample {
+	t.Helper()
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case sample := <-parsed:
+			if ok(sample) {
+				return sample
+			}
+		case <-deadline:
+			t.Fatalf("no sensor frame with %s", what)
+		}
+	}
+}
+
+func TestOISimulatorRoundTrip(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	port := NewOISimulator(OISimOptions{Undocked: true}, logger).Pipe()
+	t.Cleanup(func() { port.Close() })
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	settings, err := NewStreamSettings(SensorStreamConfig{Packets: []int{35, 41, 42, 43, 44}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := make(chan SensorSample, 16)
+	go NewSensorStreamer(port, settings, nil, parsed, logger).Run(ctx)
+	adapter := NewSerialAdapter(port, logger)
+
+	if err := adapter.StartOI(); err != nil {
+		t.Fatal(err)
+	}
+	if err := adapter.SafeMode(); err != nil {
+		t.Fatal(err)
+	}
+	if err := adapter.StartSensorStream(settings.Packets()); err != nil {
+		t.Fatal(err)
+	}
+	start := awaitSample(t, parsed, "Safe mode", func(s SensorSample) bool {
+		return s.OIMode == oiModeSafe
+	})
+	if start.RequestedLeftVelocity != 0 || start.RequestedRightVelocity != 0 {
+		t.Fatalf("wheels turning before a drive: %d, %d", start.RequestedLeftVelocity, start.RequestedRightVelocity)
+	}
+
+	if err := adapter.DriveDirect(200, 100); err != nil {
+		t.Fatal(err)
+	}
+	// 100 mm/s is about 45 encoder counts in 100ms.
+	moved := awaitSample(t, parsed, "the encoders advancing", func(s SensorSample) bool {
+		return int16(s.EncoderLeft-start.EncoderLeft) > 45 && int16(s.EncoderRight-start.EncoderRight) > 45
+	})
+	if moved.RequestedLeftVelocity != 200 || moved.RequestedRightVelocity != 100 {
+		t.Fatalf("requested velocity %d, %d; want 200, 100", moved.RequestedLeftVelocity, moved.RequestedRightVelocity)
+	}
+	if left, right := int16(moved.EncoderLeft-start.EncoderLeft), int16(moved.EncoderRight-start.EncoderRight); left <= right {
+		t.Fatalf("left encoder advanced %d, right %d; want the faster left wheel ahead", left, right)
+	}
+
+	if err := adapter.DriveDirect(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	stopped := awaitSample(t, parsed, "the wheels stopped", func(s SensorSample) bool {
+		return s.RequestedLeftVelocity == 0 && s.RequestedRightVelocity == 0
+	})
+	later := awaitSample(t, parsed, "a later frame", func(SensorSample) bool { return true })
+	if later.EncoderLeft != stopped.EncoderLeft || later.EncoderRight != stopped.EncoderRight {
+		t.Fatalf("encoders moved after a stop: %d, %d then %d, %d",
+			stopped.EncoderLeft, stopped.EncoderRight, later.EncoderLeft, later.EncoderRight)
+	}
+}
@@ -0,0 +1,296 @@
+package roverd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// Outbound priority classes, highest first. The writer always drains the
+// control class before events and events before telemetry, so a burst of
+// sensor frames on a slow link cannot hold back an ack or an estop.
+const (
+	classControl outboundClass = iota
+	classEvents
+	classTelemetry
+	outboundClasses
+)
+
+const (
+	// outboundQueueLimit bounds the control and events classes; senders
+	// block when it is reached. Telemetry is bounded by its keys instead.
+	outboundQueueLimit = 64
+)
+
+type outboundClass int
+
+var outboundClassNames = [outboundClasses]string{"control", "events", "telemetry"}
+
+func (cl outboundClass) String() string {
+	return outboundClassNames[cl]
+}
+
+// safetyEventPrefixes are the events sent in the control class rather than
+// behind the other events.
+var safetyEventPrefixes = []string{eventDriveDeadman, "estop.", "safety.", eventStuckDetected}
+
+func eventClass(event string) outboundClass {
+	for _, prefix := range safetyEventPrefixes {
+		if strings.HasPrefix(event, prefix) {
+			return classControl
+		}
+	}
+	return classEvents
+}
+
+var errOutboundClosed = errors.New("outbound writer stopped")
+
+type outboundMessage struct {
+	class   outboundClass
+	key     string
+	msgType websocket.MessageType
+	data    []byte
+	queued  time.Time
+}
+
+// outboundStats are the counters of one class since the connection opened.
+type outboundStats struct {
+	Queued    int     `json:"queued"`
+	MaxQueued int     `json:"maxQueued"`
+	Enqueued  uint64  `json:"enqueued"`
+	Sent      uint64  `json:"sent"`
+	Coalesced uint64  `json:"coalesced"`
+	Bytes     uint64  `json:"bytes"`
+	AvgWaitMs float64 `json:"avgWaitMs"`
+	MaxWaitMs int64   `json:"maxWaitMs"`
+	waitTotal time.Duration
+}
+
+// outbound is the single writer of one websocket connection. Control and
+// events messages are sent in order within their class; telemetry is keyed
+// by stream and a newer message replaces one still waiting, so only the
+// latest sensor frame, odometry pose or battery report goes out.
+type outbound struct {
+	conn         *websocket.Conn
+	writeTimeout time.Duration
+
+	mu        sync.Mutex
+	queues    [classTelemetry][]outboundMessage
+	telemetry map[string]outboundMessage
+	order     []string
+	stats     [outboundClasses]outboundStats
+	wake      chan struct{}
+	space     chan struct{}
+	done      chan struct{}
+	err       error
+}
+
+func newOutbound(conn *websocket.Conn, writeTimeout time.Duration) *outbound {
+	return &outbound{
+		conn:         conn,
+		writeTimeout: writeTimeout,
+		telemetry:    make(map[string]outboundMessage),
+		wake:         make(chan struct{}, 1),
+		space:        make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+}
+
+// Run writes queued messages until ctx ends or a write fails. A write that
+// misses its deadline fails the connection so the caller reconnects rather
+// than waiting on a dead link.
+func (o *outbound) Run(ctx context.Context) error {
+	err := o.run(ctx)
+	o.mu.Lock()
+	o.err = err
+	o.mu.Unlock()
+	close(o.done)
+	return err
+}
+
+func (o *outbound) run(ctx context.Context) error {
+	for {
+		msg, ok := o.next()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-o.wake:
+			}
+			continue
+		}
+		writeCtx, cancel := context.WithTimeout(ctx, o.writeTimeout)
+		err := o.conn.Write(writeCtx, msg.msgType, msg.data)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(writeCtx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%s write missed its %s deadline: %w", msg.class, o.writeTimeout, err)
+			}
+			return err
+		}
+		o.record(msg)
+	}
+}
+
+// next takes the oldest message of the highest non-empty class.
+func (o *outbound) next() (outboundMessage, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for class := range o.queues {
+		queue := o.queues[class]
+		if len(queue) == 0 {
+			continue
+		}
+		msg := queue[0]
+		queue[0] = outboundMessage{}
+		o.queues[class] = queue[1:]
+		o.stats[class].Queued--
+		select {
+		case o.space <- struct{}{}:
+		default:
+		}
+		return msg, true
+	}
+	if len(o.order) == 0 {
+		return outboundMessage{}, false
+	}
+	key := o.order[0]
+	o.order = o.order[1:]
+	msg := o.telemetry[key]
+	delete(o.telemetry, key)
+	o.stats[classTelemetry].Queued--
+	return msg, true
+}
+
+func (o *outbound) record(msg outboundMessage) {
+	wait := time.Since(msg.queued)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	st := &o.stats[msg.class]
+	st.Sent++
+	st.Bytes += uint64(len(msg.data))
+	st.waitTotal += wait
+	if ms := wait.Milliseconds(); ms > st.MaxWaitMs {
+		st.MaxWaitMs = ms
+	}
+}
+
+// sendJSON queues v in a control or events class, waiting for room if the
+// class is full.
+func (o *outbound) sendJSON(ctx context.Context, class outboundClass, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	msg := outboundMessage{class: class, msgType: websocket.MessageText, data: data}
+	for {
+		o.mu.Lock()
+		if o.err != nil || o.isDone() {
+			o.mu.Unlock()
+			return errOutboundClosed
+		}
+		if len(o.queues[class]) < outboundQueueLimit {
+			msg.queued = time.Now()
+			o.queues[class] = append(o.queues[class], msg)
+			o.enqueuedLocked(class, len(o.queues[class]))
+			o.mu.Unlock()
+			o.signal()
+			return nil
+		}
+		o.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-o.done:
+			return errOutboundClosed
+		case <-o.space:
+		}
+	}
+}
+
+// sendLatest queues a telemetry message under key, replacing one with the
+// same key that has not been written yet. It never blocks.
+func (o *outbound) sendLatest(key string, msgType websocket.MessageType, data []byte) {
+	o.mu.Lock()
+	if o.isDone() {
+		o.mu.Unlock()
+		return
+	}
+	msg := outboundMessage{class: classTelemetry, key: key, msgType: msgType, data: data, queued: time.Now()}
+	if _, waiting := o.telemetry[key]; waiting {
+		o.stats[classTelemetry].Coalesced++
+	} else {
+		o.order = append(o.order, key)
+	}
+	o.telemetry[key] = msg
+	o.enqueuedLocked(classTelemetry, len(o.order))
+	o.mu.Unlock()
+	o.signal()
+}
+
+// sendLatestJSON is sendLatest for a JSON telemetry message.
+func (o *outbound) sendLatestJSON(key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	o.sendLatest(key, websocket.MessageText, data)
+	return nil
+}
+
+func (o *outbound) enqueuedLocked(class outboundClass, depth int) {
+	st := &o.stats[class]
+	st.Enqueued++
+	st.Queued = depth
+	if depth > st.MaxQueued {
+		st.MaxQueued = depth
+	}
+}
+
+func (o *outbound) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *outbound) isDone() bool {
+	select {
+	case <-o.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stats returns the per-class counters keyed by class name.
+func (o *outbound) Stats() map[string]outboundStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stats := make(map[string]outboundStats, outboundClasses)
+	for class, st := range o.stats {
+		if st.Sent > 0 {
+			st.AvgWaitMs = float64(st.waitTotal.Microseconds()) / float64(st.Sent) / 1000
+		}
+		stats[outboundClass(class).String()] = st
+	}
+	return stats
+}
+
+// formatOutboundStats summarises the counters for the log, highest class
+// first.
+func formatOutboundStats(stats map[string]outboundStats) string {
+	parts := make([]string, 0, len(outboundClassNames))
+	for _, name := range outboundClassNames {
+		st := stats[name]
+		parts = append(parts, fmt.Sprintf("%s sent=%d coalesced=%d maxQueued=%d maxWait=%dms",
+			name, st.Sent, st.Coalesced, st.MaxQueued, st.MaxWaitMs))
+	}
+	return strings.Join(parts, ", ")
+}
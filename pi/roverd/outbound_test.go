@@ -0,0 +1,161 @@
+package roverd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// newTestOutbound returns a writer on one end of a websocket and the other
+// end to read what it sends. The writer is not running yet.
+func newTestOutbound(t *testing.T) (*outbound, *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		accepted <- conn
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	peer, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { peer.CloseNow() })
+	conn := <-accepted
+	t.Cleanup(func() { conn.CloseNow() })
+	return newOutbound(conn, time.Second), peer
+}
+
+func runOutbound(t *testing.T, o *outbound) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go o.Run(ctx)
+}
+
+// readMessages reads n messages from peer.
+func readMessages(t *testing.T, peer *websocket.Conn, n int) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got []string
+	for range n {
+		_, data, err := peer.Read(ctx)
+		if err != nil {
+			t.Fatalf("read after %q: %v", got, err)
+		}
+		got = append(got, string(data))
+	}
+	return got
+}
+
+func TestOutboundSendsByPriority(t *testing.T) {
+	o, peer := newTestOutbound(t)
+	ctx := context.Background()
+	o.sendLatest("sensors", websocket.MessageText, []byte("sensors 1"))
+	if err := o.sendJSON(ctx, classEvents, "event 1"); err != nil {
+		t.Fatal(err)
+	}
+	o.sendLatest("odometry", websocket.MessageText, []byte("odometry"))
+	if err := o.sendJSON(ctx, classControl, "ack"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.sendJSON(ctx, classEvents, "event 2"); err != nil {
+		t.Fatal(err)
+	}
+	o.sendLatest("sensors", websocket.MessageText, []byte("sensors 2"))
+
+	runOutbound(t, o)
+	got := readMessages(t, peer, 5)
+	want := []string{`"ack"`, `"event 1"`, `"event 2"`, "sensors 2", "odometry"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+}
+
+func TestOutboundCountsCoalescedTelemetry(t *testing.T) {
+	o, peer := newTestOutbound(t)
+	for range 10 {
+		o.sendLatest("sensors", websocket.MessageText, []byte("frame"))
+	}
+	o.sendLatest("battery", websocket.MessageText, []byte("battery"))
+
+	st := o.Stats()[classTelemetry.String()]
+	if st.Enqueued != 11 || st.Coalesced != 9 || st.Queued != 2 || st.MaxQueued != 2 {
+		t.Fatalf("telemetry before writing: %+v", st)
+	}
+
+	runOutbound(t, o)
+	readMessages(t, peer, 2)
+	// The writer records a message after the peer has it.
+	deadline := time.Now().Add(time.Second)
+	for o.Stats()[classTelemetry.String()].Sent < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	st = o.Stats()[classTelemetry.String()]
+	if st.Sent != 2 || st.Queued != 0 || st.Coalesced != 9 || st.Bytes != uint64(len("frame")+len("battery")) {
+		t.Fatalf("telemetry after writing: %+v", st)
+	}
+}
+
+func TestOutboundFullQueueWaits(t *testing.T) {
+	o, peer := newTestOutbound(t)
+	ctx := context.Background()
+	for range outboundQueueLimit {
+		if err := o.sendJSON(ctx, classEvents, "event"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st := o.Stats()[classEvents.String()]
+	if st.Queued != outboundQueueLimit || st.MaxQueued != outboundQueueLimit {
+		t.Fatalf("events when full: %+v", st)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := o.sendJSON(short, classEvents, "event"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("send to a full queue = %v, want it to wait for room", err)
+	}
+	// A full events queue does not hold back control messages.
+	if err := o.sendJSON(short, classControl, "ack"); err != nil {
+		t.Fatalf("control send while events are full: %v", err)
+	}
+
+	sent := make(chan error, 1)
+	go func() { sent <- o.sendJSON(ctx, classEvents, "last") }()
+	runOutbound(t, o)
+	got := readMessages(t, peer, outboundQueueLimit+2)
+	if got[0] != `"ack"` || got[len(got)-1] != `"last"` {
+		t.Fatalf("sent %q first and %q last", got[0], got[len(got)-1])
+	}
+	if err := <-sent; err != nil {
+		t.Fatalf("waiting send: %v", err)
+	}
+}
+
+func TestOutboundRefusesAfterStop(t *testing.T) {
+	o, _ := newTestOutbound(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- o.Run(ctx) }()
+	cancel()
+	if err := <-stopped; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run = %v, want context.Canceled", err)
+	}
+	if err := o.sendJSON(context.Background(), classControl, "ack"); !errors.Is(err, errOutboundClosed) {
+		t.Fatalf("send after stop = %v, want errOutboundClosed", err)
+	}
+}
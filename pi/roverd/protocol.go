@@ -0,0 +1,199 @@
+package roverd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version is the roverd build, set with -ldflags "-X multiroombarover/pi/roverd.Version=...".
+var Version = "dev"
+
+const (
+	// protocolVersion is the rover protocol this roverd speaks. Version 1 is
+	// the original hello without a protocol block; servers that never answer
+	// with a serverHello are treated as version 1.
+	protocolVersion = 2
+	// minServerProtocolVersion is the oldest server protocol roverd can
+	// still work with.
+	minServerProtocolVersion = 1
+	// serverHelloWait is how long features that depend on the server's
+	// answer wait for serverHello before assuming a version 1 server.
+	serverHelloWait = 3 * time.Second
+)
+
+// negotiatedSession is what a connection agreed on in the hello exchange.
+type negotiatedSession struct {
+	protocol       int
+	sensorEncoding string
+	telemetry      string
+	// eventJournal is set when serverHello carried the server's event
+	// cursor, so events are sent with their sequence numbers and replayed.
+	eventJournal bool
+}
+
+// legacySession applies until the server answers hello, and for the whole
+// connection if it never does.
+var legacySession = negotiatedSession{
+	protocol:       1,
+	sensorEncoding: SensorEncodingJSON,
+	telemetry:      TelemetryRaw,
+}
+
+var (
+	errProtocolIncompatible = errors.New("server protocol incompatible")
+	errHelloRejected        = errors.New("server rejected hello")
+)
+
+// roverEventNames lists every event roverd can emit, advertised in hello so
+// the server does not have to infer them from the configuration. The names
+// are declared next to their emitters, grouped here the same way.
+var roverEventNames = []string{
+	eventAutoChargeFault,
+	eventAutoChargeGaveUp,
+	eventAutoChargeSeekDockError,
+	eventAutoChargeSeekDockIssued,
+	eventAutoChargeState,
+
+	eventBatteryUrgent,
+	eventBatteryWarn,
+
+	eventChargeJournalDocked,
+	eventChargeJournalUndocked,
+
+	eventConnectionConnected,
+	eventConnectionDisconnected,
+
+	eventControlClaimed,
+	eventControlReleased,
+
+	eventDriveDeadman,
+	eventSafetyBackoffDone,
+	eventSafetyStop,
+
+	eventEStopCleared,
+	eventEStopTriggered,
+
+	eventEventsDropped,
+
+	eventLinkDead,
+
+	eventLowBatteryAnnounced,
+	eventLowBatteryCancelled,
+	eventLowBatteryDocked,
+	eventLowBatteryGaveUp,
+	eventLowBatteryReleased,
+	eventLowBatterySeekDockError,
+	eventLowBatterySeekDockIssued,
+	eventLowBatterySeekDockTimeout,
+	eventLowBatteryTriggered,
+	eventLowBatteryUndocked,
+
+	eventMotionAborted,
+	eventMotionFinished,
+	eventMotionProgress,
+	eventMotionStarted,
+
+	eventOdometryReset,
+
+	eventOIError,
+	eventOIModeChanged,
+
+	eventSafetyCleared,
+	eventSafetyTriggered,
+	eventSafetyVeto,
+
+	eventStuckDetected,
+	eventStuckEscapeAborted,
+	eventStuckEscapeAttempt,
+	eventStuckEscapeFailed,
+	eventStuckEscaped,
+
+	eventDisconnectSeekDockError,
+	eventDisconnectSeekDockIssued,
+	eventDisconnectSeekDockSkipped,
+	eventProtocolNegotiated,
+	eventProtocolRejected,
+	eventSensorWatchdogError,
+	eventSensorWatchdogOK,
+	eventSensorWatchdogRestart,
+	eventTTSError,
+}
+
+// negotiateProtocol checks a serverHello against what roverd supports and
+// returns the version both sides will speak.
+func negotiateProtocol(hello *serverHelloMessage) (int, error) {
+	if !hello.Accepted {
+		reason := hello.Reason
+		if reason == "" {
+			reason = "no reason given"
+		}
+		if strings.HasPrefix(reason, authFailedReason) {
+			return 0, fmt.Errorf("%w: %w: %s", errHelloRejected, errCredentialsRefused, reason)
+		}
+		return 0, fmt.Errorf("%w: %s", errHelloRejected, reason)
+	}
+	server := hello.ProtocolVersion
+	if server <= 0 {
+		server = 1
+	}
+	if server < minServerProtocolVersion {
+		return 0, fmt.Errorf("%w: server speaks version %d, roverd needs at least %d",
+			errProtocolIncompatible, server, minServerProtocolVersion)
+	}
+	if hello.MinProtocolVersion > protocolVersion {
+		return 0, fmt.Errorf("%w: server needs at least version %d, roverd speaks %d",
+			errProtocolIncompatible, hello.MinProtocolVersion, protocolVersion)
+	}
+	return min(server, protocolVersion), nil
+}
+
+// capabilities lists the commands this rover accepts as it is configured
+// right now; commands backed by a disabled component are left out.
+func (c *WSClient) capabilities() capabilitiesInfo {
+	commands := []string{
+		"buttons",
+		"connectionStatus",
+		"digitLeds",
+		"drive",
+		"driveDirect",
+		"drivePwm",
+		"estop",
+		"estop.clear",
+		"leds",
+		"motorPwm",
+		"move",
+		"oi",
+		"outboundStats",
+		"query",
+		"raw",
+		"schedulingLeds",
+		"sensorStream",
+		"song",
+		"turn",
+	}
+	if c.journal != nil {
+		commands = append(commands, "chargeHistory")
+	}
+	if c.media != nil {
+		commands = append(commands, "media")
+	}
+	if c.servo != nil {
+		commands = append(commands, "servo")
+	}
+	if c.ttsQueue != nil {
+		commands = append(commands, "tts")
+	}
+	if c.nightVision != nil {
+		commands = append(commands, "nightVision")
+	}
+	sort.Strings(commands)
+	return capabilitiesInfo{
+		Commands:        commands,
+		Events:          roverEventNames,
+		SensorEncodings: sensorEncodings,
+		TelemetryModes:  telemetryModes,
+	}
+}
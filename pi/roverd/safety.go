@@ -0,0 +1,199 @@
+package roverd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interlock events; the stop and back-off themselves come from the deadman.
+const (
+	eventSafetyCleared   = "safety.cleared"
+	eventSafetyTriggered = "safety.triggered"
+	eventSafetyVeto      = "safety.veto"
+)
+
+// safetyVetoEventInterval rate-limits safety.veto events while a driver
+// keeps pushing towards a triggered sensor.
+const safetyVetoEventInterval = time.Second
+
+// errSafetyVeto wraps every rejection from the interlock so callers can tell
+// a vetoed command from a serial failure.
+var errSafetyVeto = errors.New("safety interlock")
+
+// safetyTrip asks the deadman to stop the wheels because a sensor fired
+// while they were moving towards it, optionally reversing briefly.
+type safetyTrip struct {
+	reason        string
+	backoffSpeed  int
+	backoffPeriod time.Duration
+}
+
+// SafetyInterlock vetoes wheel commands that move towards a triggered
+// bumper, cliff or wheel-drop sensor. It runs entirely on the rover from the
+// decoded sensor stream, so it keeps working without a server connection.
+type SafetyInterlock struct {
+	cfg    SafetyConfig
+	events chan<- RoverEvent
+	logger *log.Logger
+	tripCh chan safetyTrip
+
+	mu           sync.Mutex
+	bump         []string
+	cliff        []string
+	drop         []string
+	lastLeft     int
+	lastRight    int
+	backoffUntil time.Time
+	lastVetoEvt  time.Time
+}
+
+func NewSafetyInterlock(cfg SafetyConfig, events chan<- RoverEvent, logger *log.Logger) *SafetyInterlock {
+	return &SafetyInterlock{
+		cfg:    cfg,
+		events: events,
+		logger: logger,
+		tripCh: make(chan safetyTrip, 1),
+	}
+}
+
+func (s *SafetyInterlock) Run(ctx context.Context, samples <-chan SensorSample) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sample := <-samples:
+			s.observe(sample)
+		}
+	}
+}
+
+// Check reports whether the wheels may run at left/right (mm/s or PWM; only
+// the signs matter). Allowed commands become the motion the interlock
+// watches for newly triggered sensors.
+func (s *SafetyInterlock) Check(left, right int) error {
+	if !s.cfg.Enabled {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Now().Before(s.backoffUntil) {
+		return fmt.Errorf("%w: back-off in progress", errSafetyVeto)
+	}
+	if reason := s.vetoLocked(left, right); reason != "" {
+		if time.Since(s.lastVetoEvt) >= safetyVetoEventInterval {
+			s.lastVetoEvt = time.Now()
+			s.emitEvent(eventSafetyVeto, map[string]any{
+				"reason": reason,
+				"left":   left,
+				"right":  right,
+			})
+		}
+		return fmt.Errorf("%w: %s", errSafetyVeto, reason)
+	}
+	s.lastLeft, s.lastRight = left, right
+	return nil
+}
+
+// holdUntil rejects every command until t while a back-off runs.
+func (s *SafetyInterlock) holdUntil(t time.Time) {
+	s.mu.Lock()
+	s.backoffUntil = t
+	s.mu.Unlock()
+}
+
+// stopped tells the interlock the wheels were halted outside Check, so a
+// sensor firing afterwards does not trip a stationary rover.
+func (s *SafetyInterlock) stopped() {
+	s.mu.Lock()
+	s.lastLeft, s.lastRight = 0, 0
+	s.mu.Unlock()
+}
+
+// vetoLocked returns why left/right is not allowed, or "" if it is. Wheel
+// drops block all motion; cliffs allow only reversing; bumps allow
+// reversing and turning in place.
+func (s *SafetyInterlock) vetoLocked(left, right int) string {
+	if left == 0 && right == 0 {
+		return ""
+	}
+	if len(s.drop) > 0 {
+		return "wheel drop " + strings.Join(s.drop, ",")
+	}
+	if len(s.cliff) > 0 && (left > 0 || right > 0) {
+		return "cliff " + strings.Join(s.cliff, ",")
+	}
+	if len(s.bump) > 0 && left+right > 0 {
+		return "bump " + strings.Join(s.bump, ",")
+	}
+	return ""
+}
+
+func (s *SafetyInterlock) observe(sample SensorSample) {
+	if !s.cfg.Enabled {
+		return
+	}
+	s.mu.Lock()
+	wasClear := len(s.bump)+len(s.cliff)+len(s.drop) == 0
+	if s.cfg.Bump && sample.Has(7) {
+		s.bump = activeSensors(map[string]bool{"left": sample.BumpLeft, "right": sample.BumpRight})
+	}
+	if s.cfg.WheelDrop && sample.Has(7) {
+		s.drop = activeSensors(map[string]bool{"left": sample.WheelDropLeft, "right": sample.WheelDropRight})
+	}
+	if s.cfg.Cliff && (sample.Has(9) || sample.Has(12)) {
+		s.cliff = activeSensors(map[string]bool{
+			"left":       sample.CliffLeft,
+			"frontLeft":  sample.CliffFrontLeft,
+			"frontRight": sample.CliffFrontRight,
+			"right":      sample.CliffRight,
+		})
+	}
+	isClear := len(s.bump)+len(s.cliff)+len(s.drop) == 0
+	state := map[string]any{"bump": s.bump, "cliff": s.cliff, "wheelDrop": s.drop}
+
+	reason := s.vetoLocked(s.lastLeft, s.lastRight)
+	var trip *safetyTrip
+	if reason != "" {
+		s.lastLeft, s.lastRight = 0, 0
+		trip = &safetyTrip{reason: reason}
+		if s.cfg.Backoff && len(s.drop) == 0 {
+			trip.backoffSpeed = s.cfg.BackoffSpeed
+			trip.backoffPeriod = time.Duration(float64(s.cfg.BackoffDistanceMm) / float64(s.cfg.BackoffSpeed) * float64(time.Second))
+		}
+	}
+	s.mu.Unlock()
+
+	switch {
+	case wasClear && !isClear:
+		s.emitEvent(eventSafetyTriggered, state)
+	case !wasClear && isClear:
+		s.emitEvent(eventSafetyCleared, nil)
+	}
+	if trip != nil {
+		s.logger.Printf("safety stop: %s", trip.reason)
+		select {
+		case s.tripCh <- *trip:
+		default:
+		}
+	}
+}
+
+func activeSensors(flags map[string]bool) []string {
+	var names []string
+	for _, name := range []string{"left", "frontLeft", "frontRight", "right"} {
+		if flags[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (s *SafetyInterlock) emitEvent(event string, data map[string]any) {
+	emitRoverEvent(s.events, event, data)
+}
@@ -0,0 +1,45 @@
+package roverd
+
+import (
+	"context"
+	"sync"
+)
+
+// SampleBus fans decoded sensor samples out to every subscriber. A slow
+// subscriber misses samples instead of stalling the streamer or the others.
+type SampleBus struct {
+	mu   sync.Mutex
+	subs []chan SensorSample
+}
+
+func NewSampleBus() *SampleBus {
+	return &SampleBus{}
+}
+
+// Subscribe returns a channel that receives every sample published after
+// the call. Subscribe before Run starts to avoid missing the first frames.
+func (b *SampleBus) Subscribe(buffer int) <-chan SensorSample {
+	ch := make(chan SensorSample, buffer)
+	b.mu.Lock()
+	b.subs = append(b.subs, ch)
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *SampleBus) Run(ctx context.Context, samples <-chan SensorSample) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sample := <-samples:
+			b.mu.Lock()
+			for _, ch := range b.subs {
+				select {
+				case ch <- sample:
+				default:
+				}
+			}
+			b.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package roverd
+
+import (
+	"fmt"
+	"time"
+)
+
+func validateChecksum(buf []byte) bool {
+	var sum int
+	for _, b := range buf {
+		sum += int(b)
+	}
+	return byte(sum&0xFF) == 0
+}
+
+func calcChecksum(buf []byte) byte {
+	sum := 0
+	for _, b := range buf {
+		sum += int(b)
+	}
+	return byte((-sum) & 0xFF)
+}
+
+// decodeSensorSample parses a checksummed stream frame (header, length,
+// payload, checksum) into a SensorSample. A positive expectedLen rejects
+// frames whose payload does not match the configured packet list.
+func decodeSensorSample(frame []byte, expectedLen int) (SensorSample, error) {
+	if len(frame) < 3 {
+		return SensorSample{}, fmt.Errorf("frame too short: %d bytes", len(frame))
+	}
+	if frame[0] != sensorHeader {
+		return SensorSample{}, fmt.Errorf("unexpected frame header %d", frame[0])
+	}
+	nBytes := int(frame[1])
+	if nBytes+3 != len(frame) {
+		return SensorSample{}, fmt.Errorf("frame length %d does not match declared payload %d", len(frame), nBytes)
+	}
+	if !validateChecksum(frame) {
+		return SensorSample{}, fmt.Errorf("frame checksum mismatch")
+	}
+	payload := frame[2 : 2+nBytes]
+	if expectedLen > 0 && len(payload) != expectedLen {
+		return SensorSample{}, fmt.Errorf("payload is %d bytes, stream expects %d", len(payload), expectedLen)
+	}
+
+	var sample SensorSample
+	idx := 0
+	for idx < len(payload) {
+		id := payload[idx]
+		idx++
+		size, ok := packetSizes[id]
+		if !ok {
+			return SensorSample{}, fmt.Errorf("unknown packet id %d at offset %d", id, idx-1)
+		}
+		if idx+size > len(payload) {
+			return SensorSample{}, fmt.Errorf("packet %d truncated: need %d bytes, have %d", id, size, len(payload)-idx)
+		}
+		decodePacket(&sample, id, payload[idx:idx+size])
+		idx += size
+	}
+	sample.Timestamp = time.Now().UnixMilli()
+	return sample, nil
+}
+
+// decodeQueryReply parses the reply to Query List for packets, which is the
+// packets' data back to back without ids, header or checksum.
+func decodeQueryReply(packets []byte, data []byte) (SensorSample, error) {
+	var sample SensorSample
+	offset := 0
+	for _, id := range packets {
+		size, ok := packetSizes[id]
+		if !ok {
+			return SensorSample{}, fmt.Errorf("unknown packet id %d", id)
+		}
+		if offset+size > len(data) {
+			return SensorSample{}, fmt.Errorf("packet %d truncated: need %d bytes, have %d", id, size, len(data)-offset)
+		}
+		decodePacket(&sample, id, data[offset:offset+size])
+		offset += size
+	}
+	sample.Timestamp = time.Now().UnixMilli()
+	return sample, nil
+}
+
+func decodePacket(sample *SensorSample, id byte, data []byte) {
+	members, isGroup := packetGroups[id]
+	if !isGroup {
+		packetDecoders[id](sample, data)
+		sample.present[id] = true
+		return
+	}
+	offset := 0
+	for _, member := range members {
+		size := packetSizes[member]
+		decodePacket(sample, member, data[offset:offset+size])
+		offset += size
+	}
+}
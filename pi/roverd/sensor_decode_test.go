@@ -0,0 +1,267 @@
+package roverd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// streamFrame wraps payload in the stream header, length and checksum.
+func streamFrame(payload ...byte) []byte {
+	frame := append([]byte{sensorHeader, byte(len(payload))}, payload...)
+	return append(frame, calcChecksum(frame))
+}
+
+// groupData lays out the data bytes of group the way the Roomba sends them,
+// taking each member's bytes from values and zero-filling the rest.
+func groupData(t *testing.T, group byte, values map[byte][]byte) []byte {
+	t.Helper()
+	var data []byte
+	for _, id := range packetGroups[group] {
+		v, ok := values[id]
+		if !ok {
+			v = make([]byte, packetSizes[id])
+		}
+		if len(v) != packetSizes[id] {
+			t.Fatalf("packet %d value is %d bytes, want %d", id, len(v), packetSizes[id])
+		}
+		data = append(data, v...)
+	}
+	return data
+}
+
+func TestPacketGroupSizes(t *testing.T) {
+	// Sizes from the Create 2 OI spec.
+	want := map[byte]int{0: 26, 1: 10, 2: 6, 3: 10, 4: 14, 5: 12, 6: 52, 100: 80, 101: 28, 106: 12, 107: 9}
+	for group, size := range want {
+		if got := packetSizes[group]; got != size {
+			t.Errorf("group %d is %d bytes, want %d", group, got, size)
+		}
+	}
+	for group := range packetGroups {
+		if _, ok := want[group]; !ok {
+			t.Errorf("group %d has no expected size", group)
+		}
+	}
+}
+
+func TestDecodeGroupsMarkMembersPresent(t *testing.T) {
+	for _, group := range []byte{0, 1, 2, 3, 4, 5, 6, 100, 101, 106, 107} {
+		t.Run(fmt.Sprintf("group %d", group), func(t *testing.T) {
+			payload := append([]byte{group}, groupData(t, group, nil)...)
+			sample, err := decodeSensorSample(streamFrame(payload...), len(payload))
+			if err != nil {
+				t.Fatalf("group %d: %v", group, err)
+			}
+			members := packetGroups[group]
+			for id := byte(7); id <= 58; id++ {
+				if want := slices.Contains(members, id); sample.Has(id) != want {
+					t.Errorf("group %d: Has(%d) = %v, want %v", group, id, sample.Has(id), want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeGroup100Fields(t *testing.T) {
+	values := map[byte][]byte{
+		7:  {0x0f},       // both bumps and both wheel drops
+		9:  {1},          // cliff left
+		14: {0x18},       // wheel overcurrents
+		18: {0x05},       // clean and dock buttons
+		19: {0xff, 0xfb}, // distance -5 mm
+		20: {0x00, 0x5a}, // angle 90°
+		21: {2},          // full charging
+		22: {0x3a, 0x98}, // 15000 mV
+		23: {0xfb, 0x50}, // -1200 mA
+		24: {0xfd},       // -3 °C
+		25: {0x08, 0x14}, // 2068 mAh
+		26: {0x08, 0x14},
+		34: {0x02},       // home base
+		35: {2},          // safe
+		39: {0xfe, 0x0c}, // -500 mm/s
+		40: {0x80, 0x00}, // straight: -32768
+		43: {0xff, 0xff}, // encoder at the top of its range
+		44: {0x00, 0x01},
+		45: {0x3f},
+		51: {0x0f, 0xff},
+		54: {0xff, 0x9c}, // -100 mA
+		55: {0x01, 0x2c}, // 300 mA
+		58: {1},
+	}
+	payload := append([]byte{100}, groupData(t, 100, values)...)
+	s, err := decodeSensorSample(streamFrame(payload...), len(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"BumpRight", s.BumpRight, true},
+		{"BumpLeft", s.BumpLeft, true},
+		{"WheelDropRight", s.WheelDropRight, true},
+		{"WheelDropLeft", s.WheelDropLeft, true},
+		{"Wall", s.Wall, false},
+		{"CliffLeft", s.CliffLeft, true},
+		{"CliffRight", s.CliffRight, false},
+		{"Overcurrents", s.Overcurrents, byte(0x18)},
+		{"Buttons", s.Buttons, byte(0x05)},
+		{"DistanceMm", s.DistanceMm, int16(-5)},
+		{"AngleDeg", s.AngleDeg, int16(90)},
+		{"ChargingState", s.ChargingState, byte(2)},
+		{"VoltageMv", s.VoltageMv, uint16(15000)},
+		{"CurrentMa", s.CurrentMa, int16(-1200)},
+		{"TemperatureC", s.TemperatureC, int8(-3)},
+		{"BatteryChargeMah", s.BatteryChargeMah, uint16(2068)},
+		{"BatteryCapacityMah", s.BatteryCapacityMah, uint16(2068)},
+		{"ChargeSources", s.ChargeSources, byte(sourceHomeBase)},
+		{"OIMode", s.OIMode, byte(oiModeSafe)},
+		{"RequestedVelocity", s.RequestedVelocity, int16(-500)},
+		{"RequestedRadius", s.RequestedRadius, int16(-32768)},
+		{"EncoderLeft", s.EncoderLeft, uint16(65535)},
+		{"EncoderRight", s.EncoderRight, uint16(1)},
+		{"LightBumper", s.LightBumper, byte(0x3f)},
+		{"LightBumpRightSignal", s.LightBumpRightSignal, uint16(4095)},
+		{"LeftMotorCurrentMa", s.LeftMotorCurrentMa, int16(-100)},
+		{"RightMotorCurrentMa", s.RightMotorCurrentMa, int16(300)},
+		{"Stasis", s.Stasis, byte(1)},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestDecodeSmallGroupsOffsets(t *testing.T) {
+	tests := []struct {
+		group  byte
+		values map[byte][]byte
+		check  func(s SensorSample) bool
+	}{
+		{2, map[byte][]byte{17: {161}, 19: {0x01, 0x00}, 20: {0xff, 0xa6}},
+			func(s SensorSample) bool { return s.IROmni == 161 && s.DistanceMm == 256 && s.AngleDeg == -90 }},
+		{3, map[byte][]byte{21: {4}, 26: {0x0b, 0xb8}},
+			func(s SensorSample) bool { return s.ChargingState == 4 && s.BatteryCapacityMah == 3000 }},
+		{4, map[byte][]byte{27: {0x00, 0x10}, 34: {0x01}},
+			func(s SensorSample) bool { return s.WallSignal == 16 && s.ChargeSources == 1 }},
+		{5, map[byte][]byte{35: {2}, 37: {1}, 42: {0x00, 0xc8}},
+			func(s SensorSample) bool { return s.OIMode == 2 && s.SongPlaying && s.RequestedLeftVelocity == 200 }},
+		{101, map[byte][]byte{43: {0x12, 0x34}, 52: {168}, 58: {1}},
+			func(s SensorSample) bool { return s.EncoderLeft == 0x1234 && s.IRLeft == 168 && s.Stasis == 1 }},
+		{106, map[byte][]byte{46: {0x00, 0x01}, 51: {0x00, 0x06}},
+			func(s SensorSample) bool { return s.LightBumpLeftSignal == 1 && s.LightBumpRightSignal == 6 }},
+		{107, map[byte][]byte{54: {0x80, 0x00}, 57: {0x7f, 0xff}, 58: {1}},
+			func(s SensorSample) bool {
+				return s.LeftMotorCurrentMa == -32768 && s.SideBrushCurrentMa == 32767 && s.Stasis == 1
+			}},
+	}
+	for _, tt := range tests {
+		payload := append([]byte{tt.group}, groupData(t, tt.group, tt.values)...)
+		s, err := decodeSensorSample(streamFrame(payload...), 0)
+		if err != nil {
+			t.Fatalf("group %d: %v", tt.group, err)
+		}
+		if !tt.check(s) {
+			t.Errorf("group %d decoded to %+v", tt.group, s)
+		}
+	}
+}
+
+func TestDecodeSeveralPacketsInOneFrame(t *testing.T) {
+	payload := []byte{21, 3, 43, 0xff, 0xfe, 35, 3}
+	s, err := decodeSensorSample(streamFrame(payload...), len(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Has(21) || !s.Has(43) || !s.Has(35) || s.Has(44) {
+		t.Fatalf("present packets wrong: %v", s.present)
+	}
+	if s.ChargingState != 3 || s.EncoderLeft != 65534 || s.OIMode != oiModeFull {
+		t.Fatalf("decoded %+v", s)
+	}
+}
+
+func TestInt16Wrap(t *testing.T) {
+	for _, tt := range []struct {
+		b    []byte
+		want int16
+	}{
+		{[]byte{0x00, 0x00}, 0},
+		{[]byte{0x7f, 0xff}, 32767},
+		{[]byte{0x80, 0x00}, -32768},
+		{[]byte{0xff, 0xff}, -1},
+		{[]byte{0xfe, 0x0c}, -500},
+	} {
+		if got := int16BE(tt.b); got != tt.want {
+			t.Errorf("int16BE(% x) = %d, want %d", tt.b, got, tt.want)
+		}
+		if got := uint16BE(tt.b); got != uint16(tt.want) {
+			t.Errorf("uint16BE(% x) = %d, want %d", tt.b, got, uint16(tt.want))
+		}
+	}
+}
+
+func TestDecodeSensorSampleErrors(t *testing.T) {
+	good := streamFrame(35, 3)
+	badChecksum := append([]byte(nil), good...)
+	badChecksum[len(badChecksum)-1]++
+	tests := []struct {
+		name     string
+		frame    []byte
+		expected int
+		err      string
+	}{
+		{"short", []byte{19, 0}, 0, "too short"},
+		{"header", append([]byte{20}, good[1:]...), 0, "header"},
+		{"length", append(good, 0), 0, "does not match"},
+		{"checksum", badChecksum, 0, "checksum"},
+		{"unknown packet", streamFrame(99, 0), 0, "unknown packet id 99"},
+		{"truncated", streamFrame(43, 1), 0, "truncated"},
+		{"stream mismatch", good, 4, "stream expects 4"},
+	}
+	for _, tt := range tests {
+		if _, err := decodeSensorSample(tt.frame, tt.expected); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestDecodeQueryReply(t *testing.T) {
+	s, err := decodeQueryReply([]byte{7, 25, 43}, []byte{0x01, 0x06, 0x40, 0x00, 0x05})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.BumpRight || s.BatteryChargeMah != 1600 || s.EncoderLeft != 5 || !s.Has(43) {
+		t.Fatalf("decoded %+v", s)
+	}
+	if _, err := decodeQueryReply([]byte{43}, []byte{0x01}); err == nil {
+		t.Fatal("truncated reply accepted")
+	}
+	if _, err := decodeQueryReply([]byte{99}, nil); err == nil {
+		t.Fatal("unknown packet accepted")
+	}
+}
+
+func TestStreamSettingsKeepNeededPackets(t *testing.T) {
+	cfg := &Config{Safety: SafetyConfig{Enabled: true, Cliff: true}}
+	needed := cfg.StreamPacketsNeeded()
+	s, err := NewStreamSettings(SensorStreamConfig{Packets: []int{100}}, needed)
+	if err != nil {
+		t.Fatalf("group 100: %v", err)
+	}
+	if err := s.SetPackets([]int{7, 21, 34}); err == nil || !strings.Contains(err.Error(), "9 (safety)") || !strings.Contains(err.Error(), "43 (odometry)") {
+		t.Fatalf("list without cliffs or encoders: err = %v", err)
+	}
+	if got := s.Packets(); !slices.Equal(got, []byte{100}) {
+		t.Fatalf("refused list replaced packets: %v", got)
+	}
+	if err := s.SetPackets([]int{1, 3, 43, 44}); err != nil {
+		t.Fatalf("groups 1 and 3 with the encoders: %v", err)
+	}
+	if _, err := NewStreamSettings(SensorStreamConfig{Packets: []int{3, 101}}, needed); err == nil {
+		t.Fatal("list without cliffs accepted")
+	}
+}
@@ -1,23 +1,315 @@
 package roverd
 
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
 var (
-	defaultStreamPackets = []byte{100, 21, 34}
-	packetSizes          = map[byte]int{
-		100: 80,
-		21:  1,
-		34:  1,
-	}
-	expectedPayloadLength = func() int {
-		sum := 0
-		for _, id := range defaultStreamPackets {
-			sum += 1 + packetSizes[id]
+	// packetGroups lists the single packets each group id expands to, in
+	// the order the Roomba sends them.
+	packetGroups = map[byte][]byte{
+		0:   packetRange(7, 26),
+		1:   packetRange(7, 16),
+		2:   packetRange(17, 20),
+		3:   packetRange(21, 26),
+		4:   packetRange(27, 34),
+		5:   packetRange(35, 42),
+		6:   packetRange(7, 42),
+		100: packetRange(7, 58),
+		101: packetRange(43, 58),
+		106: packetRange(46, 51),
+		107: packetRange(54, 58),
+	}
+	packetSizes = func() map[byte]int {
+		sizes := map[byte]int{
+			7: 1, 8: 1, 9: 1, 10: 1, 11: 1, 12: 1, 13: 1, 14: 1, 15: 1, 16: 1,
+			17: 1, 18: 1, 19: 2, 20: 2, 21: 1, 22: 2, 23: 2, 24: 1, 25: 2, 26: 2,
+			27: 2, 28: 2, 29: 2, 30: 2, 31: 2, 32: 1, 33: 2, 34: 1, 35: 1, 36: 1,
+			37: 1, 38: 1, 39: 2, 40: 2, 41: 2, 42: 2, 43: 2, 44: 2, 45: 1, 46: 2,
+			47: 2, 48: 2, 49: 2, 50: 2, 51: 2, 52: 1, 53: 1, 54: 2, 55: 2, 56: 2,
+			57: 2, 58: 1,
+		}
+		for id, members := range packetGroups {
+			total := 0
+			for _, member := range members {
+				total += sizes[member]
+			}
+			sizes[id] = total
 		}
-		return sum
+		return sizes
 	}()
 )
 
+// StreamSettings is the packet list and forwarding interval shared by the
+// sensor streamer, the decoder and the websocket client. It can be changed
+// at runtime through the sensorStream command, but never to a list that
+// leaves out a packet in needed.
+type StreamSettings struct {
+	needed map[byte]string
+
+	mu         sync.RWMutex
+	packets    []byte
+	payloadLen int
+	interval   time.Duration
+}
+
+// NewStreamSettings starts from cfg. needed maps each packet an enabled
+// component reads to that component's name; see Config.StreamPacketsNeeded.
+func NewStreamSettings(cfg SensorStreamConfig, needed map[byte]string) (*StreamSettings, error) {
+	s := &StreamSettings{needed: needed, interval: cfg.Interval.Duration}
+	if err := s.setPackets(cfg.Packets); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *StreamSettings) Packets() []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]byte(nil), s.packets...)
+}
+
+// PayloadLength is the frame payload size the Roomba sends for the current
+// packet list.
+func (s *StreamSettings) PayloadLength() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.payloadLen
+}
+
+func (s *StreamSettings) Interval() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.interval
+}
+
+func (s *StreamSettings) SetPackets(ids []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.setPackets(ids)
+}
+
+func (s *StreamSettings) SetInterval(interval time.Duration) {
+	if interval < 0 {
+		interval = 0
+	}
+	s.mu.Lock()
+	s.interval = interval
+	s.mu.Unlock()
+}
+
+func (s *StreamSettings) setPackets(ids []int) error {
+	packets, err := streamPacketList(ids)
+	if err != nil {
+		return err
+	}
+	if err := checkStreamPackets(packets, s.needed); err != nil {
+		return err
+	}
+	s.packets = packets
+	s.payloadLen = streamPayloadLength(packets)
+	return nil
+}
+
+func streamPacketList(ids []int) ([]byte, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("sensor stream requires packets")
+	}
+	packets := make([]byte, 0, len(ids))
+	for _, id := range ids {
+		if id < 0 || id > 255 {
+			return nil, fmt.Errorf("invalid packet id %d", id)
+		}
+		if _, ok := packetSizes[byte(id)]; !ok {
+			return nil, fmt.Errorf("unknown packet id %d", id)
+		}
+		packets = append(packets, byte(id))
+	}
+	if n := streamPayloadLength(packets); n > 255 {
+		return nil, fmt.Errorf("packets need %d bytes per frame, stream allows 255", n)
+	}
+	return packets, nil
+}
+
+// checkStreamPackets refuses a packet list that, with its groups expanded,
+// leaves out a packet in needed.
+func checkStreamPackets(packets []byte, needed map[byte]string) error {
+	streamed := make(map[byte]bool)
+	for _, id := range packets {
+		streamed[id] = true
+		for _, member := range packetGroups[id] {
+			streamed[member] = true
+		}
+	}
+	var missing []string
+	for _, id := range slices.Sorted(maps.Keys(needed)) {
+		if !streamed[id] {
+			missing = append(missing, fmt.Sprintf("%d (%s)", id, needed[id]))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("packet list leaves out %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func streamPayloadLength(packets []byte) int {
+	sum := 0
+	for _, id := range packets {
+		sum += 1 + packetSizes[id]
+	}
+	return sum
+}
+
+func packetRange(first, last byte) []byte {
+	ids := make([]byte, 0, int(last-first)+1)
+	for id := first; id <= last; id++ {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// SensorSample holds one decoded sensor frame. Only the packets reported by
+// Has carry data; the rest are zero. Units follow the OI spec: mm, mm/s,
+// degrees, mV, mA, mAh and degrees Celsius.
 type SensorSample struct {
-	Timestamp     int64
-	ChargingState byte
-	ChargeSources byte
+	Timestamp int64
+
+	BumpRight       bool
+	BumpLeft        bool
+	WheelDropRight  bool
+	WheelDropLeft   bool
+	Wall            bool
+	CliffLeft       bool
+	CliffFrontLeft  bool
+	CliffFrontRight bool
+	CliffRight      bool
+	VirtualWall     bool
+	Overcurrents    byte
+	DirtDetect      byte
+	IROmni          byte
+	Buttons         byte
+	DistanceMm      int16
+	AngleDeg        int16
+
+	ChargingState      byte
+	VoltageMv          uint16
+	CurrentMa          int16
+	TemperatureC       int8
+	BatteryChargeMah   uint16
+	BatteryCapacityMah uint16
+
+	WallSignal            uint16
+	CliffLeftSignal       uint16
+	CliffFrontLeftSignal  uint16
+	CliffFrontRightSignal uint16
+	CliffRightSignal      uint16
+	ChargeSources         byte
+	OIMode                byte
+	SongNumber            byte
+	SongPlaying           bool
+	StreamPackets         byte
+
+	RequestedVelocity      int16
+	RequestedRadius        int16
+	RequestedRightVelocity int16
+	RequestedLeftVelocity  int16
+	EncoderLeft            uint16
+	EncoderRight           uint16
+
+	LightBumper                byte
+	LightBumpLeftSignal        uint16
+	LightBumpFrontLeftSignal   uint16
+	LightBumpCenterLeftSignal  uint16
+	LightBumpCenterRightSignal uint16
+	LightBumpFrontRightSignal  uint16
+	LightBumpRightSignal       uint16
+	IRLeft                     byte
+	IRRight                    byte
+	LeftMotorCurrentMa         int16
+	RightMotorCurrentMa        int16
+	MainBrushCurrentMa         int16
+	SideBrushCurrentMa         int16
+	Stasis                     byte
+
+	present [59]bool
+}
+
+// Has reports whether packet id was part of the decoded frame.
+func (s *SensorSample) Has(id byte) bool {
+	return int(id) < len(s.present) && s.present[id]
+}
+
+var packetDecoders = map[byte]func(*SensorSample, []byte){
+	7: func(s *SensorSample, b []byte) {
+		s.BumpRight = b[0]&0x01 != 0
+		s.BumpLeft = b[0]&0x02 != 0
+		s.WheelDropRight = b[0]&0x04 != 0
+		s.WheelDropLeft = b[0]&0x08 != 0
+	},
+	8:  func(s *SensorSample, b []byte) { s.Wall = b[0] != 0 },
+	9:  func(s *SensorSample, b []byte) { s.CliffLeft = b[0] != 0 },
+	10: func(s *SensorSample, b []byte) { s.CliffFrontLeft = b[0] != 0 },
+	11: func(s *SensorSample, b []byte) { s.CliffFrontRight = b[0] != 0 },
+	12: func(s *SensorSample, b []byte) { s.CliffRight = b[0] != 0 },
+	13: func(s *SensorSample, b []byte) { s.VirtualWall = b[0] != 0 },
+	14: func(s *SensorSample, b []byte) { s.Overcurrents = b[0] },
+	15: func(s *SensorSample, b []byte) { s.DirtDetect = b[0] },
+	16: func(s *SensorSample, b []byte) {}, // unused byte
+	17: func(s *SensorSample, b []byte) { s.IROmni = b[0] },
+	18: func(s *SensorSample, b []byte) { s.Buttons = b[0] },
+	19: func(s *SensorSample, b []byte) { s.DistanceMm = int16BE(b) },
+	20: func(s *SensorSample, b []byte) { s.AngleDeg = int16BE(b) },
+	21: func(s *SensorSample, b []byte) { s.ChargingState = b[0] },
+	22: func(s *SensorSample, b []byte) { s.VoltageMv = uint16BE(b) },
+	23: func(s *SensorSample, b []byte) { s.CurrentMa = int16BE(b) },
+	24: func(s *SensorSample, b []byte) { s.TemperatureC = int8(b[0]) },
+	25: func(s *SensorSample, b []byte) { s.BatteryChargeMah = uint16BE(b) },
+	26: func(s *SensorSample, b []byte) { s.BatteryCapacityMah = uint16BE(b) },
+	27: func(s *SensorSample, b []byte) { s.WallSignal = uint16BE(b) },
+	28: func(s *SensorSample, b []byte) { s.CliffLeftSignal = uint16BE(b) },
+	29: func(s *SensorSample, b []byte) { s.CliffFrontLeftSignal = uint16BE(b) },
+	30: func(s *SensorSample, b []byte) { s.CliffFrontRightSignal = uint16BE(b) },
+	31: func(s *SensorSample, b []byte) { s.CliffRightSignal = uint16BE(b) },
+	32: func(s *SensorSample, b []byte) {}, // unused
+	33: func(s *SensorSample, b []byte) {}, // unused
+	34: func(s *SensorSample, b []byte) { s.ChargeSources = b[0] },
+	35: func(s *SensorSample, b []byte) { s.OIMode = b[0] },
+	36: func(s *SensorSample, b []byte) { s.SongNumber = b[0] },
+	37: func(s *SensorSample, b []byte) { s.SongPlaying = b[0] != 0 },
+	38: func(s *SensorSample, b []byte) { s.StreamPackets = b[0] },
+	39: func(s *SensorSample, b []byte) { s.RequestedVelocity = int16BE(b) },
+	40: func(s *SensorSample, b []byte) { s.RequestedRadius = int16BE(b) },
+	41: func(s *SensorSample, b []byte) { s.RequestedRightVelocity = int16BE(b) },
+	42: func(s *SensorSample, b []byte) { s.RequestedLeftVelocity = int16BE(b) },
+	43: func(s *SensorSample, b []byte) { s.EncoderLeft = uint16BE(b) },
+	44: func(s *SensorSample, b []byte) { s.EncoderRight = uint16BE(b) },
+	45: func(s *SensorSample, b []byte) { s.LightBumper = b[0] },
+	46: func(s *SensorSample, b []byte) { s.LightBumpLeftSignal = uint16BE(b) },
+	47: func(s *SensorSample, b []byte) { s.LightBumpFrontLeftSignal = uint16BE(b) },
+	48: func(s *SensorSample, b []byte) { s.LightBumpCenterLeftSignal = uint16BE(b) },
+	49: func(s *SensorSample, b []byte) { s.LightBumpCenterRightSignal = uint16BE(b) },
+	50: func(s *SensorSample, b []byte) { s.LightBumpFrontRightSignal = uint16BE(b) },
+	51: func(s *SensorSample, b []byte) { s.LightBumpRightSignal = uint16BE(b) },
+	52: func(s *SensorSample, b []byte) { s.IRLeft = b[0] },
+	53: func(s *SensorSample, b []byte) { s.IRRight = b[0] },
+	54: func(s *SensorSample, b []byte) { s.LeftMotorCurrentMa = int16BE(b) },
+	55: func(s *SensorSample, b []byte) { s.RightMotorCurrentMa = int16BE(b) },
+	56: func(s *SensorSample, b []byte) { s.MainBrushCurrentMa = int16BE(b) },
+	57: func(s *SensorSample, b []byte) { s.SideBrushCurrentMa = int16BE(b) },
+	58: func(s *SensorSample, b []byte) { s.Stasis = b[0] },
+}
+
+func uint16BE(b []byte) uint16 {
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+func int16BE(b []byte) int16 {
+	return int16(uint16BE(b))
 }
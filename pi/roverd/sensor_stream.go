@@ -8,29 +8,41 @@ import (
 	"encoding/hex"
 	"io"
 	"log"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	sensorHeader          = 19
-	sensorReadTimeout     = 150 * time.Millisecond
-	sensorThrottleMinimum = 50 * time.Millisecond
+	sensorHeader      = 19
+	sensorReadTimeout = 150 * time.Millisecond
+	// sensorErrorLogEvery limits decode failures, which repeat on every
+	// frame until the stream matches the packet list, to one log line.
+	sensorErrorLogEvery = 5 * time.Second
 )
 
 type SensorStreamer struct {
-	r      io.Reader
-	rawOut chan<- []byte
-	parsed chan<- SensorSample
-	logger *log.Logger
+	r        io.Reader
+	settings *StreamSettings
+	rawOut   chan<- []byte
+	parsed   chan<- SensorSample
+	logger   *log.Logger
+	reply    atomic.Pointer[sensorReply]
 }
 
-func NewSensorStreamer(r io.Reader, rawOut chan<- []byte, parsed chan<- SensorSample, logger *log.Logger) *SensorStreamer {
-	return &SensorStreamer{r: r, rawOut: rawOut, parsed: parsed, logger: logger}
+// sensorReply is a query reply the reader has been told to expect.
+type sensorReply struct {
+	length int
+	done   chan []byte
+}
+
+func NewSensorStreamer(r io.Reader, settings *StreamSettings, rawOut chan<- []byte, parsed chan<- SensorSample, logger *log.Logger) *SensorStreamer {
+	return &SensorStreamer{r: r, settings: settings, rawOut: rawOut, parsed: parsed, logger: logger}
 }
 
 func (s *SensorStreamer) Run(ctx context.Context) {
 	reader := bufio.NewReader(s.r)
-	var nextSend time.Time
+	var nextSend, lastDecodeLog time.Time
+	decodeFailures := 0
 	for {
 		select {
 		case <-ctx.Done():
@@ -45,6 +57,15 @@ func (s *SensorStreamer) Run(ctx context.Context) {
 			}
 			continue
 		}
+		if reply := s.reply.Swap(nil); reply != nil {
+			data := make([]byte, reply.length)
+			data[0] = header
+			if _, err := io.ReadFull(reader, data[1:]); err != nil {
+				data = nil
+			}
+			reply.done <- data
+			continue
+		}
 		if header != sensorHeader {
 			continue
 		}
@@ -64,73 +85,41 @@ func (s *SensorStreamer) Run(ctx context.Context) {
 			continue
 		}
 
+		// Every frame is decoded for the on-rover consumers; only the
+		// websocket forwarding is throttled to the interval.
 		now := time.Now()
-		if !nextSend.IsZero() && now.Before(nextSend) {
-			continue
-		}
-		nextSend = now.Add(sensorThrottleMinimum)
-
-		select {
-		case s.rawOut <- frame:
-		default:
+		if nextSend.IsZero() || !now.Before(nextSend) {
+			nextSend = now.Add(s.settings.Interval())
+			select {
+			case s.rawOut <- frame:
+			default:
+			}
 		}
 
 		if s.parsed != nil {
-			if sample, ok := decodeSensorSample(frame); ok {
-				select {
-				case s.parsed <- sample:
-				default:
+			sample, err := decodeSensorSample(frame, s.settings.PayloadLength())
+			if err != nil {
+				decodeFailures++
+				if now.Sub(lastDecodeLog) >= sensorErrorLogEvery {
+					s.logger.Printf("sensor decode failed (%d frames since last report): %v", decodeFailures, err)
+					lastDecodeLog, decodeFailures = now, 0
 				}
+				continue
+			}
+			select {
+			case s.parsed <- sample:
+			default:
 			}
 		}
 	}
 }
 
-func validateChecksum(buf []byte) bool {
-	var sum int
-	for _, b := range buf {
-		sum += int(b)
-	}
-	return byte(sum&0xFF) == 0
-}
-
-func decodeSensorSample(frame []byte) (SensorSample, bool) {
-	if len(frame) < 3 {
-		return SensorSample{}, false
-	}
-	nBytes := int(frame[1])
-	if nBytes+3 != len(frame) {
-		return SensorSample{}, false
-	}
-	payload := frame[2 : 2+nBytes]
-	if len(payload) != expectedPayloadLength {
-		return SensorSample{}, false
-	}
-
-	idx := 0
-	var sample SensorSample
-	var seen byte
-	for idx < len(payload) {
-		id := payload[idx]
-		idx++
-		size, ok := packetSizes[id]
-		if !ok {
-			return SensorSample{}, false
-		}
-		if idx+size > len(payload) {
-			return SensorSample{}, false
-		}
-		segment := payload[idx : idx+size]
-		switch id {
-		case 21:
-			sample.ChargingState = segment[0]
-			seen |= 1
-		case 34:
-			sample.ChargeSources = segment[0]
-			seen |= 2
-		}
-		idx += size
-	}
-	sample.Timestamp = time.Now().UnixMilli()
-	return sample, seen&3 == 3
+// expectReply makes the next length bytes read a query reply instead of
+// stream data. The caller pauses the stream and lets it drain first, since
+// a reply has no header to find it by. The channel receives nil if the
+// reply was cut short; cancel withdraws the request if it never came.
+func (s *SensorStreamer) expectReply(length int) (reply <-chan []byte, cancel func()) {
+	r := &sensorReply{length: length, done: make(chan []byte, 1)}
+	s.reply.Store(r)
+	return r.done, func() { s.reply.CompareAndSwap(r, nil) }
 }
@@ -12,13 +12,14 @@ import (
 const sensorHeader = 19
 
 type SensorStreamer struct {
-	rawOut chan<- []byte
-	parsed chan<- SensorSample
-	logger *log.Logger
+	settings *StreamSettings
+	rawOut   chan<- []byte
+	parsed   chan<- SensorSample
+	logger   *log.Logger
 }
 
-func NewSensorStreamer(_ interface{}, rawOut chan<- []byte, parsed chan<- SensorSample, logger *log.Logger) *SensorStreamer {
-	return &SensorStreamer{rawOut: rawOut, parsed: parsed, logger: logger}
+func NewSensorStreamer(_ interface{}, settings *StreamSettings, rawOut chan<- []byte, parsed chan<- SensorSample, logger *log.Logger) *SensorStreamer {
+	return &SensorStreamer{settings: settings, rawOut: rawOut, parsed: parsed, logger: logger}
 }
 
 func (s *SensorStreamer) Run(ctx context.Context) {
@@ -29,15 +30,15 @@ func (s *SensorStreamer) Run(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			frame := buildDummyFrame()
+			frame := buildDummyFrame(s.settings.Packets())
 			select {
 			case s.rawOut <- frame:
 			default:
 			}
-			sample := SensorSample{
-				Timestamp:     time.Now().UnixMilli(),
-				ChargingState: 3,    // trickle charging
-				ChargeSources: 0b10, // home base present
+			sample, err := decodeSensorSample(frame, 0)
+			if err != nil {
+				s.logger.Printf("[dummy] sensor decode failed: %v", err)
+				continue
 			}
 			select {
 			case s.parsed <- sample:
@@ -47,14 +48,12 @@ func (s *SensorStreamer) Run(ctx context.Context) {
 	}
 }
 
-func buildDummyFrame() []byte {
-	payload := make([]byte, 0, expectedPayloadLength)
-	payload = append(payload, 100)
-	group := make([]byte, packetSizes[100])
-	group[0] = byte(rand.Intn(16)) // bumps
-	payload = append(payload, group...)
-	payload = append(payload, 21, 3)
-	payload = append(payload, 34, 0b10)
+func buildDummyFrame(packets []byte) []byte {
+	payload := make([]byte, 0, streamPayloadLength(packets))
+	for _, id := range packets {
+		payload = append(payload, id)
+		payload = append(payload, dummyPacket(id)...)
+	}
 
 	buf := make([]byte, 0, len(payload)+3)
 	buf = append(buf, sensorHeader, byte(len(payload)))
@@ -64,10 +63,31 @@ func buildDummyFrame() []byte {
 	return buf
 }
 
-func calcChecksum(buf []byte) byte {
-	sum := 0
-	for _, b := range buf {
-		sum += int(b)
+func dummyPacket(id byte) []byte {
+	if members, ok := packetGroups[id]; ok {
+		var data []byte
+		for _, member := range members {
+			data = append(data, dummyPacket(member)...)
+		}
+		return data
+	}
+	data := make([]byte, packetSizes[id])
+	switch id {
+	case 7:
+		data[0] = byte(rand.Intn(16)) // bumps
+	case 21:
+		data[0] = 3 // trickle charging
+	case 34:
+		data[0] = 0b10 // home base present
+	case 35:
+		data[0] = oiModePassive
 	}
-	return byte((-sum) & 0xFF)
+	return data
+}
+
+// expectReply answers at once with zeroed packet data.
+func (s *SensorStreamer) expectReply(length int) (reply <-chan []byte, cancel func()) {
+	done := make(chan []byte, 1)
+	done <- make([]byte, length)
+	return done, func() {}
 }
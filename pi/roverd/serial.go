@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"sync"
 
 	"github.com/tarm/serial"
@@ -20,7 +21,13 @@ type SerialAdapter struct {
 	log     *log.Logger
 }
 
-func OpenSerial(cfg SerialConfig) (*serial.Port, error) {
+// OpenSerial opens the Roomba's serial port, or an in-process OI simulator
+// when serial.simulate is set.
+func OpenSerial(cfg SerialConfig) (io.ReadWriteCloser, error) {
+	if cfg.Simulate {
+		sim := NewOISimulator(OISimOptions{}, log.New(os.Stdout, "oisim: ", log.LstdFlags|log.Lmicroseconds|log.LUTC))
+		return sim.Pipe(), nil
+	}
 	return serial.OpenPort(&serial.Config{
 		Name:        cfg.Device,
 		Baud:        cfg.Baud,
@@ -122,3 +129,96 @@ func (s *SerialAdapter) PlaySong(slot int, notes []songNote) error {
 	}
 	return s.write([]byte{141, byte(slot)})
 }
+
+func (s *SerialAdapter) SafeMode() error {
+	return s.write([]byte{131})
+}
+
+func (s *SerialAdapter) FullMode() error {
+	return s.write([]byte{132})
+}
+
+// PassiveMode re-sends Start, which is how the OI returns to Passive from
+// Safe or Full.
+func (s *SerialAdapter) PassiveMode() error {
+	return s.write([]byte{128})
+}
+
+func (s *SerialAdapter) Reset() error {
+	return s.write([]byte{7})
+}
+
+func (s *SerialAdapter) Stop() error {
+	return s.write([]byte{173})
+}
+
+func (s *SerialAdapter) Power() error {
+	return s.write([]byte{133})
+}
+
+func (s *SerialAdapter) Clean() error {
+	return s.write([]byte{135})
+}
+
+func (s *SerialAdapter) Spot() error {
+	return s.write([]byte{134})
+}
+
+func (s *SerialAdapter) MaxClean() error {
+	return s.write([]byte{136})
+}
+
+func (s *SerialAdapter) Drive(velocity, radius int) error {
+	payload := []byte{137}
+	payload = appendInt16(payload, velocity)
+	payload = appendInt16(payload, radius)
+	return s.write(payload)
+}
+
+func (s *SerialAdapter) DrivePWM(left, right int) error {
+	payload := []byte{146}
+	payload = appendInt16(payload, right)
+	payload = appendInt16(payload, left)
+	return s.write(payload)
+}
+
+func (s *SerialAdapter) SetLEDs(bits byte, color, intensity int) error {
+	return s.write([]byte{139, bits, byte(color & 0xFF), byte(intensity & 0xFF)})
+}
+
+func (s *SerialAdapter) SetSchedulingLEDs(weekdays, leds byte) error {
+	return s.write([]byte{162, weekdays, leds})
+}
+
+// SetDigitLEDsRaw drives the four 7-segment digits left to right; each byte
+// is a segment bitmask.
+func (s *SerialAdapter) SetDigitLEDsRaw(digits [4]byte) error {
+	return s.write([]byte{163, digits[0], digits[1], digits[2], digits[3]})
+}
+
+func (s *SerialAdapter) SetDigitLEDsASCII(text string) error {
+	chars, err := digitASCII(text)
+	if err != nil {
+		return err
+	}
+	return s.write([]byte{164, chars[0], chars[1], chars[2], chars[3]})
+}
+
+func (s *SerialAdapter) PressButtons(buttons byte) error {
+	return s.write([]byte{165, buttons})
+}
+
+// QuerySensor asks for a single packet. The reply carries no stream header,
+// so it is only picked up by readers that expect it.
+func (s *SerialAdapter) QuerySensor(packet byte) error {
+	return s.write([]byte{142, packet})
+}
+
+func (s *SerialAdapter) QueryList(packets []byte) error {
+	if len(packets) == 0 {
+		return errors.New("query list requires packets")
+	}
+	payload := []byte{149, byte(len(packets))}
+	payload = append(payload, packets...)
+	return s.write(payload)
+}
@@ -66,3 +66,100 @@ func (s *SerialAdapter) PlaySong(slot int, notes []songNote) error {
 	s.log.Printf("[dummy] play song slot=%d notes=%v", slot, notes)
 	return nil
 }
+
+func (s *SerialAdapter) SafeMode() error {
+	s.log.Printf("[dummy] safe mode")
+	return nil
+}
+
+func (s *SerialAdapter) FullMode() error {
+	s.log.Printf("[dummy] full mode")
+	return nil
+}
+
+func (s *SerialAdapter) PassiveMode() error {
+	s.log.Printf("[dummy] passive mode")
+	return nil
+}
+
+func (s *SerialAdapter) Reset() error {
+	s.log.Printf("[dummy] reset")
+	return nil
+}
+
+func (s *SerialAdapter) Stop() error {
+	s.log.Printf("[dummy] stop OI")
+	return nil
+}
+
+func (s *SerialAdapter) Power() error {
+	s.log.Printf("[dummy] power down")
+	return nil
+}
+
+func (s *SerialAdapter) Clean() error {
+	s.log.Printf("[dummy] clean")
+	return nil
+}
+
+func (s *SerialAdapter) Spot() error {
+	s.log.Printf("[dummy] spot")
+	return nil
+}
+
+func (s *SerialAdapter) MaxClean() error {
+	s.log.Printf("[dummy] max clean")
+	return nil
+}
+
+func (s *SerialAdapter) Drive(velocity, radius int) error {
+	s.log.Printf("[dummy] drive velocity=%d radius=%d", velocity, radius)
+	return nil
+}
+
+func (s *SerialAdapter) DrivePWM(left, right int) error {
+	s.log.Printf("[dummy] drive pwm L=%d R=%d", left, right)
+	return nil
+}
+
+func (s *SerialAdapter) SetLEDs(bits byte, color, intensity int) error {
+	s.log.Printf("[dummy] leds bits=%08b color=%d intensity=%d", bits, color, intensity)
+	return nil
+}
+
+func (s *SerialAdapter) SetSchedulingLEDs(weekdays, leds byte) error {
+	s.log.Printf("[dummy] scheduling leds weekdays=%07b leds=%05b", weekdays, leds)
+	return nil
+}
+
+func (s *SerialAdapter) SetDigitLEDsRaw(digits [4]byte) error {
+	s.log.Printf("[dummy] digit leds raw %v", digits)
+	return nil
+}
+
+func (s *SerialAdapter) SetDigitLEDsASCII(text string) error {
+	chars, err := digitASCII(text)
+	if err != nil {
+		return err
+	}
+	s.log.Printf("[dummy] digit leds %q", string(chars[:]))
+	return nil
+}
+
+func (s *SerialAdapter) PressButtons(buttons byte) error {
+	s.log.Printf("[dummy] buttons %08b", buttons)
+	return nil
+}
+
+func (s *SerialAdapter) QuerySensor(packet byte) error {
+	s.log.Printf("[dummy] query packet %d", packet)
+	return nil
+}
+
+func (s *SerialAdapter) QueryList(packets []byte) error {
+	if len(packets) == 0 {
+		return errors.New("query list requires packets")
+	}
+	s.log.Printf("[dummy] query list %v", packets)
+	return nil
+}
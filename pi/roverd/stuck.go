@@ -0,0 +1,310 @@
+package roverd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Stuck detection and escape events.
+const (
+	eventStuckDetected      = "stuck.detected"
+	eventStuckEscapeAborted = "stuck.escapeAborted"
+	eventStuckEscapeAttempt = "stuck.escapeAttempt"
+	eventStuckEscapeFailed  = "stuck.escapeFailed"
+	eventStuckEscaped       = "stuck.escaped"
+)
+
+const (
+	// stuckOvercurrentWheels are the left (bit 4) and right (bit 3) wheel
+	// overcurrent flags in packet 14.
+	stuckOvercurrentWheels = 0x18
+	// stasisProgress is set in packet 58 while the caster reports forward
+	// progress; stasisDisabled means the sensor cannot be trusted.
+	stasisProgress = 0x01
+	stasisDisabled = 0x02
+)
+
+var errStuckEscape = errors.New("stuck escape in progress; send a stop to take over")
+
+// StuckDetector notices a rover that keeps driving its wheels without
+// getting anywhere: wheel overcurrent (packet 14), high wheel motor current
+// (54/55) or no forward progress on the stasis caster (58) for longer than
+// the detection window. It stops the wheels and can run an escape routine
+// of reverse, rotate and a short forward retry before handing control back.
+type StuckDetector struct {
+	cfg     StuckConfig
+	deadman *DriveDeadman
+	motion  *MotionController
+	events  chan<- RoverEvent
+	logger  *log.Logger
+
+	mu        sync.Mutex
+	ctx       context.Context
+	since     time.Time
+	escaping  bool
+	aborted   string
+	rotateDir float64
+}
+
+func NewStuckDetector(cfg StuckConfig, deadman *DriveDeadman, motion *MotionController, events chan<- RoverEvent, logger *log.Logger) *StuckDetector {
+	d := &StuckDetector{
+		cfg:       cfg,
+		deadman:   deadman,
+		motion:    motion,
+		events:    events,
+		logger:    logger,
+		rotateDir: 1,
+	}
+	deadman.onEmergencyStop(d.abortEscape)
+	return d
+}
+
+func (d *StuckDetector) Run(ctx context.Context, samples <-chan SensorSample) {
+	d.mu.Lock()
+	d.ctx = ctx
+	d.mu.Unlock()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sample := <-samples:
+			d.observe(sample)
+		}
+	}
+}
+
+// Escaping reports whether an escape routine currently owns the wheels.
+func (d *StuckDetector) Escaping() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.escaping
+}
+
+// CheckDriver is called before a driver command takes the wheels. Moving
+// commands are refused while an escape runs; a stop aborts the escape and
+// hands the wheels back.
+func (d *StuckDetector) CheckDriver(moving bool) error {
+	d.mu.Lock()
+	if !d.escaping {
+		d.mu.Unlock()
+		return nil
+	}
+	if moving {
+		d.mu.Unlock()
+		return errStuckEscape
+	}
+	d.aborted = "driver stop"
+	d.mu.Unlock()
+	d.motion.Cancel("stuck escape aborted by driver", false)
+	return nil
+}
+
+// abortEscape ends a running escape for an emergency stop. The motion in
+// progress is cancelled by the stop itself.
+func (d *StuckDetector) abortEscape() {
+	d.mu.Lock()
+	if d.escaping && d.aborted == "" {
+		d.aborted = "emergency stop"
+	}
+	d.mu.Unlock()
+}
+
+func (d *StuckDetector) observe(sample SensorSample) {
+	if !d.cfg.Enabled {
+		return
+	}
+	left, right := d.deadman.Commanded()
+	now := time.Now()
+
+	d.mu.Lock()
+	if left == 0 && right == 0 {
+		d.since = time.Time{}
+		d.mu.Unlock()
+		return
+	}
+	var reasons []string
+	checked := false
+	if d.cfg.Overcurrent && sample.Has(14) {
+		checked = true
+		if sample.Overcurrents&stuckOvercurrentWheels != 0 {
+			reasons = append(reasons, "overcurrent")
+		}
+	}
+	if d.cfg.WheelCurrentMa > 0 && sample.Has(54) && sample.Has(55) {
+		checked = true
+		if max(absInt(int(sample.LeftMotorCurrentMa)), absInt(int(sample.RightMotorCurrentMa))) >= d.cfg.WheelCurrentMa {
+			reasons = append(reasons, "wheelCurrent")
+		}
+	}
+	// The caster only turns when driving forward, so stasis says nothing
+	// about reversing or spinning in place.
+	if d.cfg.Stasis && sample.Has(58) && left > 0 && right > 0 && sample.Stasis&stasisDisabled == 0 {
+		checked = true
+		if sample.Stasis&stasisProgress == 0 {
+			reasons = append(reasons, "stasis")
+		}
+	}
+	if !checked {
+		d.mu.Unlock()
+		return
+	}
+	if len(reasons) == 0 {
+		d.since = time.Time{}
+		d.mu.Unlock()
+		return
+	}
+	if d.since.IsZero() {
+		d.since = now
+	}
+	if now.Sub(d.since) < d.cfg.DetectAfter.Duration {
+		d.mu.Unlock()
+		return
+	}
+	d.since = time.Time{}
+	escaping := d.escaping
+	startEscape := d.cfg.Escape && !escaping && d.ctx != nil
+	if startEscape {
+		d.escaping = true
+		d.aborted = ""
+	}
+	ctx := d.ctx
+	d.mu.Unlock()
+
+	if escaping {
+		// Stuck again during the escape: fail this step and let the
+		// routine move on to the next attempt.
+		d.motion.Cancel("stuck", true)
+		return
+	}
+
+	d.motion.Cancel("stuck", false)
+	if err := d.deadman.DriveDirect(0, 0, 0); err != nil {
+		d.logger.Printf("stuck stop failed: %v", err)
+	}
+	d.logger.Printf("stuck detected (%v) while driving %d/%d", reasons, left, right)
+	data := map[string]any{
+		"reasons": reasons,
+		"left":    left,
+		"right":   right,
+		"escape":  startEscape,
+	}
+	if sample.Has(54) && sample.Has(55) {
+		data["leftCurrentMa"] = sample.LeftMotorCurrentMa
+		data["rightCurrentMa"] = sample.RightMotorCurrentMa
+	}
+	if sample.Has(14) {
+		data["overcurrents"] = sample.Overcurrents
+	}
+	d.emitEvent(eventStuckDetected, data)
+	if startEscape {
+		go d.escape(ctx)
+	}
+}
+
+// escape tries up to EscapeAttempts times to back out, turn away and drive
+// forward again, alternating the turn direction between attempts.
+func (d *StuckDetector) escape(ctx context.Context) {
+	started := time.Now()
+	defer func() {
+		d.mu.Lock()
+		d.escaping = false
+		d.mu.Unlock()
+	}()
+
+	var err error
+	for attempt := 1; attempt <= d.cfg.EscapeAttempts; attempt++ {
+		d.mu.Lock()
+		dir := d.rotateDir
+		d.rotateDir = -dir
+		d.mu.Unlock()
+
+		d.emitEvent(eventStuckEscapeAttempt, map[string]any{"attempt": attempt})
+		if err = d.escapeAttempt(ctx, attempt, dir); err == nil {
+			d.logger.Printf("stuck escape succeeded on attempt %d", attempt)
+			d.emitEvent(eventStuckEscaped, map[string]any{
+				"attempt":    attempt,
+				"durationMs": time.Since(started).Milliseconds(),
+			})
+			return
+		}
+		d.mu.Lock()
+		aborted := d.aborted
+		d.mu.Unlock()
+		if aborted == "" && (errors.Is(err, errEStopLatched) || ctx.Err() != nil) {
+			aborted = err.Error()
+		}
+		if aborted == "" && d.deadman.CheckEStop() != nil {
+			// The stop latched and cancelled the step before abortEscape ran.
+			aborted = "emergency stop"
+		}
+		if aborted != "" {
+			d.logger.Printf("stuck escape aborted: %s", aborted)
+			d.emitEvent(eventStuckEscapeAborted, map[string]any{"attempt": attempt, "reason": aborted})
+			return
+		}
+		d.logger.Printf("stuck escape attempt %d failed: %v", attempt, err)
+	}
+	d.emitEvent(eventStuckEscapeFailed, map[string]any{
+		"attempts":   d.cfg.EscapeAttempts,
+		"error":      err.Error(),
+		"durationMs": time.Since(started).Milliseconds(),
+	})
+}
+
+func (d *StuckDetector) escapeAttempt(ctx context.Context, attempt int, dir float64) error {
+	speed := d.cfg.EscapeSpeed
+	id := fmt.Sprintf("stuck-escape-%d", attempt)
+	steps := []func() (<-chan error, error){
+		func() (<-chan error, error) { return d.motion.Move(id+"-reverse", -d.cfg.ReverseMm, speed) },
+		func() (<-chan error, error) { return d.motion.Turn(id+"-rotate", dir*d.cfg.RotateDeg, speed) },
+	}
+	if d.cfg.RetryMm > 0 {
+		steps = append(steps, func() (<-chan error, error) { return d.motion.Move(id+"-retry", d.cfg.RetryMm, speed) })
+	}
+	for _, step := range steps {
+		d.mu.Lock()
+		aborted := d.aborted
+		d.mu.Unlock()
+		if aborted != "" {
+			return errors.New(aborted)
+		}
+		done, err := step()
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			d.motion.Cancel("shutdown", true)
+			return ctx.Err()
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *StuckDetector) stuckInfo() stuckInfo {
+	return stuckInfo{
+		Enabled:        d.cfg.Enabled,
+		Escape:         d.cfg.Escape,
+		EscapeAttempts: d.cfg.EscapeAttempts,
+		Escaping:       d.Escaping(),
+	}
+}
+
+func (d *StuckDetector) emitEvent(event string, data map[string]any) {
+	emitRoverEvent(d.events, event, data)
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
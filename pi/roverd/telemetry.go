@@ -0,0 +1,257 @@
+package roverd
+
+// Telemetry modes a server can pick in its serverHello: raw sends the
+// sensor frame in the negotiated encoding, decoded sends a telemetryMessage
+// instead and both sends the two with the same sequence number.
+const (
+	TelemetryRaw     = "raw"
+	TelemetryDecoded = "decoded"
+	TelemetryBoth    = "both"
+)
+
+var telemetryModes = []string{TelemetryRaw, TelemetryDecoded, TelemetryBoth}
+
+// chooseTelemetryMode accepts the server's pick if roverd offers it and
+// falls back to raw frames otherwise.
+func chooseTelemetryMode(requested string) string {
+	for _, mode := range telemetryModes {
+		if mode == requested {
+			return mode
+		}
+	}
+	return TelemetryRaw
+}
+
+// telemetryMessage is a sensor frame decoded into named fields with units
+// in the field names. Groups are left out when the stream does not carry
+// their packets.
+type telemetryMessage struct {
+	Type          string                  `json:"type"`
+	Timestamp     int64                   `json:"ts"`
+	Seq           uint32                  `json:"seq"`
+	Bumps         *telemetryLeftRight     `json:"bumps,omitempty"`
+	WheelDrops    *telemetryLeftRight     `json:"wheelDrops,omitempty"`
+	Wall          *bool                   `json:"wall,omitempty"`
+	Cliffs        *telemetryCliffs        `json:"cliffs,omitempty"`
+	VirtualWall   *bool                   `json:"virtualWall,omitempty"`
+	Overcurrents  *telemetryOvercurrents  `json:"overcurrents,omitempty"`
+	DirtDetect    *int                    `json:"dirtDetect,omitempty"`
+	Buttons       *telemetryButtons       `json:"buttons,omitempty"`
+	DistanceMm    *int                    `json:"distanceMm,omitempty"`
+	AngleDeg      *int                    `json:"angleDeg,omitempty"`
+	Battery       *telemetryBattery       `json:"battery,omitempty"`
+	ChargeSources *telemetryChargeSources `json:"chargeSources,omitempty"`
+	OIMode        string                  `json:"oiMode,omitempty"`
+	Velocity      *telemetryVelocity      `json:"velocity,omitempty"`
+	Encoders      *telemetryEncoders      `json:"encoders,omitempty"`
+	LightBumper   *telemetryLightBumper   `json:"lightBumper,omitempty"`
+	MotorCurrents *telemetryMotorCurrents `json:"motorCurrents,omitempty"`
+	Stasis        *telemetryStasis        `json:"stasis,omitempty"`
+}
+
+type telemetryLeftRight struct {
+	Left  bool `json:"left"`
+	Right bool `json:"right"`
+}
+
+type telemetryCliffs struct {
+	Left       *bool `json:"left,omitempty"`
+	FrontLeft  *bool `json:"frontLeft,omitempty"`
+	FrontRight *bool `json:"frontRight,omitempty"`
+	Right      *bool `json:"right,omitempty"`
+}
+
+type telemetryOvercurrents struct {
+	LeftWheel  bool `json:"leftWheel"`
+	RightWheel bool `json:"rightWheel"`
+	MainBrush  bool `json:"mainBrush"`
+	SideBrush  bool `json:"sideBrush"`
+}
+
+type telemetryButtons struct {
+	Clean    bool `json:"clean"`
+	Spot     bool `json:"spot"`
+	Dock     bool `json:"dock"`
+	Minute   bool `json:"minute"`
+	Hour     bool `json:"hour"`
+	Day      bool `json:"day"`
+	Schedule bool `json:"schedule"`
+	Clock    bool `json:"clock"`
+}
+
+type telemetryBattery struct {
+	ChargingState     *int     `json:"chargingState,omitempty"`
+	ChargingStateName string   `json:"chargingStateName,omitempty"`
+	VoltageV          *float64 `json:"voltageV,omitempty"`
+	CurrentA          *float64 `json:"currentA,omitempty"`
+	TemperatureC      *int     `json:"temperatureC,omitempty"`
+	ChargeMah         *int     `json:"chargeMah,omitempty"`
+	CapacityMah       *int     `json:"capacityMah,omitempty"`
+}
+
+type telemetryChargeSources struct {
+	Internal bool `json:"internal"`
+	HomeBase bool `json:"homeBase"`
+}
+
+type telemetryVelocity struct {
+	RequestedMmS      *int `json:"requestedMmS,omitempty"`
+	RequestedRadiusMm *int `json:"requestedRadiusMm,omitempty"`
+	LeftMmS           *int `json:"leftMmS,omitempty"`
+	RightMmS          *int `json:"rightMmS,omitempty"`
+}
+
+type telemetryEncoders struct {
+	Left  *int `json:"left,omitempty"`
+	Right *int `json:"right,omitempty"`
+}
+
+type telemetryLightBumper struct {
+	Left        bool `json:"left"`
+	FrontLeft   bool `json:"frontLeft"`
+	CenterLeft  bool `json:"centerLeft"`
+	CenterRight bool `json:"centerRight"`
+	FrontRight  bool `json:"frontRight"`
+	Right       bool `json:"right"`
+}
+
+type telemetryMotorCurrents struct {
+	LeftWheelA  *float64 `json:"leftWheelA,omitempty"`
+	RightWheelA *float64 `json:"rightWheelA,omitempty"`
+	MainBrushA  *float64 `json:"mainBrushA,omitempty"`
+	SideBrushA  *float64 `json:"sideBrushA,omitempty"`
+}
+
+type telemetryStasis struct {
+	Progress bool `json:"progress"`
+	Disabled bool `json:"disabled"`
+}
+
+func newTelemetryMessage(s *SensorSample, ts int64, seq uint32) telemetryMessage {
+	msg := telemetryMessage{Type: "telemetry", Timestamp: ts, Seq: seq}
+	if s.Has(7) {
+		msg.Bumps = &telemetryLeftRight{Left: s.BumpLeft, Right: s.BumpRight}
+		msg.WheelDrops = &telemetryLeftRight{Left: s.WheelDropLeft, Right: s.WheelDropRight}
+	}
+	if s.Has(8) {
+		msg.Wall = ptr(s.Wall)
+	}
+	if s.Has(9) || s.Has(10) || s.Has(11) || s.Has(12) {
+		msg.Cliffs = &telemetryCliffs{
+			Left:       optional(s.Has(9), s.CliffLeft),
+			FrontLeft:  optional(s.Has(10), s.CliffFrontLeft),
+			FrontRight: optional(s.Has(11), s.CliffFrontRight),
+			Right:      optional(s.Has(12), s.CliffRight),
+		}
+	}
+	if s.Has(13) {
+		msg.VirtualWall = ptr(s.VirtualWall)
+	}
+	if s.Has(14) {
+		msg.Overcurrents = &telemetryOvercurrents{
+			LeftWheel:  s.Overcurrents&0x10 != 0,
+			RightWheel: s.Overcurrents&0x08 != 0,
+			MainBrush:  s.Overcurrents&0x04 != 0,
+			SideBrush:  s.Overcurrents&0x01 != 0,
+		}
+	}
+	if s.Has(15) {
+		msg.DirtDetect = ptr(int(s.DirtDetect))
+	}
+	if s.Has(18) {
+		b := s.Buttons
+		msg.Buttons = &telemetryButtons{
+			Clean:    b&0x01 != 0,
+			Spot:     b&0x02 != 0,
+			Dock:     b&0x04 != 0,
+			Minute:   b&0x08 != 0,
+			Hour:     b&0x10 != 0,
+			Day:      b&0x20 != 0,
+			Schedule: b&0x40 != 0,
+			Clock:    b&0x80 != 0,
+		}
+	}
+	if s.Has(19) {
+		msg.DistanceMm = ptr(int(s.DistanceMm))
+	}
+	if s.Has(20) {
+		msg.AngleDeg = ptr(int(s.AngleDeg))
+	}
+	if s.Has(21) || s.Has(22) || s.Has(23) || s.Has(24) || s.Has(25) || s.Has(26) {
+		bat := &telemetryBattery{
+			ChargingState: optional(s.Has(21), int(s.ChargingState)),
+			VoltageV:      optional(s.Has(22), milli(int(s.VoltageMv))),
+			CurrentA:      optional(s.Has(23), milli(int(s.CurrentMa))),
+			TemperatureC:  optional(s.Has(24), int(s.TemperatureC)),
+			ChargeMah:     optional(s.Has(25), int(s.BatteryChargeMah)),
+			CapacityMah:   optional(s.Has(26), int(s.BatteryCapacityMah)),
+		}
+		if s.Has(21) {
+			bat.ChargingStateName = chargingStateName(s.ChargingState)
+		}
+		msg.Battery = bat
+	}
+	if s.Has(34) {
+		msg.ChargeSources = &telemetryChargeSources{
+			Internal: s.ChargeSources&0x01 != 0,
+			HomeBase: s.ChargeSources&sourceHomeBase != 0,
+		}
+	}
+	if s.Has(35) {
+		msg.OIMode = oiModeName(s.OIMode)
+	}
+	if s.Has(39) || s.Has(40) || s.Has(41) || s.Has(42) {
+		msg.Velocity = &telemetryVelocity{
+			RequestedMmS:      optional(s.Has(39), int(s.RequestedVelocity)),
+			RequestedRadiusMm: optional(s.Has(40), int(s.RequestedRadius)),
+			RightMmS:          optional(s.Has(41), int(s.RequestedRightVelocity)),
+			LeftMmS:           optional(s.Has(42), int(s.RequestedLeftVelocity)),
+		}
+	}
+	if s.Has(43) || s.Has(44) {
+		msg.Encoders = &telemetryEncoders{
+			Left:  optional(s.Has(43), int(s.EncoderLeft)),
+			Right: optional(s.Has(44), int(s.EncoderRight)),
+		}
+	}
+	if s.Has(45) {
+		b := s.LightBumper
+		msg.LightBumper = &telemetryLightBumper{
+			Left:        b&0x01 != 0,
+			FrontLeft:   b&0x02 != 0,
+			CenterLeft:  b&0x04 != 0,
+			CenterRight: b&0x08 != 0,
+			FrontRight:  b&0x10 != 0,
+			Right:       b&0x20 != 0,
+		}
+	}
+	if s.Has(54) || s.Has(55) || s.Has(56) || s.Has(57) {
+		msg.MotorCurrents = &telemetryMotorCurrents{
+			LeftWheelA:  optional(s.Has(54), milli(int(s.LeftMotorCurrentMa))),
+			RightWheelA: optional(s.Has(55), milli(int(s.RightMotorCurrentMa))),
+			MainBrushA:  optional(s.Has(56), milli(int(s.MainBrushCurrentMa))),
+			SideBrushA:  optional(s.Has(57), milli(int(s.SideBrushCurrentMa))),
+		}
+	}
+	if s.Has(58) {
+		msg.Stasis = &telemetryStasis{
+			Progress: s.Stasis&stasisProgress != 0,
+			Disabled: s.Stasis&stasisDisabled != 0,
+		}
+	}
+	return msg
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func optional[T any](present bool, v T) *T {
+	if !present {
+		return nil
+	}
+	return &v
+}
+
+// milli converts milliamps or millivolts to amps or volts.
+func milli(v int) float64 {
+	return float64(v) / 1000
+}
@@ -9,10 +9,16 @@ import (
 )
 
 func (c *WSClient) handleTTSPayload(ctx context.Context, payload *ttsPayload) error {
+	return speakTTS(ctx, c.cfg.Audio, payload)
+}
+
+// speakTTS runs the configured TTS engine for payload. It does not need a
+// server connection, so rover-side policies can announce themselves.
+func speakTTS(ctx context.Context, audio AudioConfig, payload *ttsPayload) error {
 	if payload == nil {
 		return fmt.Errorf("tts payload required")
 	}
-	if !c.cfg.Audio.TTSEnabled {
+	if !audio.TTSEnabled {
 		return fmt.Errorf("tts disabled on rover")
 	}
 	if payload.Speak == false {
@@ -28,7 +34,7 @@ func (c *WSClient) handleTTSPayload(ctx context.Context, payload *ttsPayload) er
 
 	engine := strings.ToLower(strings.TrimSpace(payload.Engine))
 	if engine == "" {
-		engine = strings.ToLower(strings.TrimSpace(c.cfg.Audio.DefaultEngine))
+		engine = strings.ToLower(strings.TrimSpace(audio.DefaultEngine))
 	}
 	if engine == "" {
 		engine = "flite"
@@ -36,11 +42,11 @@ func (c *WSClient) handleTTSPayload(ctx context.Context, payload *ttsPayload) er
 
 	voice := strings.TrimSpace(payload.Voice)
 	if voice == "" {
-		voice = strings.TrimSpace(c.cfg.Audio.DefaultVoice)
+		voice = strings.TrimSpace(audio.DefaultVoice)
 	}
 	pitch := payload.Pitch
 	if pitch <= 0 {
-		pitch = c.cfg.Audio.DefaultPitch
+		pitch = audio.DefaultPitch
 	}
 	pitch = clampInt(pitch, 0, 99)
 
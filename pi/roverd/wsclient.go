@@ -4,23 +4,53 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"nhooyr.io/websocket"
 )
 
+// Events the client emits for the session, the watchdog and commands.
+const (
+	eventDisconnectSeekDockError   = "disconnect.seekDockError"
+	eventDisconnectSeekDockIssued  = "disconnect.seekDockIssued"
+	eventDisconnectSeekDockSkipped = "disconnect.seekDockSkipped"
+	eventProtocolNegotiated        = "protocol.negotiated"
+	eventProtocolRejected          = "protocol.rejected"
+	eventSensorWatchdogError       = "sensorWatchdog.error"
+	eventSensorWatchdogOK          = "sensorWatchdog.ok"
+	eventSensorWatchdogRestart     = "sensorWatchdog.restart"
+	eventTTSError                  = "tts.error"
+)
+
 type WSClient struct {
 	cfg          *Config
 	adapter      *SerialAdapter
+	deadman      *DriveDeadman
+	modes        *OIModeTracker
+	odometry     *Odometry
+	battery      *BatteryEstimator
+	motion       *MotionController
+	stuck        *StuckDetector
+	lowBattery   *LowBatteryPolicy
+	autoCharge   *AutoChargeController
+	journal      *ChargeJournal
+	stream       *StreamSettings
+	streamer     *SensorStreamer
 	sensorFrames <-chan []byte
 	events       chan RoverEvent
+	eventJournal *EventJournal
 	media        *MediaSupervisor
 	servo        *CameraServo
 	nightVision  *NightVisionLight
 	log          *log.Logger
+	queryMu      sync.Mutex
 	recoverMu    sync.Mutex
 	recovering   bool
 	ttsQueue     chan *ttsPayload
@@ -28,50 +58,128 @@ type WSClient struct {
 	connected    bool
 	disconnectT  *time.Timer
 	seekIssued   bool
+	protoMu      sync.Mutex
+	negotiated   negotiatedSession
+	answered     chan struct{}
+	linkMu       sync.Mutex
+	link         connectionStatus
+	linkOut      *outbound
+	linkMonitor  *linkMonitor
+	control      *controlArbiter
 }
 
-func NewWSClient(cfg *Config, adapter *SerialAdapter, frames <-chan []byte, events chan RoverEvent, media *MediaSupervisor, servo *CameraServo, nightVision *NightVisionLight, logger *log.Logger) *WSClient {
+// WSClientDeps are the rover components the client commands and reports
+// on. Journal, Media, Servo and NightVision are nil when disabled.
+type WSClientDeps struct {
+	Adapter      *SerialAdapter
+	Deadman      *DriveDeadman
+	Modes        *OIModeTracker
+	Odometry     *Odometry
+	Battery      *BatteryEstimator
+	Motion       *MotionController
+	Stuck        *StuckDetector
+	LowBattery   *LowBatteryPolicy
+	AutoCharge   *AutoChargeController
+	Journal      *ChargeJournal
+	Stream       *StreamSettings
+	Streamer     *SensorStreamer
+	SensorFrames <-chan []byte
+	Events       chan RoverEvent
+	EventJournal *EventJournal
+	Media        *MediaSupervisor
+	Servo        *CameraServo
+	NightVision  *NightVisionLight
+}
+
+func NewWSClient(cfg *Config, deps WSClientDeps, logger *log.Logger) *WSClient {
 	var ttsQueue chan *ttsPayload
 	if cfg.Audio.TTSEnabled {
 		ttsQueue = make(chan *ttsPayload, 2)
 	}
 	return &WSClient{
 		cfg:          cfg,
-		adapter:      adapter,
-		sensorFrames: frames,
-		events:       events,
-		media:        media,
-		servo:        servo,
-		nightVision:  nightVision,
+		adapter:      deps.Adapter,
+		deadman:      deps.Deadman,
+		modes:        deps.Modes,
+		odometry:     deps.Odometry,
+		battery:      deps.Battery,
+		motion:       deps.Motion,
+		stuck:        deps.Stuck,
+		lowBattery:   deps.LowBattery,
+		autoCharge:   deps.AutoCharge,
+		journal:      deps.Journal,
+		stream:       deps.Stream,
+		streamer:     deps.Streamer,
+		sensorFrames: deps.SensorFrames,
+		events:       deps.Events,
+		eventJournal: deps.EventJournal,
+		media:        deps.Media,
+		servo:        deps.Servo,
+		nightVision:  deps.NightVision,
 		log:          logger,
 		ttsQueue:     ttsQueue,
+		control:      newControlArbiter(cfg.LocalAPI.ControlLease.Duration, deps.Events),
 	}
 }
 
-func (c *WSClient) Run(ctx context.Context) error {
-	conn, _, err := websocket.Dial(ctx, c.cfg.ServerURL, nil)
+// Run holds one connection to serverURL until it fails or ctx ends. Serve
+// calls it for each attempt.
+func (c *WSClient) Run(ctx context.Context, serverURL string) error {
+	opts, err := c.dialOptions()
+	if err != nil {
+		c.markDisconnected()
+		return err
+	}
+	conn, resp, err := websocket.Dial(ctx, serverURL, opts)
 	if err != nil {
 		c.markDisconnected()
+		if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			return fmt.Errorf("%w: %w", errCredentialsRefused, err)
+		}
 		return err
 	}
 	c.markConnected()
+	answered := c.resetSession()
 	defer conn.Close(websocket.StatusInternalError, "closed")
 	defer c.markDisconnected()
+	defer c.control.release(controllerUpstream, "disconnected")
+
+	// Everything started for this connection stops with it.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	if err := c.sendHello(ctx, conn); err != nil {
+	auth, err := c.helloAuthFor(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if err := c.sendHello(ctx, conn, auth); err != nil {
 		return err
 	}
 	if err := c.ensureSensorStream(); err != nil {
 		c.log.Printf("sensor stream init failed: %v", err)
 	}
 
-	errCh := make(chan error, 1)
-	c.startTTSWorker(ctx)
+	out := newOutbound(conn, c.cfg.Connection.WriteTimeout.Duration)
+	monitor := newLinkMonitor(c.cfg.Connection.HeartbeatInterval.Duration, c.cfg.Connection.MissedHeartbeats)
+	c.linkConnected(out, monitor)
+	defer func() {
+		c.log.Printf("outbound queues at disconnect: %s", formatOutboundStats(out.Stats()))
+	}()
+
+	errCh := make(chan error, 3)
+	go func() {
+		errCh <- out.Run(ctx)
+	}()
+	go func() {
+		errCh <- c.readLoop(ctx, conn, out, monitor)
+	}()
 	go func() {
-		errCh <- c.readLoop(ctx, conn)
+		errCh <- c.heartbeat(ctx, conn, out, monitor)
 	}()
-	go c.forwardSensors(ctx, conn)
-	go c.forwardEvents(ctx, conn)
+	go c.forwardSensors(ctx, out)
+	go c.forwardOdometry(ctx, out)
+	go c.forwardBattery(ctx, out)
+	go c.forwardEvents(ctx, out, answered)
 
 	select {
 	case <-ctx.Done():
@@ -82,22 +190,45 @@ func (c *WSClient) Run(ctx context.Context) error {
 	}
 }
 
-func (c *WSClient) sendHello(ctx context.Context, conn *websocket.Conn) error {
+func (c *WSClient) sendHello(ctx context.Context, conn *websocket.Conn, auth *helloAuth) error {
 	msg := helloMessage{
-		Type:          "hello",
-		Name:          c.cfg.Name,
+		Type:    "hello",
+		Name:    c.cfg.Name,
+		Version: Version,
+		Auth:    auth,
+		Protocol: protocolInfo{
+			Version:          protocolVersion,
+			MinServerVersion: minServerProtocolVersion,
+		},
+		Capabilities:  c.capabilities(),
 		Battery:       c.cfg.Battery,
 		MaxWheelSpeed: c.cfg.MaxWheelMMs,
 		Media:         c.cfg.Media,
 		CameraServo:   c.cfg.CameraServo,
 		Audio:         c.cfg.Audio,
 		NightVision:   c.cfg.NightVision,
+		Drive: driveInfo{
+			DeadmanTimeoutMs:   c.deadman.Timeout().Milliseconds(),
+			AccelMmS2:          c.cfg.Drive.AccelMmS2,
+			DecelMmS2:          c.cfg.Drive.DecelMmS2,
+			EmergencyDecelMmS2: c.cfg.Drive.EmergencyDecelMmS2,
+			ControlRateHz:      c.cfg.Drive.ControlRateHz,
+		},
+		SensorStream: c.sensorStreamInfo(),
+		OI:           c.oiInfo(),
+		Safety:       c.cfg.Safety,
+		EStop:        c.deadman.estopInfo(),
+		Stuck:        c.stuck.stuckInfo(),
+		LowBattery:   c.lowBattery.lowBatteryInfo(),
+		AutoCharge:   c.autoCharge.autoChargeInfo(),
+		EventJournal: c.eventJournal.eventJournalInfo(),
 	}
-	c.log.Printf("sending hello (camera servo enabled=%v pin=%d)", msg.CameraServo.Enabled, msg.CameraServo.Pin)
+	msg.EStop.Button = c.cfg.EStop.ButtonEnabled
+	c.log.Printf("sending hello (roverd %s, protocol %d, camera servo enabled=%v pin=%d)", Version, protocolVersion, msg.CameraServo.Enabled, msg.CameraServo.Pin)
 	return writeJSON(ctx, conn, msg)
 }
 
-func (c *WSClient) readLoop(ctx context.Context, conn *websocket.Conn) error {
+func (c *WSClient) readLoop(ctx context.Context, conn *websocket.Conn, out *outbound, monitor *linkMonitor) error {
 	for {
 		_, data, err := conn.Read(ctx)
 		if err != nil {
@@ -108,56 +239,250 @@ func (c *WSClient) readLoop(ctx context.Context, conn *websocket.Conn) error {
 			c.log.Printf("invalid command: %v", err)
 			continue
 		}
+		if msg.Type == "serverHello" {
+			if err := c.handleServerHello(data); err != nil {
+				conn.Close(websocket.StatusPolicyViolation, err.Error())
+				return err
+			}
+			continue
+		}
+		if msg.Type == "eventAck" {
+			c.eventJournal.Ack(msg.Epoch, msg.Seq)
+			continue
+		}
+		if msg.Type == "echoReply" {
+			monitor.echoReply(uint32(msg.Seq), time.Now())
+			continue
+		}
 		if msg.ID == "" {
 			continue
 		}
-		status := "ok"
-		cmdErr := c.dispatch(ctx, &msg)
-		if cmdErr != nil {
-			status = "error"
+		if msg.Type == "chargeHistory" {
+			if err := c.sendChargeHistory(ctx, out, &msg); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Type == "connectionStatus" {
+			reply := connectionStatusMessage{Type: "connectionStatus", ID: msg.ID, Status: c.connectionStatus()}
+			if err := out.sendJSON(ctx, classControl, reply); err != nil {
+				return err
+			}
+			if err := c.sendAck(ctx, out, msg.ID, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Type == "outboundStats" {
+			if err := c.sendOutboundStats(ctx, out, &msg); err != nil {
+				return err
+			}
+			continue
 		}
-		ack := ackMessage{
-			Type:   "ack",
-			ID:     msg.ID,
-			Status: status,
+		if msg.Query != nil {
+			go c.answerQuery(ctx, out, &msg)
+			continue
 		}
-		if cmdErr != nil {
-			ack.Error = cmdErr.Error()
+		if msg.Move != nil || msg.Turn != nil {
+			if err := c.startMotion(ctx, out, &msg); err != nil {
+				if err := c.sendAck(ctx, out, msg.ID, err); err != nil {
+					return err
+				}
+			}
+			continue
 		}
-		if err := writeJSON(ctx, conn, ack); err != nil {
+		if err := c.sendAck(ctx, out, msg.ID, c.dispatch(ctx, &msg)); err != nil {
 			return err
 		}
 	}
 }
 
+// handleServerHello records the protocol version agreed with the server.
+// An incompatible server ends the connection; one that never sends a
+// serverHello keeps the version 1 behaviour.
+func (c *WSClient) handleServerHello(data []byte) error {
+	var hello serverHelloMessage
+	if err := json.Unmarshal(data, &hello); err != nil {
+		return fmt.Errorf("invalid serverHello: %w", err)
+	}
+	version, err := negotiateProtocol(&hello)
+	if err != nil {
+		c.log.Printf("refusing server %s: %v", hello.ServerVersion, err)
+		c.emitEvent(eventProtocolRejected, map[string]any{
+			"serverVersion":   hello.ServerVersion,
+			"protocolVersion": hello.ProtocolVersion,
+			"error":           err.Error(),
+		})
+		return err
+	}
+	session := negotiatedSession{
+		protocol:       version,
+		sensorEncoding: chooseSensorEncoding(hello.SensorEncoding),
+		telemetry:      chooseTelemetryMode(hello.Telemetry),
+		eventJournal:   hello.EventSeq != nil && c.eventJournal != nil,
+	}
+	if session.eventJournal {
+		c.eventJournal.Ack(hello.EventEpoch, *hello.EventSeq)
+	}
+	c.setNegotiated(session)
+	c.log.Printf("server %s speaks protocol %d, using %d with %s telemetry in %s frames",
+		hello.ServerVersion, hello.ProtocolVersion, version, session.telemetry, session.sensorEncoding)
+	c.emitEvent(eventProtocolNegotiated, map[string]any{
+		"serverVersion":   hello.ServerVersion,
+		"protocolVersion": version,
+		"sensorEncoding":  session.sensorEncoding,
+		"telemetry":       session.telemetry,
+	})
+	return nil
+}
+
+// resetSession returns to the version 1 behaviour for a new connection. The
+// returned channel is closed once the server has answered hello.
+func (c *WSClient) resetSession() <-chan struct{} {
+	c.protoMu.Lock()
+	defer c.protoMu.Unlock()
+	c.negotiated = legacySession
+	c.answered = make(chan struct{})
+	return c.answered
+}
+
+func (c *WSClient) setNegotiated(session negotiatedSession) {
+	c.protoMu.Lock()
+	c.negotiated = session
+	if c.answered != nil {
+		close(c.answered)
+		c.answered = nil
+	}
+	c.protoMu.Unlock()
+}
+
+// session is what was agreed with the server for the current connection.
+// Features newer than protocol version 1 check it before they are used.
+func (c *WSClient) session() negotiatedSession {
+	c.protoMu.Lock()
+	defer c.protoMu.Unlock()
+	return c.negotiated
+}
+
+func (c *WSClient) sendAck(ctx context.Context, out *outbound, id string, cmdErr error) error {
+	ack := ackMessage{
+		Type:   "ack",
+		ID:     id,
+		Status: "ok",
+	}
+	if cmdErr != nil {
+		ack.Status = "error"
+		ack.Error = cmdErr.Error()
+	}
+	return out.sendJSON(ctx, classControl, ack)
+}
+
+// sendChargeHistory answers a chargeHistory command with the journal's
+// sessions, newest first, followed by the usual ack.
+func (c *WSClient) sendChargeHistory(ctx context.Context, out *outbound, msg *inboundMessage) error {
+	if c.journal == nil {
+		return c.sendAck(ctx, out, msg.ID, fmt.Errorf("charge journal disabled"))
+	}
+	reply := chargeHistoryMessage{
+		Type:     "chargeHistory",
+		ID:       msg.ID,
+		Sessions: c.journal.History(msg.Limit),
+	}
+	if err := out.sendJSON(ctx, classControl, reply); err != nil {
+		return err
+	}
+	return c.sendAck(ctx, out, msg.ID, nil)
+}
+
+// sendOutboundStats answers an outboundStats command with the per-class
+// queue counters of the current connection, followed by the usual ack.
+func (c *WSClient) sendOutboundStats(ctx context.Context, out *outbound, msg *inboundMessage) error {
+	reply := outboundStatsMessage{
+		Type:    "outboundStats",
+		ID:      msg.ID,
+		Classes: out.Stats(),
+	}
+	if err := out.sendJSON(ctx, classControl, reply); err != nil {
+		return err
+	}
+	return c.sendAck(ctx, out, msg.ID, nil)
+}
+
+// startMotion begins a move or turn and acks it from a goroutine once the
+// motion finishes or aborts, so the read loop keeps accepting commands that
+// may cancel it.
+func (c *WSClient) startMotion(ctx context.Context, out *outbound, msg *inboundMessage) error {
+	done, err := c.beginMotion(ctx, msg)
+	if err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.motion.Cancel("disconnected", true)
+		case result := <-done:
+			if err := c.sendAck(ctx, out, msg.ID, result); err != nil {
+				c.log.Printf("motion ack failed: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// beginMotion starts a move or turn and returns the channel its result
+// arrives on.
+func (c *WSClient) beginMotion(ctx context.Context, msg *inboundMessage) (<-chan error, error) {
+	if err := c.claimWheels(ctx, true); err != nil {
+		return nil, err
+	}
+	if msg.Move != nil {
+		return c.motion.Move(msg.ID, msg.Move.DistanceMm, msg.Move.Speed)
+	}
+	return c.motion.Turn(msg.ID, msg.Turn.Degrees, msg.Turn.Speed)
+}
+
+// dispatch runs one command. Everything that acts on the rover is
+// arbitrated between controllers; estop, estop.clear, sensorStream, query
+// and media stay shared, since they stop the rover, only read it, or serve
+// every viewer.
 func (c *WSClient) dispatch(ctx context.Context, msg *inboundMessage) error {
 	switch {
+	case msg.Type == "estop":
+		reason := msg.Reason
+		if reason == "" {
+			reason = "operator"
+		}
+		return c.deadman.EmergencyStop("command", reason)
+	case msg.Type == "estop.clear":
+		return c.deadman.ClearEmergencyStop("command")
 	case msg.DriveDirect != nil:
 		left := clamp(msg.DriveDirect.Left, -c.cfg.MaxWheelMMs, c.cfg.MaxWheelMMs)
 		right := clamp(msg.DriveDirect.Right, -c.cfg.MaxWheelMMs, c.cfg.MaxWheelMMs)
-		return c.adapter.DriveDirect(left, right)
+		ttl := time.Duration(msg.DriveDirect.TTLMs) * time.Millisecond
+		if err := c.claimWheels(ctx, left != 0 || right != 0); err != nil {
+			return err
+		}
+		c.motion.Cancel("superseded by driveDirect", false)
+		return c.deadman.DriveDirect(left, right, ttl)
 	case msg.MotorPWM != nil:
 		main := clamp(msg.MotorPWM.Main, -127, 127)
 		side := clamp(msg.MotorPWM.Side, -127, 127)
 		vac := clamp(msg.MotorPWM.Vacuum, 0, 127)
-		return c.adapter.MotorPWM(main, side, vac)
-	case msg.SensorStream != nil:
-		if msg.SensorStream.Enable {
-			return c.adapter.StartSensorStream(defaultStreamPackets)
+		running := main != 0 || side != 0 || vac != 0
+		if err := c.control.claim(controllerFrom(ctx), running); err != nil {
+			return err
 		}
-		return nil
+		return c.deadman.sendUnlessLatched(running, func() error {
+			return c.adapter.MotorPWM(main, side, vac)
+		})
+	case msg.SensorStream != nil:
+		return c.handleSensorStream(msg.SensorStream)
 	case msg.Raw != "" && len(msg.Raw) > 0:
 		buf, err := base64.StdEncoding.DecodeString(msg.Raw)
 		if err != nil {
 			return fmt.Errorf("raw decode: %w", err)
 		}
-		if err := c.adapter.SendRaw(buf); err != nil {
-			return err
-		}
-		if len(buf) > 0 && isModeOpcode(buf[0]) {
-			return c.ensureSensorStream()
-		}
-		return nil
+		return c.handleRaw(ctx, buf)
 	case msg.Media != nil:
 		if c.media == nil {
 			return fmt.Errorf("media supervisor disabled")
@@ -167,25 +492,386 @@ func (c *WSClient) dispatch(ctx context.Context, msg *inboundMessage) error {
 		if c.servo == nil {
 			return fmt.Errorf("camera servo disabled")
 		}
+		if err := c.claimActuator(ctx); err != nil {
+			return err
+		}
 		return c.handleServoCommand(msg.Servo)
 	case msg.TTS != nil:
+		if err := c.claimActuator(ctx); err != nil {
+			return err
+		}
 		return c.enqueueTTS(msg.TTS)
 	case msg.NightVision != nil:
 		if c.nightVision == nil {
 			return fmt.Errorf("night vision disabled")
 		}
+		if err := c.claimActuator(ctx); err != nil {
+			return err
+		}
 		return c.nightVision.HandleAction(msg.NightVision.Action)
 	case msg.Song != nil:
 		slot := 0
 		if msg.Song.Slot != nil {
 			slot = clampInt(*msg.Song.Slot, 0, 4)
 		}
+		if err := c.claimActuator(ctx); err != nil {
+			return err
+		}
 		return c.adapter.PlaySong(slot, msg.Song.Notes)
+	case msg.OI != nil:
+		return c.handleOICommand(ctx, msg.OI.Action)
+	case msg.Drive != nil:
+		velocity := clamp(msg.Drive.Velocity, -c.cfg.MaxWheelMMs, c.cfg.MaxWheelMMs)
+		radius := normalizeDriveRadius(msg.Drive.Radius)
+		ttl := time.Duration(msg.Drive.TTLMs) * time.Millisecond
+		if err := c.claimWheels(ctx, velocity != 0); err != nil {
+			return err
+		}
+		c.motion.Cancel("superseded by drive", false)
+		return c.deadman.Drive(velocity, radius, ttl)
+	case msg.DrivePWM != nil:
+		left := clamp(msg.DrivePWM.Left, -drivePWMMax, drivePWMMax)
+		right := clamp(msg.DrivePWM.Right, -drivePWMMax, drivePWMMax)
+		ttl := time.Duration(msg.DrivePWM.TTLMs) * time.Millisecond
+		if err := c.claimWheels(ctx, left != 0 || right != 0); err != nil {
+			return err
+		}
+		c.motion.Cancel("superseded by drivePwm", false)
+		return c.deadman.DrivePWM(left, right, ttl)
+	case msg.LEDs != nil:
+		color := clamp(msg.LEDs.Color, 0, 255)
+		intensity := clamp(msg.LEDs.Intensity, 0, 255)
+		if err := c.claimActuator(ctx); err != nil {
+			return err
+		}
+		return c.adapter.SetLEDs(ledBits(msg.LEDs), color, intensity)
+	case msg.ScheduleLEDs != nil:
+		weekdays := clamp(msg.ScheduleLEDs.Weekdays, 0, 0x7F)
+		leds := clamp(msg.ScheduleLEDs.LEDs, 0, 0x1F)
+		if err := c.claimActuator(ctx); err != nil {
+			return err
+		}
+		return c.adapter.SetSchedulingLEDs(byte(weekdays), byte(leds))
+	case msg.DigitLEDs != nil:
+		if err := c.claimActuator(ctx); err != nil {
+			return err
+		}
+		return c.handleDigitLEDs(msg.DigitLEDs)
+	case msg.Buttons != nil:
+		// Buttons start cleaning or docking, so they take the wheels like
+		// the clean and spot OI actions.
+		bits := buttonBits(msg.Buttons)
+		if bits != 0 {
+			if err := c.deadman.CheckEStop(); err != nil {
+				return err
+			}
+		}
+		if err := c.claimWheels(ctx, bits != 0); err != nil {
+			return err
+		}
+		c.motion.Cancel("superseded by buttons", false)
+		return c.adapter.PressButtons(bits)
 	default:
 		return fmt.Errorf("unsupported command type: %s", msg.Type)
 	}
 }
 
+// handleRaw forwards raw OI bytes. The buffer is split into its commands
+// and every one is checked, so a drive cannot hide behind a mode opcode:
+// motion opcodes are refused while the emergency stop is latched, drive
+// opcodes go through the deadman's safety and shaping checks and, like mode
+// and motion opcodes, take the wheels and cancel any move or turn.
+func (c *WSClient) handleRaw(ctx context.Context, buf []byte) error {
+	if len(buf) == 0 {
+		return c.adapter.SendRaw(buf)
+	}
+	cmds, err := splitRawCommands(buf)
+	if err != nil {
+		return err
+	}
+	// Classified as the typed commands are: the Roomba's own behaviours move
+	// the wheels, and only Seek Dock is let through a low-battery return.
+	claims, moving, drivesAway := false, false, false
+	for _, cmd := range cmds {
+		_, isMode := opcodeMode(cmd[0])
+		motion := isMotionOpcode(cmd)
+		if motion {
+			if err := c.deadman.CheckEStop(); err != nil {
+				return err
+			}
+		}
+		if isMode || motion || isDriveOpcode(cmd[0]) {
+			left, right, _ := rawDriveWheels(cmd, nominalWheelBaseMm)
+			cmdMoving := motion || left != 0 || right != 0
+			claims = true
+			moving = moving || cmdMoving
+			drivesAway = drivesAway || (cmdMoving && cmd[0] != 143)
+		}
+	}
+	if claims {
+		if err := c.control.claim(controllerFrom(ctx), moving); err != nil {
+			return err
+		}
+		if err := c.stuck.CheckDriver(moving); err != nil {
+			return err
+		}
+		if err := c.lowBattery.CheckDrive(drivesAway); err != nil {
+			return err
+		}
+		c.motion.Cancel("superseded by raw command", false)
+	}
+	restream := false
+	for _, cmd := range cmds {
+		var err error
+		if isDriveOpcode(cmd[0]) {
+			err = c.deadman.RawDrive(cmd)
+		} else {
+			err = c.deadman.sendUnlessLatched(isMotionOpcode(cmd), func() error {
+				return c.adapter.SendRaw(cmd)
+			})
+		}
+		if err != nil {
+			return err
+		}
+		if mode, isMode := opcodeMode(cmd[0]); isMode {
+			c.modes.Commanded(mode, "command")
+		}
+		restream = restream || isModeOpcode(cmd[0])
+	}
+	if restream {
+		return c.ensureSensorStream()
+	}
+	return nil
+}
+
+// claimActuator checks that the controller may use the rover's other
+// actuators: lights, sound, the camera servo and night vision. Only moving
+// the wheels takes or extends the lease.
+func (c *WSClient) claimActuator(ctx context.Context) error {
+	return c.control.claim(controllerFrom(ctx), false)
+}
+
+// claimWheels is called before a driver command takes the wheels. It lets
+// the stuck escape and the low-battery return refuse moving commands while
+// they own the rover; stops always pass and abort an escape. Commands from
+// a controller other than the one holding the wheels are refused.
+func (c *WSClient) claimWheels(ctx context.Context, moving bool) error {
+	if err := c.control.claim(controllerFrom(ctx), moving); err != nil {
+		return err
+	}
+	if err := c.stuck.CheckDriver(moving); err != nil {
+		return err
+	}
+	return c.lowBattery.CheckDrive(moving)
+}
+
+func (c *WSClient) handleOICommand(ctx context.Context, action string) error {
+	var send func() error
+	mode, restream, moves, docking := oiModePassive, false, false, false
+	switch strings.ToLower(strings.TrimSpace(action)) {
+	case "start":
+		send, restream = c.adapter.StartOI, true
+	case "safe":
+		send, mode, restream = c.adapter.SafeMode, oiModeSafe, true
+	case "full":
+		send, mode, restream = c.adapter.FullMode, oiModeFull, true
+	case "passive":
+		send, restream = c.adapter.PassiveMode, true
+	case "power":
+		send = c.adapter.Power
+	case "clean":
+		send, moves = c.adapter.Clean, true
+	case "spot":
+		send, moves = c.adapter.Spot, true
+	case "max":
+		send, moves = c.adapter.MaxClean, true
+	case "seekdock", "dock":
+		send, moves, docking = c.adapter.SeekDock, true, true
+	case "reset":
+		send, mode = c.adapter.Reset, oiModeOff
+	case "stop":
+		send, mode = c.adapter.Stop, oiModeOff
+	default:
+		return fmt.Errorf("unknown oi action: %s", action)
+	}
+	if moves {
+		if err := c.deadman.CheckEStop(); err != nil {
+			return err
+		}
+	}
+	if err := c.control.claim(controllerFrom(ctx), moves); err != nil {
+		return err
+	}
+	if err := c.stuck.CheckDriver(moves); err != nil {
+		return err
+	}
+	if err := c.lowBattery.CheckDrive(moves && !docking); err != nil {
+		return err
+	}
+	c.motion.Cancel("superseded by oi "+action, false)
+	if err := c.deadman.sendUnlessLatched(moves, send); err != nil {
+		return err
+	}
+	c.modes.Commanded(mode, "command")
+	if !restream {
+		return nil
+	}
+	return c.ensureSensorStream()
+}
+
+// handleSensorStream changes the forwarding interval and packet list. A new
+// packet list changes the frame layout the decoder expects, so the stream
+// is restarted with it even without enable.
+func (c *WSClient) handleSensorStream(payload *sensorStreamPayload) error {
+	if payload.IntervalMs != nil {
+		c.stream.SetInterval(time.Duration(*payload.IntervalMs) * time.Millisecond)
+	}
+	if len(payload.Packets) > 0 {
+		if err := c.stream.SetPackets(payload.Packets); err != nil {
+			return err
+		}
+	}
+	if payload.Enable || len(payload.Packets) > 0 {
+		return c.ensureSensorStream()
+	}
+	return nil
+}
+
+func (c *WSClient) sensorStreamInfo() sensorStreamInfo {
+	packets := c.stream.Packets()
+	ids := make([]int, len(packets))
+	for i, id := range packets {
+		ids[i] = int(id)
+	}
+	return sensorStreamInfo{
+		Packets:    ids,
+		IntervalMs: c.stream.Interval().Milliseconds(),
+	}
+}
+
+func (c *WSClient) oiInfo() oiInfo {
+	info := oiInfo{
+		Mode:          "unknown",
+		DriveMode:     oiModeName(c.modes.DriveMode()),
+		PassiveOnDock: c.modes.PassiveOnDock(),
+	}
+	if mode, ok := c.modes.Mode(); ok {
+		info.Mode = oiModeName(mode)
+	}
+	return info
+}
+
+func (c *WSClient) handleDigitLEDs(payload *digitLEDsPayload) error {
+	if payload.Raw == nil {
+		return c.adapter.SetDigitLEDsASCII(payload.Text)
+	}
+	if len(payload.Raw) != 4 {
+		return fmt.Errorf("digit raw requires 4 values, got %d", len(payload.Raw))
+	}
+	var digits [4]byte
+	for i, v := range payload.Raw {
+		digits[i] = byte(clamp(v, 0, 0x7F))
+	}
+	return c.adapter.SetDigitLEDsRaw(digits)
+}
+
+const (
+	// sensorQueryDrain lets a stream frame already on the wire arrive
+	// before a query is sent; a full frame takes about 25ms at 115200 baud.
+	sensorQueryDrain   = 50 * time.Millisecond
+	sensorQueryTimeout = 500 * time.Millisecond
+)
+
+// errQueryWhileDriving refuses a query that would pause the stream safety
+// and motion steer by.
+var errQueryWhileDriving = errors.New("query refused while the wheels are driven; stream the packets instead")
+
+// handleQuery asks the Roomba for packets and waits for the reply. The
+// reply carries no header or checksum to find it by among stream frames, so
+// the stream is paused and left to drain first and the sensor reader is
+// told to take the next bytes as the reply. That blinds the on-rover
+// consumers for up to half a second, so it is refused while driving.
+func (c *WSClient) handleQuery(ctx context.Context, packets []int) (*queryResult, error) {
+	if len(packets) == 0 {
+		return nil, fmt.Errorf("query requires packets")
+	}
+	ids := make([]byte, 0, len(packets))
+	length := 0
+	for _, id := range packets {
+		size, ok := packetSizes[byte(id)]
+		if id < 0 || id > 255 || !ok {
+			return nil, fmt.Errorf("invalid packet id %d", id)
+		}
+		ids = append(ids, byte(id))
+		length += size
+	}
+
+	c.queryMu.Lock()
+	defer c.queryMu.Unlock()
+	if left, right := c.deadman.Commanded(); left != 0 || right != 0 {
+		return nil, errQueryWhileDriving
+	}
+	if err := c.adapter.PauseSensorStream(true); err != nil {
+		return nil, fmt.Errorf("pause sensor stream: %w", err)
+	}
+	defer func() {
+		if err := c.adapter.PauseSensorStream(false); err != nil {
+			c.log.Printf("resume sensor stream after query failed: %v", err)
+		}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(sensorQueryDrain):
+	}
+
+	reply, cancel := c.streamer.expectReply(length)
+	defer cancel()
+	var err error
+	if len(ids) == 1 {
+		err = c.adapter.QuerySensor(ids[0])
+	} else {
+		err = c.adapter.QueryList(ids)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(sensorQueryTimeout):
+		return nil, fmt.Errorf("no reply to query within %s", sensorQueryTimeout)
+	case data = <-reply:
+	}
+	if data == nil {
+		return nil, fmt.Errorf("query reply cut short")
+	}
+	sample, err := decodeQueryReply(ids, data)
+	if err != nil {
+		return nil, err
+	}
+	return &queryResult{
+		Packets: packets,
+		Data:    base64.StdEncoding.EncodeToString(data),
+		Sensors: newTelemetryMessage(&sample, sample.Timestamp, 0),
+	}, nil
+}
+
+// answerQuery runs a query off the read loop, which would otherwise stall
+// behind it, and acks with the reply.
+func (c *WSClient) answerQuery(ctx context.Context, out *outbound, msg *inboundMessage) {
+	result, err := c.handleQuery(ctx, msg.Query.Packets)
+	ack := ackMessage{Type: "ack", ID: msg.ID, Status: "ok", Query: result}
+	if err != nil {
+		ack.Status = "error"
+		ack.Error = err.Error()
+	}
+	if err := out.sendJSON(ctx, classControl, ack); err != nil {
+		c.log.Printf("query ack failed: %v", err)
+	}
+}
+
 func (c *WSClient) enqueueTTS(payload *ttsPayload) error {
 	if c.ttsQueue == nil {
 		return fmt.Errorf("tts disabled")
@@ -213,7 +899,7 @@ func (c *WSClient) startTTSWorker(ctx context.Context) {
 				}
 				if err := c.handleTTSPayload(ctx, payload); err != nil {
 					c.log.Printf("tts failed: %v", err)
-					c.emitEvent("tts.error", map[string]any{"error": err.Error()})
+					c.emitEvent(eventTTSError, map[string]any{"error": err.Error()})
 				}
 			}
 		}
@@ -233,7 +919,7 @@ func (c *WSClient) handleServoCommand(payload *servoPayload) error {
 	}
 }
 
-func (c *WSClient) forwardSensors(ctx context.Context, conn *websocket.Conn) {
+func (c *WSClient) forwardSensors(ctx context.Context, out *outbound) {
 	const (
 		sensorSilenceTimeout   = 5 * time.Second
 		sensorRecoveryCooldown = 3 * time.Second
@@ -255,6 +941,7 @@ func (c *WSClient) forwardSensors(ctx context.Context, conn *websocket.Conn) {
 
 	lastRecovery := time.Time{}
 	lastFrame := time.Now()
+	var seq uint32
 
 	for {
 		select {
@@ -278,52 +965,184 @@ func (c *WSClient) forwardSensors(ctx context.Context, conn *websocket.Conn) {
 		case frame := <-c.sensorFrames:
 			lastFrame = time.Now()
 			resetTimer()
-			msg := sensorMessage{
-				Type:      "sensor",
-				Timestamp: time.Now().UnixMilli(),
-				Data:      base64.StdEncoding.EncodeToString(frame),
+			seq++
+			c.sendSensorFrame(out, frame, lastFrame.UnixMilli(), seq)
+		}
+	}
+}
+
+// sendSensorFrame queues one frame as the connection's telemetry mode asks:
+// the raw frame in the negotiated encoding, the decoded telemetry or both.
+// A frame still waiting when the next one arrives is replaced by it. A
+// frame that fails to encode or decode is logged and skipped.
+func (c *WSClient) sendSensorFrame(out *outbound, frame []byte, ts int64, seq uint32) {
+	session := c.session()
+	if session.telemetry != TelemetryDecoded {
+		data, binary, err := EncodeSensorFrame(session.sensorEncoding, ts, seq, frame)
+		if err != nil {
+			c.log.Printf("sensor encode failed: %v", err)
+			return
+		}
+		msgType := websocket.MessageText
+		if binary {
+			msgType = websocket.MessageBinary
+		}
+		out.sendLatest("sensor", msgType, data)
+	}
+	if session.telemetry == TelemetryRaw {
+		return
+	}
+	sample, err := decodeSensorSample(frame, c.stream.PayloadLength())
+	if err != nil {
+		c.log.Printf("telemetry decode failed: %v", err)
+		return
+	}
+	if err := out.sendLatestJSON("telemetry", newTelemetryMessage(&sample, ts, seq)); err != nil {
+		c.log.Printf("telemetry encode failed: %v", err)
+	}
+}
+
+func (c *WSClient) forwardBattery(ctx context.Context, out *outbound) {
+	if c.battery == nil {
+		return
+	}
+	ticker := time.NewTicker(batteryReportInterval)
+	defer ticker.Stop()
+	var sent uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			st, seq, ok := c.battery.State()
+			if !ok || seq == sent {
+				continue
 			}
-			if err := writeJSON(ctx, conn, msg); err != nil {
-				c.log.Printf("sensor send failed: %v", err)
-				return
+			sent = seq
+			if err := out.sendLatestJSON("battery", newBatteryMessage(st)); err != nil {
+				c.log.Printf("battery encode failed: %v", err)
 			}
 		}
 	}
 }
 
-func (c *WSClient) forwardEvents(ctx context.Context, conn *websocket.Conn) {
-	if c.events == nil {
+func newBatteryMessage(st BatteryState) batteryMessage {
+	msg := batteryMessage{
+		Type:          "battery",
+		Timestamp:     st.Timestamp,
+		SoC:           math.Round(st.SoC*1000) / 1000,
+		Source:        st.Source,
+		ChargeMah:     st.ChargeMah,
+		CapacityMah:   st.CapacityMah,
+		VoltageMv:     st.VoltageMv,
+		CurrentMa:     st.CurrentMa,
+		TemperatureC:  st.TemperatureC,
+		ChargingState: st.ChargingState,
+		Charging:      st.Charging,
+		DischargeMa:   math.Round(st.DischargeMa),
+		ChargeMa:      math.Round(st.ChargeMa),
+		Warn:          st.Warn,
+		Urgent:        st.Urgent,
+	}
+	if st.TimeToEmpty > 0 {
+		secs := int64(st.TimeToEmpty.Seconds())
+		msg.TimeToEmptySec = &secs
+	}
+	if st.TimeToFull > 0 {
+		secs := int64(st.TimeToFull.Seconds())
+		msg.TimeToFullSec = &secs
+	}
+	return msg
+}
+
+func (c *WSClient) forwardOdometry(ctx context.Context, out *outbound) {
+	if c.odometry == nil {
 		return
 	}
+	ticker := time.NewTicker(c.odometry.Interval())
+	defer ticker.Stop()
+	var sent uint64
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case evt := <-c.events:
+		case <-ticker.C:
+			pose, seq := c.odometry.Pose()
+			if seq == sent {
+				continue
+			}
+			sent = seq
+			msg := odometryMessage{
+				Type:       "odometry",
+				Timestamp:  pose.Timestamp,
+				X:          math.Round(pose.X*10) / 10,
+				Y:          math.Round(pose.Y*10) / 10,
+				HeadingDeg: math.Round(pose.Heading*180/math.Pi*10) / 10,
+				DistanceMm: math.Round(pose.DistanceMm),
+			}
+			if err := out.sendLatestJSON("odometry", msg); err != nil {
+				c.log.Printf("odometry encode failed: %v", err)
+			}
+		}
+	}
+}
+
+// forwardEvents sends the journal's events to the server. A server that
+// acknowledged the journal in serverHello gets them with their sequence
+// numbers, starting after the last one it acknowledged. Any other server
+// only gets the events from this connection on, without sequence numbers,
+// and they count as delivered once queued: version 1 servers never ack, and
+// replaying to them would repeat events on every reconnect. Servers that
+// never send serverHello are given serverHelloWait to do so.
+func (c *WSClient) forwardEvents(ctx context.Context, out *outbound, answered <-chan struct{}) {
+	if c.eventJournal == nil {
+		return
+	}
+	info := c.eventJournal.eventJournalInfo()
+	live := info.Seq
+	select {
+	case <-ctx.Done():
+		return
+	case <-answered:
+	case <-time.After(serverHelloWait):
+	}
+	sequenced := c.session().protocol >= 2 && c.session().eventJournal
+	sent := live
+	if sequenced {
+		sent = c.eventJournal.Acked()
+	}
+	for {
+		if sequenced {
+			// The server's serverHello may acknowledge past what was sent.
+			sent = max(sent, c.eventJournal.Acked())
+		}
+		for _, evt := range c.eventJournal.After(sent) {
+			seq := evt.Seq
 			if evt.Type == "" {
 				evt.Type = "event"
 			}
-			if err := writeJSON(ctx, conn, evt); err != nil {
+			if !sequenced {
+				evt.Seq = 0
+			}
+			if err := out.sendJSON(ctx, eventClass(evt.Event), evt); err != nil {
 				c.log.Printf("event send failed: %v", err)
 				return
 			}
+			sent = seq
+			if !sequenced {
+				c.eventJournal.Ack(info.Epoch, seq)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.eventJournal.Notify():
 		}
 	}
 }
 
 func (c *WSClient) emitEvent(event string, data map[string]any) {
-	if c.events == nil {
-		return
-	}
-	select {
-	case c.events <- RoverEvent{
-		Type:  "event",
-		Event: event,
-		Ts:    time.Now().UnixMilli(),
-		Data:  data,
-	}:
-	default:
-	}
+	emitRoverEvent(c.events, event, data)
 }
 
 func writeJSON(ctx context.Context, conn *websocket.Conn, v any) error {
@@ -345,7 +1164,7 @@ func clamp(value, min, max int) int {
 }
 
 func (c *WSClient) ensureSensorStream() error {
-	if err := c.adapter.StartSensorStream(defaultStreamPackets); err != nil {
+	if err := c.adapter.StartSensorStream(c.stream.Packets()); err != nil {
 		return err
 	}
 	return nil
@@ -384,11 +1203,18 @@ func (c *WSClient) handleDisconnectTimeout() {
 	c.seekIssued = true
 	c.connMu.Unlock()
 
+	if err := c.deadman.CheckEStop(); err != nil {
+		c.log.Printf("seek dock on disconnect skipped: %v", err)
+		c.emitEvent(eventDisconnectSeekDockSkipped, map[string]any{"error": err.Error()})
+		return
+	}
 	if err := c.adapter.SeekDock(); err != nil {
 		c.log.Printf("seek dock on disconnect failed: %v", err)
+		c.emitEvent(eventDisconnectSeekDockError, map[string]any{"error": err.Error()})
 		return
 	}
 	c.log.Printf("seek dock issued after websocket disconnect")
+	c.emitEvent(eventDisconnectSeekDockIssued, map[string]any{"afterMs": disconnectSeekDelay.Milliseconds()})
 }
 
 func (c *WSClient) recoverSensorStream(idleFor time.Duration, cmdPause time.Duration) {
@@ -406,35 +1232,121 @@ func (c *WSClient) recoverSensorStream(idleFor time.Duration, cmdPause time.Dura
 		c.recoverMu.Unlock()
 	}()
 
-	c.emitEvent("sensorWatchdog.restart", map[string]any{
+	c.emitEvent(eventSensorWatchdogRestart, map[string]any{
 		"idleMs": idleFor.Milliseconds(),
 	})
 
 	if err := c.adapter.StartOI(); err != nil {
 		c.log.Printf("watchdog start OI failed: %v", err)
-		c.emitEvent("sensorWatchdog.error", map[string]any{"error": err.Error()})
+		c.emitEvent(eventSensorWatchdogError, map[string]any{"error": err.Error()})
 		return
 	}
+	c.modes.Commanded(oiModePassive, "watchdog")
 	if cmdPause > 0 {
 		time.Sleep(cmdPause)
 	}
 
-	if err := c.adapter.StartSensorStream(defaultStreamPackets); err != nil {
+	if err := c.adapter.StartSensorStream(c.stream.Packets()); err != nil {
 		c.log.Printf("watchdog start stream failed: %v", err)
-		c.emitEvent("sensorWatchdog.error", map[string]any{"error": err.Error()})
+		c.emitEvent(eventSensorWatchdogError, map[string]any{"error": err.Error()})
 		return
 	}
 
-	c.emitEvent("sensorWatchdog.ok", map[string]any{
+	c.emitEvent(eventSensorWatchdogOK, map[string]any{
 		"idleMs": idleFor.Milliseconds(),
 	})
 }
 
+// rawOpcodeArgs is the number of data bytes that follow each opcode a raw
+// command may carry; -1 marks Song, whose length is in its second byte.
+var rawOpcodeArgs = map[byte]int{
+	7: 0, 128: 0, 129: 1, 130: 0, 131: 0, 132: 0, 133: 0, 134: 0, 135: 0,
+	136: 0, 137: 4, 138: 1, 139: 3, 140: -1, 141: 1, 143: 0, 144: 3, 145: 4,
+	146: 4, 147: 1, 151: 1, 162: 2, 163: 4, 164: 4, 165: 1, 167: 15, 168: 3,
+	173: 0,
+}
+
+// splitRawCommands splits a raw buffer into its OI commands. Sensor
+// requests are refused because their replies would desynchronise the
+// sensor stream, and scripts because they would drive outside the deadman.
+func splitRawCommands(buf []byte) ([][]byte, error) {
+	var cmds [][]byte
+	for len(buf) > 0 {
+		op := buf[0]
+		n, ok := rawOpcodeArgs[op]
+		switch {
+		case op == 142 || (op >= 148 && op <= 150):
+			return nil, fmt.Errorf("raw opcode %d is not supported; use sensorStream or query", op)
+		case op >= 152 && op <= 158:
+			return nil, fmt.Errorf("raw opcode %d is not supported; scripts bypass the deadman", op)
+		case !ok:
+			return nil, fmt.Errorf("unknown raw opcode %d", op)
+		}
+		if n < 0 {
+			if len(buf) < 3 {
+				return nil, fmt.Errorf("raw opcode %d is truncated", op)
+			}
+			n = 2 + 2*int(buf[2])
+		}
+		if len(buf) < 1+n {
+			return nil, fmt.Errorf("raw opcode %d needs %d data bytes, got %d", op, n, len(buf)-1)
+		}
+		cmds = append(cmds, buf[:1+n])
+		buf = buf[1+n:]
+	}
+	return cmds, nil
+}
+
 func isModeOpcode(op byte) bool {
 	switch op {
-	case 128, 131, 132:
+	case 128, 130, 131, 132:
 		return true
 	default:
 		return false
 	}
 }
+
+func isDriveOpcode(op byte) bool {
+	switch op {
+	case 137, 145, 146:
+		return true
+	default:
+		return false
+	}
+}
+
+// isMotionOpcode reports whether a raw command starts the cleaning motors or
+// one of the Roomba's own drive behaviours, directly or by pressing a
+// button, which the emergency stop blocks. Drive opcodes are checked by the
+// deadman itself.
+func isMotionOpcode(buf []byte) bool {
+	switch buf[0] {
+	case 134, 135, 136, 143:
+		return true
+	case 138, 144, 165:
+		for _, b := range buf[1:] {
+			if b != 0 {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// opcodeMode is the OI mode a raw command leaves the Roomba in.
+func opcodeMode(op byte) (byte, bool) {
+	switch op {
+	case 7, 173:
+		return oiModeOff, true
+	case 128, 133, 134, 135, 136, 143:
+		return oiModePassive, true
+	case 130, 131:
+		return oiModeSafe, true
+	case 132:
+		return oiModeFull, true
+	default:
+		return 0, false
+	}
+}
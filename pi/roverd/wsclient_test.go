@@ -0,0 +1,144 @@
+package roverd
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// recordingPort keeps every command roverd writes to the Roomba.
+type recordingPort struct {
+	discardPort
+
+	mu      sync.Mutex
+	written [][]byte
+}
+
+func (p *recordingPort) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.written = append(p.written, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+// commands returns and forgets what was written so far.
+func (p *recordingPort) commands() [][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	written := p.written
+	p.written = nil
+	return written
+}
+
+// testConfig is the least LoadConfig accepts; everything else defaults.
+const testConfig = `name: ` + testRoverName + `
+serverUrl: ws://127.0.0.1:1/rover
+serial:
+  simulate: true
+  baud: 115200
+battery:
+  full: 2068
+  warn: 1700
+  urgent: 1650
+`
+
+// newTestClient wires a client to the rover components as main does, over
+// a recordingPort, with the config's defaults plus extraConfig.
+func newTestClient(t *testing.T, extraConfig string) (*WSClient, *recordingPort) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "roverd.yaml")
+	if err := os.WriteFile(path, []byte(testConfig+extraConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	logger := log.New(io.Discard, "", 0)
+	port := &recordingPort{}
+	events := make(chan RoverEvent, 256)
+	stream, err := NewStreamSettings(cfg.SensorStream, cfg.StreamPacketsNeeded())
+	if err != nil {
+		t.Fatalf("NewStreamSettings: %v", err)
+	}
+	adapter := NewSerialAdapter(port, logger)
+	modes := NewOIModeTracker(cfg.Drive, adapter, stream, events, logger)
+	battery := NewBatteryEstimator(cfg.Battery, events, logger)
+	safety := NewSafetyInterlock(cfg.Safety, events, logger)
+	shaper := NewDriveShaper(cfg.Drive, adapter, logger)
+	go shaper.Run(ctx)
+	deadman := NewDriveDeadman(cfg.Drive, adapter, shaper, modes, safety, events, logger)
+	go deadman.Run(ctx)
+	motion := NewMotionController(cfg.Odometry, cfg.MaxWheelMMs, deadman, events, logger)
+	client := NewWSClient(cfg, WSClientDeps{
+		Adapter:    adapter,
+		Deadman:    deadman,
+		Modes:      modes,
+		Odometry:   NewOdometry(cfg.Odometry, events, logger),
+		Battery:    battery,
+		Motion:     motion,
+		Stuck:      NewStuckDetector(cfg.Stuck, deadman, motion, events, logger),
+		LowBattery: NewLowBatteryPolicy(cfg.LowBattery, cfg.Audio, adapter, deadman, modes, motion, battery, events, logger),
+		AutoCharge: NewAutoChargeController(cfg.AutoCharge, adapter, modes, deadman, events, logger),
+		Stream:     stream,
+		Streamer:   NewSensorStreamer(port, stream, nil, nil, logger),
+		Events:     events,
+	}, logger)
+	return client, port
+}
+
+func rawMessage(cmd ...byte) *inboundMessage {
+	return &inboundMessage{Type: "raw", ID: "raw", Raw: base64.StdEncoding.EncodeToString(cmd)}
+}
+
+func TestRawCommandsClaimTheWheels(t *testing.T) {
+	tests := []struct {
+		name   string
+		cmd    []byte
+		claims bool
+	}{
+		{"drive stop", []byte{137, 0, 0, 0, 0}, false},
+		{"drive direct stop", []byte{145, 0, 0, 0, 0}, false},
+		{"drive", []byte{137, 0, 100, 0x80, 0}, true},
+		{"drive radius zero", []byte{137, 0, 100, 0, 0}, true},
+		{"clean", []byte{135}, true},
+		{"spot", []byte{136}, true},
+		{"seek dock", []byte{143}, true},
+		{"motors", []byte{138, 1}, true},
+		{"motors off", []byte{138, 0}, false},
+		{"safe mode", []byte{131}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(t, "")
+			if err := c.dispatch(context.Background(), rawMessage(tt.cmd...)); err != nil {
+				t.Fatalf("raw % x: %v", tt.cmd, err)
+			}
+			if holder := c.control.status().Holder; (holder == controllerUpstream) != tt.claims {
+				t.Fatalf("raw % x left the wheels with %q", tt.cmd, holder)
+			}
+		})
+	}
+}
+
+func TestRawCommandsRespectAnotherController(t *testing.T) {
+	c, _ := newTestClient(t, "")
+	local := withController(context.Background(), "local:10.0.0.2")
+	if err := c.dispatch(local, &inboundMessage{Type: "driveDirect", DriveDirect: &driveDirectPayload{Left: 100, Right: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range [][]byte{{143}, {135}, {136}, {137, 0, 0, 0, 0}} {
+		if err := c.dispatch(context.Background(), rawMessage(cmd...)); !errors.Is(err, errControlHeld) {
+			t.Errorf("raw % x while a local client drives = %v, want errControlHeld", cmd, err)
+		}
+	}
+}
@@ -1,11 +1,18 @@
 const { WebSocketServer } = require('ws');
 const { httpServer } = require('./http');
 const logger = require('./logger');
+const { authenticateUpgrade } = require('../services/roverAuthService');
 
 const roverWSS = new WebSocketServer({ noServer: true });
 
 httpServer.on('upgrade', (req, socket, head) => {
   if (req.url.startsWith('/rover')) {
+    const auth = authenticateUpgrade(req.headers);
+    if (!auth.ok) {
+      logger.warn('Refused rover handshake', req.headers['x-rover-name'], auth.reason);
+      socket.end('HTTP/1.1 401 Unauthorized\r\nWWW-Authenticate: Bearer\r\nConnection: close\r\n\r\n');
+      return;
+    }
     roverWSS.handleUpgrade(req, socket, head, (ws) => {
       roverWSS.emit('connection', ws, req);
     });
@@ -0,0 +1,37 @@
+// Binary rover messages: a type byte, the timestamp in milliseconds as a
+// big-endian int64 and a big-endian uint32 sequence number, followed by the
+// payload. Mirrors pi/roverd/framing.go.
+const BINARY_TYPE_SENSOR = 0x01;
+const BINARY_HEADER_LEN = 13;
+
+// Sensor encodings this server accepts, most preferred first.
+const SENSOR_ENCODINGS = ['binary', 'json'];
+
+function parseBinaryMessage(buf) {
+  if (!Buffer.isBuffer(buf) || buf.length < BINARY_HEADER_LEN) {
+    return null;
+  }
+  const type = buf[0];
+  const ts = Number(buf.readBigInt64BE(1));
+  const seq = buf.readUInt32BE(9);
+  const payload = buf.subarray(BINARY_HEADER_LEN);
+  switch (type) {
+    case BINARY_TYPE_SENSOR:
+      return { type: 'sensor', ts, seq, payload };
+    default:
+      return { type: 'unknown', binaryType: type, ts, seq, payload };
+  }
+}
+
+function chooseSensorEncoding(offered) {
+  if (!Array.isArray(offered)) return 'json';
+  return SENSOR_ENCODINGS.find((enc) => offered.includes(enc)) || 'json';
+}
+
+module.exports = {
+  BINARY_TYPE_SENSOR,
+  BINARY_HEADER_LEN,
+  SENSOR_ENCODINGS,
+  parseBinaryMessage,
+  chooseSensorEncoding,
+};
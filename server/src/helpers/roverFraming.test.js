@@ -0,0 +1,68 @@
+const test = require('node:test');
+const assert = require('node:assert/strict');
+const {
+  BINARY_TYPE_SENSOR,
+  BINARY_HEADER_LEN,
+  parseBinaryMessage,
+  chooseSensorEncoding,
+} = require('./roverFraming');
+
+// The same bytes pi/roverd/framing_test.go builds with AppendBinaryFrame:
+// ts 1700000000123, seq 42, payload 13 02 07 00.
+const FIXTURE = '010000018bcfe5687b0000002a13020700';
+
+// appendBinaryFrame mirrors AppendBinaryFrame in pi/roverd/framing.go.
+function appendBinaryFrame(type, ts, seq, payload) {
+  const buf = Buffer.alloc(BINARY_HEADER_LEN + payload.length);
+  buf[0] = type;
+  buf.writeBigInt64BE(BigInt(ts), 1);
+  buf.writeUInt32BE(seq, 9);
+  payload.copy(buf, BINARY_HEADER_LEN);
+  return buf;
+}
+
+test('parses the frame roverd sends', () => {
+  const frame = parseBinaryMessage(Buffer.from(FIXTURE, 'hex'));
+  assert.equal(frame.type, 'sensor');
+  assert.equal(frame.ts, 1700000000123);
+  assert.equal(frame.seq, 42);
+  assert.deepEqual([...frame.payload], [0x13, 0x02, 0x07, 0x00]);
+});
+
+test('round-trips header fields and payload', () => {
+  const cases = [
+    { ts: 1700000000123, seq: 42, payload: [0x13, 0x02, 0x07, 0x00] },
+    { ts: 1, seq: 0, payload: [] },
+    { ts: 0, seq: 0xffffffff, payload: [0xff] },
+    { ts: -1, seq: 7, payload: [1, 2, 3] },
+  ];
+  for (const { ts, seq, payload } of cases) {
+    const buf = appendBinaryFrame(BINARY_TYPE_SENSOR, ts, seq, Buffer.from(payload));
+    const frame = parseBinaryMessage(buf);
+    assert.equal(frame.type, 'sensor');
+    assert.equal(frame.ts, ts);
+    assert.equal(frame.seq, seq);
+    assert.deepEqual([...frame.payload], payload);
+  }
+});
+
+test('reports unknown binary types with their fields', () => {
+  const frame = parseBinaryMessage(appendBinaryFrame(0x7f, 5, 6, Buffer.from([9])));
+  assert.equal(frame.type, 'unknown');
+  assert.equal(frame.binaryType, 0x7f);
+  assert.equal(frame.seq, 6);
+});
+
+test('rejects frames shorter than the header', () => {
+  for (let n = 0; n < BINARY_HEADER_LEN; n += 1) {
+    assert.equal(parseBinaryMessage(Buffer.alloc(n)), null);
+  }
+  assert.equal(parseBinaryMessage('not a buffer'), null);
+});
+
+test('prefers binary and falls back to json', () => {
+  assert.equal(chooseSensorEncoding(['json', 'binary']), 'binary');
+  assert.equal(chooseSensorEncoding(['json']), 'json');
+  assert.equal(chooseSensorEncoding(['cbor']), 'json');
+  assert.equal(chooseSensorEncoding(undefined), 'json');
+});
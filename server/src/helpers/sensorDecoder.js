@@ -72,15 +72,20 @@ const GROUP100_LAYOUT = [
 
 const GROUP100_TOTAL = GROUP100_LAYOUT.reduce((sum, spec) => sum + spec.bytes, 0);
 
+const PACKET_SPECS = Object.fromEntries(GROUP100_LAYOUT.map((spec) => [spec.id, spec]));
+
+// roverd's stream packet list is configurable, so accept group 100 plus any
+// single packet it contains.
 const TOP_LEVEL_PACKETS = {
   100: GROUP100_TOTAL,
-  21: 1,
-  34: 1,
+  ...Object.fromEntries(GROUP100_LAYOUT.map((spec) => [spec.id, spec.bytes])),
 };
 
-function parseSensorFrame(base64Data) {
-  if (!base64Data) return null;
-  const buf = Buffer.from(base64Data, 'base64');
+// parseSensorFrame takes a frame as base64, as JSON sensor messages carry
+// it, or as the Buffer a binary message carries.
+function parseSensorFrame(data) {
+  if (!data) return null;
+  const buf = Buffer.isBuffer(data) ? data : Buffer.from(data, 'base64');
   if (buf.length < 4 || buf[0] !== HEADER) {
     return null;
   }
@@ -109,6 +114,9 @@ function parseSensorFrame(base64Data) {
       decoded.chargingState = parseChargingState(segment);
     } else if (packetId === 34 && decoded.chargingSources == null) {
       decoded.chargingSources = parseChargeSources(segment);
+    } else if (PACKET_SPECS[packetId] && decoded[PACKET_SPECS[packetId].key] == null) {
+      const spec = PACKET_SPECS[packetId];
+      decoded[spec.key] = spec.parser(segment);
     }
   }
   return decoded;
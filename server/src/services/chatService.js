@@ -138,7 +138,7 @@ function maybeSpeak(socket, message, ttsOptions) {
   if (!ttsOptions || !message?.roverId) return;
   const record = roverManager.rovers.get(message.roverId);
   const audio = record?.meta?.audio || {};
-  const ttsEnabled = Boolean(audio.ttsEnabled);
+  const ttsEnabled = roverManager.supportsCommand(message.roverId, 'tts') ?? Boolean(audio.ttsEnabled);
   if (!ttsEnabled) return;
   // if (!roverManager.canDrive(message.roverId, socket)) return;
   try {
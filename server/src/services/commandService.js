@@ -10,6 +10,14 @@ function issueCommand(roverId, payload) {
   if (!record || !record.ws) {
     throw new Error('Rover offline');
   }
+  const commands = record.meta?.capabilities?.commands;
+  if (Array.isArray(commands)) {
+    // Commands are identified by their type or by their payload key.
+    const names = [payload.type, ...Object.keys(payload)];
+    if (!names.some((name) => commands.includes(name))) {
+      throw new Error(`Rover does not support ${payload.type || 'this command'}`);
+    }
+  }
   const id = uuidv4();
   const message = { ...payload, id };
   record.ws.send(JSON.stringify(message));
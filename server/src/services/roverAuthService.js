@@ -0,0 +1,75 @@
+const crypto = require('crypto');
+const { loadConfig } = require('../helpers/configLoader');
+
+// Per-rover secrets from rovers.auth.secrets. Once any are configured every
+// rover has to prove its secret, either as a bearer token on the websocket
+// handshake or by signing the authChallenge nonce in hello.
+const SECRETS = loadConfig().rovers?.auth?.secrets || {};
+const AUTH_REQUIRED = Object.keys(SECRETS).length > 0;
+
+function createChallenge() {
+  return AUTH_REQUIRED ? crypto.randomBytes(16).toString('hex') : null;
+}
+
+function safeEqual(a, b) {
+  const left = Buffer.from(String(a));
+  const right = Buffer.from(String(b));
+  return left.length === right.length && crypto.timingSafeEqual(left, right);
+}
+
+function hmacSignature(secret, nonce, name) {
+  return crypto.createHmac('sha256', secret).update(`${nonce}:${name}`).digest('hex');
+}
+
+// authenticateRover checks a hello against the handshake headers and the
+// challenge sent on this connection. Mirrors pi/roverd/auth.go.
+function authenticateRover(hello, { headers = {}, nonce } = {}) {
+  if (!AUTH_REQUIRED) {
+    return { ok: true, method: 'none' };
+  }
+  const name = hello.name;
+  const secret = SECRETS[name];
+  if (!secret) {
+    return { ok: false, reason: 'unknown rover' };
+  }
+  const bearer = /^Bearer (.+)$/.exec(headers.authorization || '')?.[1];
+  if (bearer) {
+    const headerName = headers['x-rover-name'];
+    if (headerName && headerName !== name) {
+      return { ok: false, reason: 'rover name does not match handshake' };
+    }
+    return safeEqual(bearer, secret) ? { ok: true, method: 'bearer' } : { ok: false, reason: 'bad token' };
+  }
+  if (hello.auth?.mode === 'hmac') {
+    if (!nonce || hello.auth.nonce !== nonce) {
+      return { ok: false, reason: 'stale challenge' };
+    }
+    const expected = hmacSignature(secret, nonce, name);
+    return safeEqual(hello.auth.signature || '', expected)
+      ? { ok: true, method: 'hmac' }
+      : { ok: false, reason: 'bad signature' };
+  }
+  return { ok: false, reason: 'credentials required' };
+}
+
+// authenticateUpgrade turns a bad bearer token away at the websocket
+// handshake, so roverd sees a 401 instead of a close after hello. HMAC
+// rovers carry no header and are checked in hello.
+function authenticateUpgrade(headers = {}) {
+  const bearer = /^Bearer (.+)$/.exec(headers.authorization || '')?.[1];
+  if (!AUTH_REQUIRED || !bearer) {
+    return { ok: true };
+  }
+  const secret = SECRETS[headers['x-rover-name']];
+  if (!secret) {
+    return { ok: false, reason: 'unknown rover' };
+  }
+  return safeEqual(bearer, secret) ? { ok: true } : { ok: false, reason: 'bad token' };
+}
+
+module.exports = {
+  AUTH_REQUIRED,
+  createChallenge,
+  authenticateRover,
+  authenticateUpgrade,
+};
@@ -3,6 +3,113 @@ const logger = require('../globals/logger').child('roverConnection');
 const roverManager = require('./roverManager');
 const { sendAlert, COLORS } = require('./alertService');
 const { handleAck } = require('./commandService');
+const { version: SERVER_VERSION } = require('../../package.json');
+const { parseBinaryMessage, chooseSensorEncoding } = require('../helpers/roverFraming');
+const { loadConfig } = require('../helpers/configLoader');
+const { createChallenge, authenticateRover } = require('./roverAuthService');
+
+// Telemetry mode asked of rovers that offer it: raw frames, decoded
+// telemetry objects or both.
+const TELEMETRY_MODE = loadConfig().rovers?.telemetry || 'raw';
+
+// Rover protocol spoken by this server. Rovers that send no protocol block
+// in hello are version 1 and do not expect a serverHello.
+const PROTOCOL_VERSION = 2;
+const MIN_ROVER_PROTOCOL_VERSION = 1;
+
+const ALERT_EVENTS = new Set(['autoCharge.fault', 'autoCharge.gaveUp']);
+
+function eventAlertColor(event) {
+  return ALERT_EVENTS.has(event) ? COLORS.error : COLORS.info;
+}
+
+// Event sequence handled per rover and journal epoch. Kept across
+// disconnects so events a rover replays after reconnecting are not handled
+// twice; a new epoch means the rover lost its journal and starts over.
+// Rovers send safety events ahead of older ones, so seq is the point up to
+// which every event was handled and ahead holds the ones seen past it.
+const eventCursors = new Map();
+const MAX_EVENTS_AHEAD = 256;
+
+function eventCursorFor(hello) {
+  const journal = hello.eventJournal;
+  if (!journal?.epoch) return null;
+  let cursor = eventCursors.get(hello.name);
+  if (cursor?.epoch !== journal.epoch) {
+    cursor = { epoch: journal.epoch, seq: 0, ahead: new Set() };
+    eventCursors.set(hello.name, cursor);
+  }
+  // Events the rover dropped before sending will never arrive.
+  advanceEventCursor(cursor, (journal.seq ?? 0) - (journal.pending ?? 0));
+  return cursor;
+}
+
+function advanceEventCursor(cursor, floor) {
+  if (floor > cursor.seq) {
+    cursor.seq = floor;
+  }
+  if (cursor.ahead.size > MAX_EVENTS_AHEAD) {
+    cursor.seq = Math.max(cursor.seq, Math.min(...cursor.ahead) - 1);
+  }
+  cursor.ahead.forEach((seq) => {
+    if (seq <= cursor.seq) cursor.ahead.delete(seq);
+  });
+  while (cursor.ahead.delete(cursor.seq + 1)) {
+    cursor.seq += 1;
+  }
+}
+
+// acceptEvent acknowledges a sequenced event and reports whether it is new.
+// Events from rovers without a journal carry no seq and are always new.
+function acceptEvent(ws, roverId, msg) {
+  const cursor = eventCursors.get(roverId);
+  if (!msg.seq || !cursor) return true;
+  const fresh = msg.seq > cursor.seq && !cursor.ahead.has(msg.seq);
+  if (fresh) {
+    cursor.ahead.add(msg.seq);
+    advanceEventCursor(cursor, 0);
+  }
+  ws.send(JSON.stringify({ type: 'eventAck', epoch: cursor.epoch, seq: cursor.seq }));
+  return fresh;
+}
+
+function negotiateProtocol(hello) {
+  const roverVersion = hello.protocol?.version ?? 1;
+  const roverMinServer = hello.protocol?.minServerVersion ?? 1;
+  if (roverVersion < MIN_ROVER_PROTOCOL_VERSION) {
+    return {
+      accepted: false,
+      reason: `rover protocol ${roverVersion} is older than the minimum ${MIN_ROVER_PROTOCOL_VERSION}`,
+    };
+  }
+  if (roverMinServer > PROTOCOL_VERSION) {
+    return {
+      accepted: false,
+      reason: `rover needs server protocol ${roverMinServer}, server speaks ${PROTOCOL_VERSION}`,
+    };
+  }
+  return {
+    accepted: true,
+    version: Math.min(roverVersion, PROTOCOL_VERSION),
+    sensorEncoding: chooseSensorEncoding(hello.capabilities?.sensorEncodings),
+    telemetry: hello.capabilities?.telemetryModes?.includes(TELEMETRY_MODE) ? TELEMETRY_MODE : 'raw',
+  };
+}
+
+function sendServerHello(ws, result) {
+  ws.send(JSON.stringify({
+    type: 'serverHello',
+    serverVersion: SERVER_VERSION,
+    protocolVersion: PROTOCOL_VERSION,
+    minProtocolVersion: MIN_ROVER_PROTOCOL_VERSION,
+    accepted: result.accepted,
+    reason: result.reason,
+    sensorEncoding: result.sensorEncoding,
+    telemetry: result.telemetry,
+    eventSeq: result.eventSeq,
+    eventEpoch: result.eventEpoch,
+  }));
+}
 
 function handleMessage(roverId, msg) {
   switch (msg.type) {
@@ -13,17 +120,48 @@ function handleMessage(roverId, msg) {
     case 'sensor':
       roverManager.handleSensorFrame(roverId, msg);
       break;
+    case 'odometry':
+      roverManager.handleOdometry(roverId, msg);
+      break;
+    case 'telemetry':
+      roverManager.handleTelemetry(roverId, msg);
+      break;
+    case 'link':
+      roverManager.handleLink(roverId, msg);
+      break;
+    case 'battery':
+      roverManager.handleBattery(roverId, msg);
+      break;
+    case 'chargeHistory':
+      roverManager.handleChargeHistory(roverId, msg);
+      break;
     case 'event':
-      sendAlert({ color: COLORS.info, title: `${roverId} event`, message: msg.event });
+      roverManager.handleRoverEvent(roverId, msg);
+      sendAlert({ color: eventAlertColor(msg.event), title: `${roverId} event`, message: msg.event });
       break;
     default:
       break;
   }
 }
 
-roverWSS.on('connection', (ws) => {
+roverWSS.on('connection', (ws, req) => {
   let roverId = null;
-  ws.on('message', (raw) => {
+  const nonce = createChallenge();
+  if (nonce) {
+    ws.send(JSON.stringify({ type: 'authChallenge', nonce }));
+  }
+  ws.on('message', (raw, isBinary) => {
+    if (isBinary) {
+      if (!roverId) return;
+      const frame = parseBinaryMessage(raw);
+      if (frame?.type === 'sensor') {
+        const msg = { type: 'sensor', ts: frame.ts, seq: frame.seq, data: frame.payload.toString('base64') };
+        roverManager.handleSensorFrame(roverId, msg, frame.payload);
+      } else {
+        logger.warn('Unknown binary rover message', roverId, frame?.binaryType);
+      }
+      return;
+    }
     let msg;
     try {
       msg = JSON.parse(raw.toString());
@@ -32,13 +170,41 @@ roverWSS.on('connection', (ws) => {
       return;
     }
     if (msg.type === 'hello') {
-      roverId = msg.name;
+      let protocol = negotiateProtocol(msg);
+      const auth = authenticateRover(msg, { headers: req?.headers, nonce });
+      if (protocol.accepted && !auth.ok) {
+        protocol = { accepted: false, reason: `authentication failed: ${auth.reason}` };
+      }
       logger.info('Received rover hello', {
-        roverId,
+        roverId: msg.name,
+        version: msg.version,
+        protocol: msg.protocol?.version ?? 1,
+        accepted: protocol.accepted,
+        auth: auth.ok ? auth.method : auth.reason,
         keys: Object.keys(msg),
         cameraServo: msg.cameraServo,
       });
-      roverManager.upsertRover(msg, ws);
+      const cursor = protocol.accepted ? eventCursorFor(msg) : null;
+      if (cursor) {
+        protocol.eventSeq = cursor.seq;
+        protocol.eventEpoch = cursor.epoch;
+      }
+      if (msg.protocol) {
+        sendServerHello(ws, protocol);
+      }
+      if (!protocol.accepted) {
+        logger.warn('Rejected rover', msg.name, protocol.reason);
+        sendAlert({ color: COLORS.error, title: 'Rover Rejected', message: `${msg.name}: ${protocol.reason}` });
+        ws.close(1008, protocol.reason);
+        return;
+      }
+      roverId = msg.name;
+      roverManager.upsertRover({
+        ...msg,
+        protocolVersion: protocol.version,
+        sensorEncoding: msg.protocol ? protocol.sensorEncoding : 'json',
+        telemetry: msg.protocol ? protocol.telemetry : 'raw',
+      }, ws);
       roverManager.broadcastRoster();
       sendAlert({ color: COLORS.success, title: 'Rover Online', message: roverId });
       return;
@@ -46,10 +212,26 @@ roverWSS.on('connection', (ws) => {
     if (!roverId) return;
     if (msg.type === 'sensor') {
       roverManager.handleSensorFrame(roverId, msg);
+    } else if (msg.type === 'odometry') {
+      roverManager.handleOdometry(roverId, msg);
+    } else if (msg.type === 'telemetry') {
+      roverManager.handleTelemetry(roverId, msg);
+    } else if (msg.type === 'link') {
+      roverManager.handleLink(roverId, msg);
+    } else if (msg.type === 'echo') {
+      // Answered straight away so the rover's echo round trip measures the
+      // link plus this event loop, not any downstream work.
+      ws.send(JSON.stringify({ type: 'echoReply', seq: msg.seq, ts: msg.ts }));
+    } else if (msg.type === 'battery') {
+      roverManager.handleBattery(roverId, msg);
+    } else if (msg.type === 'chargeHistory') {
+      roverManager.handleChargeHistory(roverId, msg);
     } else if (msg.type === 'ack') {
       handleAck(msg);
     } else if (msg.type === 'event') {
-      sendAlert({ color: COLORS.info, title: `${roverId}`, message: msg.event });
+      if (!acceptEvent(ws, roverId, msg)) return;
+      roverManager.handleRoverEvent(roverId, msg);
+      sendAlert({ color: eventAlertColor(msg.event), title: `${roverId}`, message: msg.event });
     }
   });
 
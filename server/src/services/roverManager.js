@@ -114,6 +114,11 @@ function getRoster() {
   return Array.from(rovers.values()).map((record) => ({
     id: record.id,
     name: record.meta?.name || record.id,
+    version: record.meta?.version,
+    protocolVersion: record.meta?.protocolVersion ?? 1,
+    sensorEncoding: record.meta?.sensorEncoding || 'json',
+    telemetry: record.meta?.telemetry || 'raw',
+    capabilities: record.meta?.capabilities,
     battery: record.meta?.battery,
     batteryState: record.batteryState,
     maxWheelSpeed: record.meta?.maxWheelSpeed,
@@ -121,12 +126,25 @@ function getRoster() {
     cameraServo: record.meta?.cameraServo,
     audio: record.meta?.audio,
     nightVision: record.meta?.nightVision,
+    drive: record.meta?.drive,
+    oi: record.meta?.oi,
+    safety: record.meta?.safety,
+    estop: record.meta?.estop,
+    autoCharge: record.meta?.autoCharge,
+    link: record.link,
     locked: record.locked,
     lockReason: record.lockReason,
     lastSeen: record.lastSeen,
   }));
 }
 
+// supportsCommand reports whether a rover advertised a command in its hello
+// capabilities, or null for rovers too old to advertise any.
+function supportsCommand(id, command) {
+  const commands = rovers.get(id)?.meta?.capabilities?.commands;
+  return Array.isArray(commands) ? commands.includes(command) : null;
+}
+
 function broadcastRoster() {
   io.emit('rovers', getRoster());
 }
@@ -164,11 +182,13 @@ function computeBatteryState(record, sensors) {
   };
 }
 
-function handleSensorFrame(roverId, frame) {
+// handleSensorFrame takes a JSON sensor message; binary messages pass the
+// raw frame as well so it is not decoded from base64 again.
+function handleSensorFrame(roverId, frame, raw) {
   const record = rovers.get(roverId);
   if (!record) return;
   record.lastSeen = Date.now();
-  const decoded = parseSensorFrame(frame.data);
+  const decoded = parseSensorFrame(raw || frame.data);
   record.lastSensor = { raw: frame, decoded };
   record.batteryState = computeBatteryState(record, decoded);
   io.to(record.room).emit('sensorFrame', {
@@ -179,6 +199,96 @@ function handleSensorFrame(roverId, frame) {
   managerEvents.emit('sensor', { roverId, sensors: decoded, batteryState: record.batteryState });
 }
 
+// handleTelemetry relays the decoded telemetry rovers send when asked for
+// it in serverHello, so subscribers need no OI frame parser.
+function handleTelemetry(roverId, msg) {
+  const record = rovers.get(roverId);
+  if (!record) return;
+  record.lastSeen = Date.now();
+  const { type, ...telemetry } = msg;
+  record.lastTelemetry = telemetry;
+  io.to(record.room).emit('telemetry', { roverId, ...telemetry });
+  managerEvents.emit('telemetry', { roverId, telemetry });
+}
+
+// handleLink keeps the rover's latest heartbeat round-trip statistics so
+// lag can be told apart between the Wi-Fi link and the server.
+function handleLink(roverId, msg) {
+  const record = rovers.get(roverId);
+  if (!record) return;
+  record.lastSeen = Date.now();
+  const { type, ...link } = msg;
+  record.link = link;
+  io.to(record.room).emit('link', { roverId, ...link });
+  managerEvents.emit('link', { roverId, link });
+}
+
+function handleOdometry(roverId, msg) {
+  const record = rovers.get(roverId);
+  if (!record) return;
+  record.lastSeen = Date.now();
+  record.odometry = {
+    x: msg.x,
+    y: msg.y,
+    headingDeg: msg.headingDeg,
+    distanceMm: msg.distanceMm,
+    ts: msg.ts,
+  };
+  io.to(record.room).emit('odometry', { roverId, ...record.odometry });
+}
+
+function handleBattery(roverId, msg) {
+  const record = rovers.get(roverId);
+  if (!record) return;
+  record.lastSeen = Date.now();
+  const { type, ...estimate } = msg;
+  record.batteryEstimate = estimate;
+  io.to(record.room).emit('battery', { roverId, ...estimate });
+  managerEvents.emit('battery', { roverId, estimate });
+}
+
+function handleChargeHistory(roverId, msg) {
+  const record = rovers.get(roverId);
+  if (!record) return;
+  record.lastSeen = Date.now();
+  record.chargeHistory = { id: msg.id, sessions: msg.sessions || [], receivedAt: Date.now() };
+  io.to(record.room).emit('chargeHistory', { roverId, id: msg.id, sessions: record.chargeHistory.sessions });
+  managerEvents.emit('chargeHistory', { roverId, id: msg.id, sessions: record.chargeHistory.sessions });
+}
+
+function handleRoverEvent(roverId, msg) {
+  const record = rovers.get(roverId);
+  if (!record) return;
+  record.lastSeen = Date.now();
+  if (msg.event === 'oi.modeChanged' && record.meta?.oi && msg.data?.mode) {
+    record.meta.oi = { ...record.meta.oi, mode: msg.data.mode };
+    broadcastRoster();
+  }
+  if (msg.event === 'estop.triggered' && record.meta) {
+    record.meta.estop = {
+      ...record.meta.estop,
+      latched: true,
+      source: msg.data?.source,
+      reason: msg.data?.reason,
+      sinceMs: msg.ts || Date.now(),
+    };
+    broadcastRoster();
+  }
+  if (msg.event === 'estop.cleared' && record.meta) {
+    record.meta.estop = { ...record.meta.estop, latched: false, source: undefined, reason: undefined, sinceMs: undefined };
+    broadcastRoster();
+  }
+  if (msg.event === 'autoCharge.state' && record.meta && msg.data?.state) {
+    record.meta.autoCharge = {
+      ...record.meta.autoCharge,
+      state: msg.data.state,
+      retries: msg.data.retries,
+    };
+    broadcastRoster();
+  }
+  managerEvents.emit('roverEvent', { roverId, event: msg.event, data: msg.data });
+}
+
 function removeSocket(socket) {
   const joined = socketToRovers.get(socket.id);
   if (!joined) {
@@ -318,7 +428,14 @@ module.exports = {
   lockRover,
   getRoster,
   broadcastRoster,
+  supportsCommand,
   handleSensorFrame,
+  handleRoverEvent,
+  handleOdometry,
+  handleTelemetry,
+  handleLink,
+  handleBattery,
+  handleChargeHistory,
   requestControl,
   releaseControl,
   removeSocket,
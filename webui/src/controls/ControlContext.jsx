@@ -113,6 +113,19 @@ export function ControlSystemProvider({ children }) {
     }
   }, [pipeline.roverId, pipeline.enableSensorStream]);
 
+  // roverd stops the wheels when drive commands stop arriving, so keep
+  // re-sending a held drive vector well inside the advertised deadman window.
+  const deadmanTimeoutMs = pipeline.rosterEntry?.drive?.deadmanTimeoutMs;
+  useEffect(() => {
+    const { left, right } = state.drive.speeds;
+    if (!pipeline.roverId || (left === 0 && right === 0)) return undefined;
+    const timeoutMs = typeof deadmanTimeoutMs === 'number' && deadmanTimeoutMs > 0 ? deadmanTimeoutMs : 1000;
+    const id = setInterval(() => {
+      pipeline.sendDriveDirect({ left, right });
+    }, Math.max(timeoutMs / 3, 100));
+    return () => clearInterval(id);
+  }, [pipeline, deadmanTimeoutMs, state.drive.speeds]);
+
   const setMode = useCallback(
     (mode) => {
       dispatch({ type: 'control/set-mode', payload: mode });
@@ -111,18 +111,34 @@ export function useCommandPipeline() {
     [emitCommand, enableSensorStream, roverId],
   );
 
+  const deadmanTimeoutMs = rosterEntry?.drive?.deadmanTimeoutMs;
+
   const runMacroSteps = useCallback(
     async (macro) => {
       if (!macro || !Array.isArray(macro.steps) || !roverId) return;
+      // roverd stops the wheels when drive commands stop arriving, so a drive
+      // step is re-sent while the macro waits, like a held drive key.
+      const timeoutMs = typeof deadmanTimeoutMs === 'number' && deadmanTimeoutMs > 0 ? deadmanTimeoutMs : 1000;
+      const resendMs = Math.max(timeoutMs / 3, 100);
+      let held = null;
+      const wait = async (ms) => {
+        const until = Date.now() + ms;
+        for (let left = ms; left > 0; left = until - Date.now()) {
+          await sleep(held ? Math.min(left, resendMs) : left); // eslint-disable-line no-await-in-loop
+          if (held && until - Date.now() > 0) sendDriveDirect(held);
+        }
+      };
       for (const step of macro.steps) {
         if (!roverId) break;
         switch (step.type) {
           case 'oi':
             sendOiCommand(step.command);
             break;
-          case 'drive':
-            sendDriveDirect(step.speeds ?? { left: 0, right: 0 });
+          case 'drive': {
+            const speeds = sendDriveDirect(step.speeds ?? { left: 0, right: 0 });
+            held = speeds && (speeds.left !== 0 || speeds.right !== 0) ? speeds : null;
             break;
+          }
           case 'motors':
             sendAuxMotors(step.values ?? {});
             break;
@@ -130,7 +146,7 @@ export function useCommandPipeline() {
             sendServoAngle(step.angle);
             break;
           case 'pause':
-            await sleep(step.duration ?? COMMAND_DELAY_MS); // eslint-disable-line no-await-in-loop
+            await wait(step.duration ?? COMMAND_DELAY_MS); // eslint-disable-line no-await-in-loop
             break;
           default:
             break;
@@ -138,12 +154,12 @@ export function useCommandPipeline() {
         if (step.delay || step.delayMs) {
           const delay = step.delayMs ?? step.delay;
           if (typeof delay === 'number' && delay > 0) {
-            await sleep(delay); // eslint-disable-line no-await-in-loop
+            await wait(delay); // eslint-disable-line no-await-in-loop
           }
         }
       }
     },
-    [roverId, sendOiCommand, sendDriveDirect, sendAuxMotors, sendServoAngle],
+    [roverId, deadmanTimeoutMs, sendOiCommand, sendDriveDirect, sendAuxMotors, sendServoAngle],
   );
 
   const sendNightVision = useCallback(